@@ -16,6 +16,11 @@
 package elastos
 
 import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
 	"github.com/blocktree/go-owcdrivers/addressEncoder"
 	"github.com/blocktree/go-owcdrivers/elastosTransaction"
 	"github.com/blocktree/go-owcrypt"
@@ -26,6 +31,46 @@ func init() {
 
 }
 
+const (
+	//地址前缀
+	PrefixStandard   = byte(0x21) //标准地址，以E开头
+	PrefixMultiSig   = byte(0x12) //多重签名地址，以8开头
+	PrefixCrossChain = byte(0x4B) //跨链地址，以X开头
+	PrefixDeposit    = byte(0x1F) //抵押地址，以D开头
+	PrefixIDChain    = byte(0x67) //DID地址，以i开头
+
+	//WIF私钥前缀及压缩公钥标识
+	PrefixPrivateWIF = byte(0x80)
+	SuffixCompressed = byte(0x01)
+
+	//脚本操作码
+	OP_1             = byte(0x51)
+	OP_16            = byte(0x60)
+	OP_CHECKMULTISIG = byte(0xAE)
+)
+
+var (
+	//ELA_MultiSigAddress 多重签名地址编码配置
+	ELA_MultiSigAddress = addressEncoder.AddressType{
+		EncodeType:   "base58",
+		Alphabet:     addressEncoder.BTCAlphabet,
+		ChecksumType: "doubleSHA256",
+		HashType:     "h160",
+		HashLen:      20,
+		Prefix:       []byte{PrefixMultiSig},
+	}
+
+	//ELA_PrivateWIF WIF私钥编码配置，主网与测试网相同
+	ELA_PrivateWIF = addressEncoder.AddressType{
+		EncodeType:   "base58",
+		Alphabet:     addressEncoder.BTCAlphabet,
+		ChecksumType: "doubleSHA256",
+		HashLen:      32,
+		Prefix:       []byte{PrefixPrivateWIF},
+		Suffix:       []byte{SuffixCompressed},
+	}
+)
+
 //var (
 //	AddressDecoder = &openwallet.AddressDecoder{
 //		PrivateKeyToWIF:    PrivateKeyToWIF,
@@ -35,8 +80,47 @@ func init() {
 //	}
 //)
 
+//AddressType 地址类型，取值为地址的前缀字节
+type AddressType byte
+
+const (
+	AddressTypeStandard   = AddressType(PrefixStandard)
+	AddressTypeMultiSig   = AddressType(PrefixMultiSig)
+	AddressTypeCrossChain = AddressType(PrefixCrossChain)
+	AddressTypeDeposit    = AddressType(PrefixDeposit)
+	AddressTypeIDChain    = AddressType(PrefixIDChain)
+)
+
+//String 地址类型名称
+func (t AddressType) String() string {
+	switch t {
+	case AddressTypeStandard:
+		return "standard"
+	case AddressTypeMultiSig:
+		return "multisig"
+	case AddressTypeCrossChain:
+		return "crosschain"
+	case AddressTypeDeposit:
+		return "deposit"
+	case AddressTypeIDChain:
+		return "did"
+	default:
+		return fmt.Sprintf("unknown(0x%02x)", byte(t))
+	}
+}
+
+//IsTransferable 普通转账可以发送到的地址类型
+func (t AddressType) IsTransferable() bool {
+	return t == AddressTypeStandard || t == AddressTypeMultiSig
+}
+
 type AddressDecoder interface {
 	openwallet.AddressDecoder
+
+	//AddressVerify 地址校验
+	AddressVerify(address string, opts ...interface{}) bool
+	//GetAddressType 校验地址并返回地址类型
+	GetAddressType(address string) (AddressType, error)
 }
 
 type addressDecoder struct {
@@ -50,9 +134,22 @@ func NewAddressDecoder(wm *WalletManager) *addressDecoder {
 	return &decoder
 }
 
-//PrivateKeyToWIF 私钥转WIF
+//PrivateKeyToWIF 导出私钥，默认为官方钱包（ela-cli）可以导入的16进制私钥，
+//配置privateKeyFormat为wif时导出带校验码的base58 WIF
 func (decoder *addressDecoder) PrivateKeyToWIF(priv []byte, isTestnet bool) (string, error) {
-	return "", nil
+
+	if err := checkPrivateKey(priv); err != nil {
+		return "", err
+	}
+
+	switch decoder.wm.Config.PrivateKeyFormat {
+	case PrivateKeyFormatHex, "":
+		return hex.EncodeToString(priv), nil
+	case PrivateKeyFormatWIF:
+		return addressEncoder.AddressEncode(priv, ELA_PrivateWIF), nil
+	default:
+		return "", fmt.Errorf("private key format: %s is not supported", decoder.wm.Config.PrivateKeyFormat)
+	}
 }
 
 //PublicKeyToAddress 公钥转地址
@@ -72,12 +169,196 @@ func (decoder *addressDecoder) PublicKeyToAddress(pub []byte, isTestnet bool) (s
 
 //RedeemScriptToAddress 多重签名赎回脚本转地址
 func (decoder *addressDecoder) RedeemScriptToAddress(pubs [][]byte, required uint64, isTestnet bool) (string, error) {
-	return "", nil
+
+	//主网与测试网的地址前缀相同
+	redeemScript, err := CreateMultiSigRedeemScript(pubs, required)
+	if err != nil {
+		return "", err
+	}
+
+	pkHash := owcrypt.Hash(redeemScript, 0, owcrypt.HASH_ALG_HASH160)
+
+	address := addressEncoder.AddressEncode(pkHash, ELA_MultiSigAddress)
+
+	return address, nil
+}
+
+//CreateMultiSigRedeemScript 创建M-of-N多重签名赎回脚本，公钥按坐标排序
+//脚本结构：OP_M | 0x21 pubkey ... | OP_N | OP_CHECKMULTISIG
+func CreateMultiSigRedeemScript(pubs [][]byte, required uint64) ([]byte, error) {
+
+	n := len(pubs)
+	if n == 0 {
+		return nil, fmt.Errorf("public keys is empty")
+	}
+
+	if n > int(OP_16-OP_1+1) {
+		return nil, fmt.Errorf("public keys count: %d is over max: %d", n, OP_16-OP_1+1)
+	}
+
+	if required < 1 || required > uint64(n) {
+		return nil, fmt.Errorf("required: %d is invalid, must between 1 and %d", required, n)
+	}
+
+	sortedPubs := make([][]byte, 0, n)
+	for _, pub := range pubs {
+		compressed, err := compressPublicKey(pub)
+		if err != nil {
+			return nil, err
+		}
+		for _, exist := range sortedPubs {
+			if bytes.Equal(exist, compressed) {
+				return nil, fmt.Errorf("public key: %x is duplicated", compressed)
+			}
+		}
+		sortedPubs = append(sortedPubs, compressed)
+	}
+
+	sortPublicKeys(sortedPubs)
+
+	script := []byte{OP_1 + byte(required) - 1}
+	for _, pub := range sortedPubs {
+		script = append(script, byte(len(pub)))
+		script = append(script, pub...)
+	}
+	script = append(script, OP_1+byte(n)-1, OP_CHECKMULTISIG)
+
+	return script, nil
+}
+
+//compressPublicKey 统一使用33字节的压缩公钥
+func compressPublicKey(pub []byte) ([]byte, error) {
+	switch len(pub) {
+	case 33:
+		if pub[0] != 0x02 && pub[0] != 0x03 {
+			return nil, fmt.Errorf("public key: %x is invalid", pub)
+		}
+		return pub, nil
+	case 64:
+		return owcrypt.PointCompress(append([]byte{0x04}, pub...), owcrypt.ECC_CURVE_SECP256R1), nil
+	case 65:
+		return owcrypt.PointCompress(pub, owcrypt.ECC_CURVE_SECP256R1), nil
+	default:
+		return nil, fmt.Errorf("public key length: %d is invalid", len(pub))
+	}
+}
+
+//sortPublicKeys 按公钥X坐标升序排列，X相同时比较Y坐标，与节点的排序规则一致
+func sortPublicKeys(pubs [][]byte) {
+	sort.Slice(pubs, func(i, j int) bool {
+		if c := bytes.Compare(pubs[i][1:], pubs[j][1:]); c != 0 {
+			return c < 0
+		}
+		yi := owcrypt.PointDecompress(pubs[i], owcrypt.ECC_CURVE_SECP256R1)[33:]
+		yj := owcrypt.PointDecompress(pubs[j], owcrypt.ECC_CURVE_SECP256R1)[33:]
+		return bytes.Compare(yi, yj) < 0
+	})
 }
 
 //WIFToPrivateKey WIF转私钥
+//官方钱包（ela-cli）导出的16进制私钥也可以导入
 func (decoder *addressDecoder) WIFToPrivateKey(wif string, isTestnet bool) ([]byte, error) {
-	return nil, nil
+
+	if len(wif) == 0 {
+		return nil, fmt.Errorf("WIF is empty")
+	}
+
+	//16进制私钥
+	if len(wif) == 64 {
+		if priv, err := hex.DecodeString(wif); err == nil {
+			if err = checkPrivateKey(priv); err != nil {
+				return nil, err
+			}
+			return priv, nil
+		}
+	}
+
+	data, err := addressEncoder.Base58Decode(wif, addressEncoder.NewBase58Alphabet(ELA_PrivateWIF.Alphabet))
+	if err != nil {
+		return nil, fmt.Errorf("WIF contains invalid base58 character")
+	}
+
+	//前缀 + 私钥 + [压缩标识] + 校验码
+	if len(data) != 1+32+4 && len(data) != 1+32+1+4 {
+		return nil, fmt.Errorf("WIF length is invalid")
+	}
+
+	payload := data[:len(data)-4]
+	checksum := owcrypt.Hash(payload, 0, owcrypt.HASh_ALG_DOUBLE_SHA256)[:4]
+	if !bytes.Equal(checksum, data[len(data)-4:]) {
+		return nil, fmt.Errorf("WIF checksum is invalid")
+	}
+
+	if payload[0] != PrefixPrivateWIF {
+		return nil, fmt.Errorf("WIF prefix: %x is invalid", payload[0])
+	}
+
+	if len(payload) == 1+32+1 && payload[33] != SuffixCompressed {
+		return nil, fmt.Errorf("WIF compressed flag: %x is invalid", payload[33])
+	}
+
+	priv := payload[1:33]
+	if err = checkPrivateKey(priv); err != nil {
+		return nil, err
+	}
+
+	return priv, nil
+}
+
+//checkPrivateKey 私钥必须为32字节，且在(0, n)范围内
+func checkPrivateKey(priv []byte) error {
+
+	if len(priv) != 32 {
+		return fmt.Errorf("private key length: %d is invalid", len(priv))
+	}
+
+	if bytes.Equal(priv, make([]byte, 32)) {
+		return fmt.Errorf("private key is zero")
+	}
+
+	if bytes.Compare(priv, owcrypt.GetCurveOrder(owcrypt.ECC_CURVE_SECP256R1)) >= 0 {
+		return fmt.Errorf("private key is out of curve order")
+	}
+
+	return nil
+}
+
+//AddressVerify 地址校验，校验码正确且前缀为已知的地址类型
+func (decoder *addressDecoder) AddressVerify(address string, opts ...interface{}) bool {
+	_, err := decoder.GetAddressType(address)
+	return err == nil
+}
+
+//GetAddressType 校验地址并返回地址类型
+//地址结构：前缀 + hash160(脚本) + 4字节校验码
+func (decoder *addressDecoder) GetAddressType(address string) (AddressType, error) {
+
+	if len(address) == 0 {
+		return 0, fmt.Errorf("address is empty")
+	}
+
+	data, err := addressEncoder.Base58Decode(address, addressEncoder.NewBase58Alphabet(addressEncoder.BTCAlphabet))
+	if err != nil {
+		return 0, fmt.Errorf("address: %s contains invalid base58 character", address)
+	}
+
+	if len(data) != 1+20+4 {
+		return 0, fmt.Errorf("address: %s length is invalid", address)
+	}
+
+	payload := data[:len(data)-4]
+	checksum := owcrypt.Hash(payload, 0, owcrypt.HASh_ALG_DOUBLE_SHA256)[:4]
+	if !bytes.Equal(checksum, data[len(data)-4:]) {
+		return 0, fmt.Errorf("address: %s checksum is invalid", address)
+	}
+
+	addressType := AddressType(payload[0])
+	switch addressType {
+	case AddressTypeStandard, AddressTypeMultiSig, AddressTypeCrossChain, AddressTypeDeposit, AddressTypeIDChain:
+		return addressType, nil
+	default:
+		return 0, fmt.Errorf("address: %s prefix: %x is unknown", address, payload[0])
+	}
 }
 
 //ScriptPubKeyToBech32Address scriptPubKey转Bech32地址
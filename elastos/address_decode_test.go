@@ -0,0 +1,298 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package elastos
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/blocktree/go-owcdrivers/addressEncoder"
+	"github.com/blocktree/go-owcrypt"
+)
+
+var (
+	//secp256r1私钥1，2，3对应的压缩公钥
+	testPubKeys = []string{
+		"036b17d1f2e12c4247f8bce6e563a440f277037d812deb33a0f4a13945d898c296",
+		"037cf27b188d034f7e8a52380304b51ac3c08969e277f21b35a60b48fc47669978",
+		"025ecbe4d1a6330a44c8f7ef951d4bf165e6c6b721efada985fb41661bc6e7fd6c",
+	}
+)
+
+func testDecodePubKeys(t *testing.T, pubs ...string) [][]byte {
+	keys := make([][]byte, 0)
+	for _, p := range pubs {
+		key, err := hex.DecodeString(p)
+		if err != nil {
+			t.Fatalf("decode public key failed unexpected error: %v", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func TestAddressDecoder_PublicKeyToAddress(t *testing.T) {
+	expected := []string{
+		"ESUQkMEsfUdbmrounnCrNdVHLXrvSzvy7A",
+		"EQZFJqni8nGrbU4gkmP4V9Qmi1BHbnWuEe",
+		"EK89RfdqPUr82EUHQy5KNVH3LSmNsQLPau",
+	}
+	for i, pub := range testDecodePubKeys(t, testPubKeys...) {
+		address, err := tw.Decoder.PublicKeyToAddress(pub, false)
+		if err != nil {
+			t.Errorf("PublicKeyToAddress failed unexpected error: %v", err)
+			continue
+		}
+		if address != expected[i] {
+			t.Errorf("PublicKeyToAddress address = %s, expected = %s", address, expected[i])
+		}
+	}
+}
+
+func TestCreateMultiSigRedeemScript(t *testing.T) {
+	expected := "5221025ecbe4d1a6330a44c8f7ef951d4bf165e6c6b721efada985fb41661bc6e7fd6c21036b17d1f2e12c4247f8bce6e563a440f277037d812deb33a0f4a13945d898c29621037cf27b188d034f7e8a52380304b51ac3c08969e277f21b35a60b48fc4766997853ae"
+	script, err := CreateMultiSigRedeemScript(testDecodePubKeys(t, testPubKeys...), 2)
+	if err != nil {
+		t.Fatalf("CreateMultiSigRedeemScript failed unexpected error: %v", err)
+	}
+	if hex.EncodeToString(script) != expected {
+		t.Errorf("CreateMultiSigRedeemScript script = %x, expected = %s", script, expected)
+	}
+}
+
+func TestAddressDecoder_RedeemScriptToAddress(t *testing.T) {
+
+	tests := []struct {
+		pubs     []string
+		required uint64
+		address  string
+	}{
+		{testPubKeys, 2, "8P4qN1dTdm3Eq1tzSpqsVhzTmkSbiWiwrd"},
+		{testPubKeys, 3, "8SwheWbxNT8ndShfZfExEUrFQm6v7Cb2vG"},
+		{testPubKeys[:2], 1, "8N7ujkKgPsvxBZL1eNBh4LzeGia3FUTpaF"},
+		//公钥顺序不影响地址
+		{[]string{testPubKeys[2], testPubKeys[0], testPubKeys[1]}, 2, "8P4qN1dTdm3Eq1tzSpqsVhzTmkSbiWiwrd"},
+	}
+
+	for _, test := range tests {
+		for _, isTestnet := range []bool{false, true} {
+			address, err := tw.Decoder.RedeemScriptToAddress(testDecodePubKeys(t, test.pubs...), test.required, isTestnet)
+			if err != nil {
+				t.Errorf("RedeemScriptToAddress failed unexpected error: %v", err)
+				continue
+			}
+			if address != test.address {
+				t.Errorf("RedeemScriptToAddress address = %s, expected = %s", address, test.address)
+			}
+		}
+	}
+
+	//BIP-67公开的测试向量1：2-of-2赎回脚本及其P2SH地址。
+	//节点的多签赎回脚本与比特币结构相同，脚本hash160必须与公开的P2SH地址一致，只是地址前缀不同
+	bip67Pubs := []string{
+		"02ff12471208c14bd580709cb2358d98975247d8765f92bc25eab3b2763ed605f8",
+		"02fe6f0a5a297eb38c391581c4413e084773ea23954d93f7753db7dc0adc188b2f",
+	}
+	bip67Script := "522102fe6f0a5a297eb38c391581c4413e084773ea23954d93f7753db7dc0adc188b2f2102ff12471208c14bd580709cb2358d98975247d8765f92bc25eab3b2763ed605f852ae"
+	bip67Hash, err := addressEncoder.AddressDecode("39bgKC7RFbpoCRbtD5KEdkYKtNyhpsNa3Z", addressEncoder.BTC_mainnetAddressP2SH)
+	if err != nil {
+		t.Fatalf("decode BIP-67 P2SH address failed unexpected error: %v", err)
+	}
+	redeemScript, err := CreateMultiSigRedeemScript(testDecodePubKeys(t, bip67Pubs...), 2)
+	if err != nil || hex.EncodeToString(redeemScript) != bip67Script {
+		t.Errorf("CreateMultiSigRedeemScript = %x, err = %v, expected = %s", redeemScript, err, bip67Script)
+	}
+	address, err := tw.Decoder.RedeemScriptToAddress(testDecodePubKeys(t, bip67Pubs...), 2, false)
+	if err != nil {
+		t.Fatalf("RedeemScriptToAddress failed unexpected error: %v", err)
+	}
+	scriptHash, err := addressEncoder.AddressDecode(address, ELA_MultiSigAddress)
+	if err != nil || !bytes.Equal(scriptHash, bip67Hash) || address != "8NzX7bzAUwrBq4R1XXeNwP5Z4wKy5TzDbs" {
+		t.Errorf("RedeemScriptToAddress address = %s, script hash = %x, err = %v, expected hash = %x", address, scriptHash, err, bip67Hash)
+	}
+
+	invalid := []struct {
+		pubs     []string
+		required uint64
+	}{
+		{nil, 1},
+		{testPubKeys, 0},
+		{testPubKeys, 4},
+		{[]string{testPubKeys[0], testPubKeys[0]}, 1},
+		{[]string{"04aabb"}, 1},
+	}
+
+	for _, test := range invalid {
+		_, err := tw.Decoder.RedeemScriptToAddress(testDecodePubKeys(t, test.pubs...), test.required, false)
+		if err == nil {
+			t.Errorf("RedeemScriptToAddress pubs: %v required: %d should be failed", test.pubs, test.required)
+		}
+	}
+}
+
+func TestAddressDecoder_PrivateKeyToWIF(t *testing.T) {
+
+	//私钥1
+	priv, _ := hex.DecodeString("0000000000000000000000000000000000000000000000000000000000000001")
+
+	defer func(format string) {
+		tw.Config.PrivateKeyFormat = format
+	}(tw.Config.PrivateKeyFormat)
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{PrivateKeyFormatHex, "0000000000000000000000000000000000000000000000000000000000000001"},
+		{PrivateKeyFormatWIF, "KwDiBf89QgGbjEhKnhXJuH7LrciVrZi3qYjgd9M7rFU73sVHnoWn"},
+	}
+	for _, test := range tests {
+		tw.Config.PrivateKeyFormat = test.format
+		for _, isTestnet := range []bool{false, true} {
+			wif, err := tw.Decoder.PrivateKeyToWIF(priv, isTestnet)
+			if err != nil {
+				t.Fatalf("PrivateKeyToWIF failed unexpected error: %v", err)
+			}
+			if wif != test.expected {
+				t.Errorf("PrivateKeyToWIF format: %s wif = %s, expected = %s", test.format, wif, test.expected)
+			}
+		}
+	}
+
+	tw.Config.PrivateKeyFormat = "unknown"
+	if _, err := tw.Decoder.PrivateKeyToWIF(priv, false); err == nil {
+		t.Errorf("PrivateKeyToWIF should be failed with unknown format")
+	}
+	tw.Config.PrivateKeyFormat = PrivateKeyFormatHex
+
+	invalid := []string{
+		"",
+		"00000000000000000000000000000000000000000000000000000000000000",
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		"ffffffff00000000ffffffffffffffffbce6faada7179e84f3b9cac2fc632551",
+	}
+	for _, p := range invalid {
+		key, _ := hex.DecodeString(p)
+		if _, err := tw.Decoder.PrivateKeyToWIF(key, false); err == nil {
+			t.Errorf("PrivateKeyToWIF private key: %s should be failed", p)
+		}
+	}
+}
+
+func TestAddressDecoder_WIFToPrivateKey(t *testing.T) {
+
+	//16进制私钥及其标准地址，同一私钥的WIF也能导入
+	tests := []struct {
+		hexKey  string
+		wif     string
+		address string
+	}{
+		{
+			hexKey:  "c779d181658b112b584ce21c9ea3c23d2be0689550d790506f14bdebe6b3fe38",
+			address: "EJMzC16Eorq9CuFCGtyMrq4Jmgw9jYCHQR",
+		},
+		{
+			hexKey:  "0000000000000000000000000000000000000000000000000000000000000001",
+			wif:     "KwDiBf89QgGbjEhKnhXJuH7LrciVrZi3qYjgd9M7rFU73sVHnoWn",
+			address: "ESUQkMEsfUdbmrounnCrNdVHLXrvSzvy7A",
+		},
+	}
+
+	for _, test := range tests {
+		priv, _ := hex.DecodeString(test.hexKey)
+		for _, encoded := range []string{test.hexKey, test.wif} {
+			if len(encoded) == 0 {
+				continue
+			}
+			key, err := tw.Decoder.WIFToPrivateKey(encoded, false)
+			if err != nil {
+				t.Fatalf("WIFToPrivateKey failed unexpected error: %v", err)
+			}
+			if !bytes.Equal(key, priv) {
+				t.Fatalf("WIFToPrivateKey key = %x, expected = %x", key, priv)
+			}
+			keyPub, _ := owcrypt.GenPubkey(key, owcrypt.ECC_CURVE_SECP256R1)
+			keyAddress, _ := tw.Decoder.PublicKeyToAddress(owcrypt.PointCompress(append([]byte{0x04}, keyPub...), owcrypt.ECC_CURVE_SECP256R1), false)
+			if keyAddress != test.address {
+				t.Errorf("WIFToPrivateKey address = %s, expected = %s", keyAddress, test.address)
+			}
+		}
+	}
+
+	invalid := []string{
+		"",
+		"KwDiBf89QgGbjEhKnhXJuH7LrciVrZi3qYjgd9M7rFU73sVHnoWm", //校验码错误
+		"KwDiBf89QgGbjEhKnhXJuH7LrciVrZi3qYjgd9M7rFU73sVHno0n", //非base58字符
+		"KwDiBf89QgGbjEhKnhXJuH7LrciVrZi3qYjgd9M7rFU73",        //长度错误
+		"ESUQkMEsfUdbmrounnCrNdVHLXrvSzvy7A",                   //地址
+		"0000000000000000000000000000000000000000000000000000000000000000",
+	}
+	for _, wif := range invalid {
+		if _, err := tw.Decoder.WIFToPrivateKey(wif, false); err == nil {
+			t.Errorf("WIFToPrivateKey wif: %s should be failed", wif)
+		} else {
+			t.Logf("WIFToPrivateKey wif: %s error: %v", wif, err)
+		}
+	}
+}
+
+func TestAddressDecoder_GetAddressType(t *testing.T) {
+
+	tests := []struct {
+		address     string
+		addressType AddressType
+	}{
+		{"ESUQkMEsfUdbmrounnCrNdVHLXrvSzvy7A", AddressTypeStandard},
+		{"8P4qN1dTdm3Eq1tzSpqsVhzTmkSbiWiwrd", AddressTypeMultiSig},
+		{"XLfk6ukyV46Q84fYpQCEjtvKmigYP2pLfx", AddressTypeCrossChain},
+		{"DdoCn8eJF7hr8zXjjwYDQNwi5XM368iYQp", AddressTypeDeposit},
+		{"ic8dfx73N74w2CZyW9XAKQYMPqtxDXVTag", AddressTypeIDChain},
+	}
+
+	for _, test := range tests {
+		addressType, err := tw.Decoder.GetAddressType(test.address)
+		if err != nil {
+			t.Errorf("GetAddressType address: %s failed unexpected error: %v", test.address, err)
+			continue
+		}
+		if addressType != test.addressType {
+			t.Errorf("GetAddressType address: %s type = %s, expected = %s", test.address, addressType, test.addressType)
+		}
+		if !tw.Decoder.AddressVerify(test.address) {
+			t.Errorf("AddressVerify address: %s should be valid", test.address)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"ESUQkMEsfUdbmrounnCrNdVHLXrvSzvy7B",                   //校验码错误
+		"ESUQkMEsfUdbmrounnCrNdVHLXrvSzvy70",                   //非base58字符
+		"ESUQkMEsfUdbmrounnCrNdVHLXrvSzvy",                     //长度错误
+		"1AKWFmQNEXLgnZD3ywDLNVWKZtMnz1qeiG",                   //未知前缀
+		"KwDiBf89QgGbjEhKnhXJuH7LrciVrZi3qYjgd9M7rFU73sVHnoWn", //WIF私钥
+	}
+	for _, address := range invalid {
+		if _, err := tw.Decoder.GetAddressType(address); err == nil {
+			t.Errorf("GetAddressType address: %s should be failed", address)
+		} else {
+			t.Logf("GetAddressType address: %s error: %v", address, err)
+		}
+		if tw.Decoder.AddressVerify(address) {
+			t.Errorf("AddressVerify address: %s should be invalid", address)
+		}
+	}
+}
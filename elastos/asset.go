@@ -0,0 +1,210 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package elastos
+
+import (
+	"encoding/hex"
+	"math/big"
+	"path/filepath"
+	"strings"
+
+	"github.com/asdine/storm"
+	"github.com/blocktree/go-owcdrivers/elastosTransaction"
+	"github.com/blocktree/openwallet/common/file"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/shopspring/decimal"
+)
+
+/*
+	Elastos的代币是UTXO资产，每种资产有自己的资产ID，交易输出记录资产ID及金额。
+	openwallet的合约地址Contract.Address即为资产ID，与节点显示的assetid相同。
+	ELA的金额按8位小数定点数编码，代币的金额按资产精度放大为整数，以大端变长字节编码，精度最高18位，手续费使用ELA支付。
+	资产的名称及精度记录在资产注册交易中，查询后缓存到本地，注册后不会再改变。
+*/
+
+const (
+	//AssetDBFile 资产信息缓存数据库文件
+	AssetDBFile = "asset.db"
+
+	//MaxAssetPrecision 资产的最大精度
+	MaxAssetPrecision = 18
+)
+
+//contractAssetID 合约对应的资产ID
+func contractAssetID(contract openwallet.SmartContract) (string, error) {
+	assetID := strings.ToLower(strings.TrimPrefix(contract.Address, "0x"))
+	id, err := hex.DecodeString(assetID)
+	if err != nil || len(id) != 32 {
+		return "", openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "contract address: %s is not a valid asset id", contract.Address)
+	}
+	return assetID, nil
+}
+
+//checkAssetAmount 检查金额的小数位数是否超过资产的精度
+func checkAssetAmount(amount decimal.Decimal, precision int32) error {
+	if !amount.IsPositive() {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "amount: %s is invalid", amount.String())
+	}
+	if !amount.Equal(amount.Truncate(precision)) {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "amount: %s is more precise than asset precision: %d", amount.String(), precision)
+	}
+	return nil
+}
+
+//assetValue 按资产精度把金额放大为整数，金额的小数位数不能超过精度
+func assetValue(amount decimal.Decimal, precision int32) (*big.Int, error) {
+	if precision < 0 || precision > MaxAssetPrecision {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "asset precision: %d is invalid", precision)
+	}
+	value, ok := new(big.Int).SetString(amount.Shift(precision).String(), 10)
+	if !ok || value.Sign() < 0 {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "amount: %s is invalid for asset precision: %d", amount.String(), precision)
+	}
+	return value, nil
+}
+
+//utxoAssetID utxo的资产ID，没有记录时为ELA
+func utxoAssetID(utxo *Unspent) string {
+	if len(utxo.AssetID) == 0 {
+		return elastosTransaction.AssetID_ELA
+	}
+	return utxo.AssetID
+}
+
+//assetDecimals 交易单金额的小数位数，代币使用合约的精度
+func (decoder *TransactionDecoder) assetDecimals(rawTx *openwallet.RawTransaction, assetID string) int32 {
+	if assetID == elastosTransaction.AssetID_ELA || !rawTx.Coin.IsContract {
+		return decoder.wm.Decimal()
+	}
+	return int32(rawTx.Coin.Contract.Decimals)
+}
+
+//elaValue ELA金额转为8位小数的定点数
+func (decoder *TransactionDecoder) elaValue(amount decimal.Decimal) (uint64, error) {
+	value, err := assetValue(amount, decoder.wm.Decimal())
+	if err != nil {
+		return 0, err
+	}
+	if !value.IsUint64() {
+		return 0, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "amount: %s is out of range", amount.String())
+	}
+	return value.Uint64(), nil
+}
+
+//GetAssetInfo 获取资产信息，优先使用本地缓存，没有时查询节点的资产注册交易并缓存
+func (wm *WalletManager) GetAssetInfo(assetID string) (*AssetInfo, error) {
+
+	assetID = strings.ToLower(strings.TrimPrefix(assetID, "0x"))
+
+	//ELA在创世区块注册，不需要查询
+	if assetID == elastosTransaction.AssetID_ELA {
+		return &AssetInfo{AssetID: assetID, Name: wm.Symbol(), Precision: wm.Decimal()}, nil
+	}
+
+	wm.assetMu.Lock()
+	defer wm.assetMu.Unlock()
+
+	file.MkdirAll(wm.Config.dbPath)
+	db, err := storm.Open(filepath.Join(wm.Config.dbPath, AssetDBFile))
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var info AssetInfo
+	err = db.One("AssetID", assetID, &info)
+	if err == nil {
+		return &info, nil
+	}
+	if err != storm.ErrNotFound {
+		return nil, err
+	}
+
+	asset, err := wm.WalletClient.getAssetInfo(assetID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Save(asset); err != nil {
+		wm.Log.Warningf("cache asset: %s info failed, unexpected error: %v", assetID, err)
+	}
+
+	return asset, nil
+}
+
+//GetAssetContract 通过资产ID获取合约信息，Token及Name为资产名称，Decimals为资产精度
+func (wm *WalletManager) GetAssetContract(assetID string) (*openwallet.SmartContract, error) {
+
+	info, err := wm.GetAssetInfo(assetID)
+	if err != nil {
+		return nil, err
+	}
+
+	contract := &openwallet.SmartContract{
+		ContractID: openwallet.GenContractID(wm.Symbol(), info.AssetID),
+		Symbol:     wm.Symbol(),
+		Address:    info.AssetID,
+		Token:      info.Name,
+		Name:       info.Name,
+		Decimals:   uint64(info.Precision),
+	}
+
+	return contract, nil
+}
+
+//GetSmartContractInfo 通过资产ID获取合约信息
+func (decoder *ContractDecoder) GetSmartContractInfo(assetID string) (*openwallet.SmartContract, error) {
+	return decoder.wm.GetAssetContract(assetID)
+}
+
+//GetTokenBalanceByAddress 查询地址的代币余额，由地址该资产的未花汇总
+func (decoder *ContractDecoder) GetTokenBalanceByAddress(contract openwallet.SmartContract, address ...string) ([]*openwallet.TokenBalance, error) {
+
+	assetID, err := contractAssetID(contract)
+	if err != nil {
+		return nil, err
+	}
+
+	//合约没有记录名称或精度时，使用资产注册信息补充
+	if len(contract.Name) == 0 || contract.Decimals == 0 {
+		info, err := decoder.wm.GetAssetInfo(assetID)
+		if err != nil {
+			decoder.wm.Log.Warningf("get asset: %s info failed, unexpected error: %v", assetID, err)
+		} else {
+			if len(contract.Name) == 0 {
+				contract.Name = info.Name
+			}
+			if contract.Decimals == 0 {
+				contract.Decimals = uint64(info.Precision)
+			}
+		}
+	}
+
+	balances, err := decoder.wm.getAssetBalanceCalUnspent(assetID, address...)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenBalances := make([]*openwallet.TokenBalance, 0, len(balances))
+	for _, balance := range balances {
+		tokenBalances = append(tokenBalances, &openwallet.TokenBalance{
+			Contract: &contract,
+			Balance:  balance,
+		})
+	}
+
+	return tokenBalances, nil
+}
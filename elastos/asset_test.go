@@ -0,0 +1,148 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package elastos
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/blocktree/go-owcdrivers/elastosTransaction"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/tidwall/gjson"
+)
+
+func TestWalletManager_GetAssetInfo(t *testing.T) {
+
+	assetID := "8f1a5b9c3d2e4f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8"
+	transferID := fmt.Sprintf("%064x", 1)
+	calls := 0
+
+	node := newTestNode(t, map[string]testNodeHandler{
+		"getrawtransaction": func(params gjson.Result) (interface{}, error) {
+			calls++
+			switch params.Array()[0].String() {
+			case assetID:
+				return map[string]interface{}{
+					"txid": assetID,
+					"type": TxTypeRegisterAsset,
+					"payload": map[string]interface{}{
+						"asset": map[string]interface{}{
+							"name":        "TKN",
+							"description": "test token",
+							"precision":   4,
+							"assettype":   1,
+							"recordtype":  0,
+						},
+						"amount":     "1000000",
+						"controller": "21c1a7bd8d4e7b67f1ba5ca1e5f2b26a3b6c6c5e8f",
+					},
+				}, nil
+			case transferID:
+				return map[string]interface{}{"txid": transferID, "type": TxTypeTransferAsset}, nil
+			}
+			return nil, errors.New("unknown transaction")
+		},
+	})
+	defer node.Close()
+
+	wm := newTestWalletManager(t, node.URL)
+
+	info, err := wm.GetAssetInfo("0x" + assetID)
+	if err != nil {
+		t.Fatalf("GetAssetInfo failed unexpected error: %v", err)
+	}
+	if info.Name != "TKN" || info.Precision != 4 || info.Description != "test token" || info.Amount != "1000000" {
+		t.Errorf("GetAssetInfo = %+v", info)
+	}
+
+	//再次查询使用本地缓存
+	if _, err := wm.GetAssetInfo(assetID); err != nil || calls != 1 {
+		t.Errorf("GetAssetInfo from cache calls = %d, err = %v, expected 1 call", calls, err)
+	}
+
+	//ELA不查询节点
+	info, err = wm.GetAssetInfo(elastosTransaction.AssetID_ELA)
+	if err != nil || info.Precision != Decimals || calls != 1 {
+		t.Errorf("GetAssetInfo ELA = %+v, err = %v, calls = %d", info, err, calls)
+	}
+
+	//不是资产注册交易
+	if _, err := wm.GetAssetInfo(transferID); err == nil {
+		t.Errorf("GetAssetInfo of transfer transaction should be failed")
+	}
+
+	contract, err := wm.ContractDecoder.(*ContractDecoder).GetSmartContractInfo(assetID)
+	if err != nil {
+		t.Fatalf("GetSmartContractInfo failed unexpected error: %v", err)
+	}
+	if contract.Address != assetID || contract.Token != "TKN" || contract.Decimals != 4 || contract.ContractID != openwallet.GenContractID(Symbol, assetID) {
+		t.Errorf("GetSmartContractInfo = %+v", contract)
+	}
+}
+
+func TestContractDecoder_GetTokenBalanceByAddress(t *testing.T) {
+
+	assetID := "8f1a5b9c3d2e4f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8"
+	addr0 := "ESUQkMEsfUdbmrounnCrNdVHLXrvSzvy7A"
+	addr1 := "EQZFJqni8nGrbU4gkmP4V9Qmi1BHbnWuEe"
+
+	node := newTestNode(t, map[string]testNodeHandler{
+		"listunspent": func(params gjson.Result) (interface{}, error) {
+			return []map[string]interface{}{
+				{"assetid": assetID, "txid": fmt.Sprintf("%064x", 1), "vout": 0, "address": addr0, "amount": "30", "confirmations": 10},
+				{"assetid": assetID, "txid": fmt.Sprintf("%064x", 2), "vout": 0, "address": addr0, "amount": "0.5", "confirmations": 0},
+				{"assetid": elastosTransaction.AssetID_ELA, "txid": fmt.Sprintf("%064x", 3), "vout": 0, "address": addr1, "amount": "2", "confirmations": 10},
+			}, nil
+		},
+		"getrawtransaction": func(params gjson.Result) (interface{}, error) {
+			return map[string]interface{}{
+				"txid":    assetID,
+				"type":    TxTypeRegisterAsset,
+				"payload": map[string]interface{}{"asset": map[string]interface{}{"name": "TKN", "precision": 4}},
+			}, nil
+		},
+	})
+	defer node.Close()
+
+	wm := newTestWalletManager(t, node.URL)
+
+	balances, err := wm.ContractDecoder.GetTokenBalanceByAddress(openwallet.SmartContract{Address: assetID}, addr0, addr1)
+	if err != nil {
+		t.Fatalf("GetTokenBalanceByAddress failed unexpected error: %v", err)
+	}
+	if len(balances) != 2 {
+		t.Fatalf("GetTokenBalanceByAddress = %d balances, expected = 2", len(balances))
+	}
+
+	expected := map[string][3]string{
+		addr0: {"30.5", "30", "0.5"},
+		addr1: {"0", "0", "0"},
+	}
+	for _, b := range balances {
+		if b.Contract.Name != "TKN" || b.Contract.Decimals != 4 {
+			t.Errorf("token balance contract = %+v, expected name and decimals from asset info", b.Contract)
+		}
+		e := expected[b.Balance.Address]
+		if b.Balance.Balance != e[0] || b.Balance.ConfirmBalance != e[1] || b.Balance.UnconfirmBalance != e[2] {
+			t.Errorf("address: %s balance = %+v, expected = %v", b.Balance.Address, b.Balance, e)
+		}
+	}
+
+	if _, err := wm.ContractDecoder.GetTokenBalanceByAddress(openwallet.SmartContract{Address: "TKN"}, addr0); err == nil {
+		t.Errorf("GetTokenBalanceByAddress with invalid asset id should be failed")
+	}
+}
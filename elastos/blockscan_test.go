@@ -16,13 +16,19 @@
 package elastos
 
 import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http/httptest"
 	"path/filepath"
 	"testing"
 
 	"github.com/asdine/storm"
+	"github.com/blocktree/go-owcdrivers/elastosTransaction"
 	"github.com/blocktree/openwallet/log"
 	"github.com/blocktree/openwallet/openwallet"
 	"github.com/pborman/uuid"
+	"github.com/tidwall/gjson"
 )
 
 func TestGetELABlockHeight(t *testing.T) {
@@ -47,7 +53,7 @@ func TestGetBlockHeight(t *testing.T) {
 }
 
 func TestGetLocalNewBlock(t *testing.T) {
-	height, hash := tw.GetLocalNewBlock()
+	height, hash, _ := tw.Blockscanner.GetLocalNewBlock()
 	t.Logf("GetLocalBlockHeight height = %d \n", height)
 	t.Logf("GetLocalBlockHeight hash = %v \n", hash)
 }
@@ -57,7 +63,7 @@ func TestSaveLocalBlockHeight(t *testing.T) {
 	header, _ := bs.GetCurrentBlockHeader()
 	t.Logf("SaveLocalBlockHeight height = %d \n", header.Height)
 	t.Logf("GetLocalBlockHeight hash = %v \n", header.Hash)
-	tw.SaveLocalNewBlock(header.Height, header.Hash)
+	tw.Blockscanner.SaveLocalNewBlock(header.Height, header.Hash)
 }
 
 func TestGetBlockHash(t *testing.T) {
@@ -204,7 +210,7 @@ func TestELABlockScanner_ExtractTransaction(t *testing.T) {
 }
 
 func TestGetUnscanRecords(t *testing.T) {
-	list, err := tw.GetUnscanRecords()
+	list, err := tw.Blockscanner.GetUnscanRecords()
 	if err != nil {
 		t.Errorf("GetUnscanRecords failed unexpected error: %v\n", err)
 		return
@@ -246,7 +252,7 @@ func TestELABlockScanner_GetTransactionsByAddress(t *testing.T) {
 }
 
 func TestGetLocalBlock(t *testing.T) {
-	db, err := storm.Open(filepath.Join(tw.Config.dbPath, tw.Config.BlockchainFile))
+	db, err := storm.Open(filepath.Join(tw.Config.dbPath, "blockchain.db"))
 	if err != nil {
 		return
 	}
@@ -260,3 +266,460 @@ func TestGetLocalBlock(t *testing.T) {
 	}
 	log.Info("blocks = ", len(blocks))
 }
+
+//newTestTransactionNode 创建模拟的节点，getrawtransaction返回txs中的交易单，calls记录每笔交易单的查询次数
+func newTestTransactionNode(t *testing.T, txs map[string]interface{}) (*WalletManager, *httptest.Server, map[string]int) {
+	calls := make(map[string]int)
+	node := newTestNode(t, map[string]testNodeHandler{
+		"getrawtransaction": func(params gjson.Result) (interface{}, error) {
+			txid := params.Array()[0].String()
+			calls[txid]++
+			tx, ok := txs[txid]
+			if !ok {
+				return nil, errors.New("unknown transaction")
+			}
+			return tx, nil
+		},
+	})
+	return newTestWalletManager(t, node.URL), node, calls
+}
+
+func TestELABlockScanner_ExtractAssets(t *testing.T) {
+
+	var (
+		tokenID   = "8f1a5b9c3d2e4f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8"
+		otherID   = "0f0e0d0c0b0a09080706050403020100f0e0d0c0b0a090807060504030201000"
+		sender    = "ESUQkMEsfUdbmrounnCrNdVHLXrvSzvy7A"
+		receiver  = "EQZFJqni8nGrbU4gkmP4V9Qmi1BHbnWuEe"
+		stranger  = "EK89RfdqPUr82EUHQy5KNVH3LSmNsQLPau"
+		prevID    = fmt.Sprintf("%064x", 1)
+		txid      = fmt.Sprintf("%064x", 2)
+		accountID = "account"
+	)
+
+	txs := map[string]interface{}{
+		prevID: map[string]interface{}{
+			"txid": prevID,
+			"type": 2,
+			"vout": []map[string]interface{}{
+				{"assetid": tokenID, "value": "80", "n": 0, "address": sender},
+				{"assetid": elastosTransaction.AssetID_ELA, "value": "0.5", "n": 1, "address": sender},
+			},
+		},
+		//代币转账，ELA支付手续费，另一种代币与扫描地址无关
+		txid: map[string]interface{}{
+			"txid":          txid,
+			"type":          2,
+			"blockhash":     "block",
+			"confirmations": 1,
+			"vin":           []map[string]interface{}{{"txid": prevID, "vout": 0}, {"txid": prevID, "vout": 1}},
+			"vout": []map[string]interface{}{
+				{"assetid": tokenID, "value": "40.5", "n": 0, "address": receiver},
+				{"assetid": tokenID, "value": "39.5", "n": 1, "address": sender},
+				{"assetid": elastosTransaction.AssetID_ELA, "value": "0.4999", "n": 2, "address": sender},
+				{"assetid": otherID, "value": "1", "n": 3, "address": stranger},
+			},
+		},
+		tokenID: map[string]interface{}{
+			"txid":    tokenID,
+			"type":    TxTypeRegisterAsset,
+			"payload": map[string]interface{}{"asset": map[string]interface{}{"name": "TKN", "precision": 4}},
+		},
+	}
+
+	wm, node, calls := newTestTransactionNode(t, txs)
+	defer node.Close()
+
+	result := wm.Blockscanner.ExtractTransaction(100, "block", txid, func(address string) (string, bool) {
+		return accountID, address == sender || address == receiver
+	})
+	if !result.Success {
+		t.Fatalf("ExtractTransaction failed")
+	}
+
+	//ELA：手续费的输入及找零
+	ela := result.extractData[accountID]
+	if ela == nil || len(ela.TxInputs) != 1 || len(ela.TxOutputs) != 1 {
+		t.Fatalf("ELA extract data = %+v, expected 1 input and 1 output", ela)
+	}
+	if ela.TxInputs[0].Amount != "0.5" || ela.TxOutputs[0].Amount != "0.4999" || ela.TxOutputs[0].Coin.IsContract {
+		t.Errorf("ELA input = %+v, output = %+v", ela.TxInputs[0], ela.TxOutputs[0])
+	}
+	if ela.Transaction.Fees != "0.00010000" || ela.Transaction.Coin.IsContract {
+		t.Errorf("ELA transaction fees = %s, coin = %+v, expected fees = 0.00010000", ela.Transaction.Fees, ela.Transaction.Coin)
+	}
+
+	//代币：输入及接收、找零输出
+	if len(result.extractOmniData) != 1 {
+		t.Fatalf("token extract data assets = %d, expected = 1", len(result.extractOmniData))
+	}
+	token := result.extractOmniData[tokenID][accountID]
+	if token == nil || len(token.TxInputs) != 1 || len(token.TxOutputs) != 2 {
+		t.Fatalf("token extract data = %+v, expected 1 input and 2 outputs", token)
+	}
+	coin := token.Transaction.Coin
+	if !coin.IsContract || coin.Contract.Address != tokenID || coin.Contract.Token != "TKN" || coin.ContractID != openwallet.GenContractID(Symbol, tokenID) {
+		t.Errorf("token transaction coin = %+v", coin)
+	}
+	if token.Transaction.Decimal != 4 || token.Transaction.Fees != "0" {
+		t.Errorf("token transaction decimal = %d, fees = %s, expected 4 and 0", token.Transaction.Decimal, token.Transaction.Fees)
+	}
+	if token.TxInputs[0].Amount != "80" || !token.TxInputs[0].Coin.IsContract || token.TxOutputs[0].Coin.ContractID != coin.ContractID {
+		t.Errorf("token input = %+v, output = %+v", token.TxInputs[0], token.TxOutputs[0])
+	}
+	if len(token.Transaction.To) != 2 {
+		t.Errorf("token transaction to = %v, expected only token outputs", token.Transaction.To)
+	}
+
+	//无关资产不查询资产信息
+	if calls[otherID] != 0 {
+		t.Errorf("unrelated asset info is queried %d times", calls[otherID])
+	}
+
+	//ExtractTransactionData返回所有资产
+	data, err := wm.Blockscanner.ExtractTransactionData(txid, func(target openwallet.ScanTarget) (string, bool) {
+		return accountID, target.Address == sender
+	})
+	if err != nil || len(data[accountID]) != 2 {
+		t.Errorf("ExtractTransactionData = %d, err = %v, expected ELA and token", len(data[accountID]), err)
+	}
+
+	//资产信息查询失败，交易单提取失败，等待重扫
+	delete(txs, tokenID)
+	wm, node2, _ := newTestTransactionNode(t, txs)
+	defer node2.Close()
+	result = wm.Blockscanner.ExtractTransaction(100, "block", txid, func(address string) (string, bool) {
+		return accountID, address == receiver
+	})
+	if result.Success {
+		t.Errorf("ExtractTransaction should be failed when asset info is unavailable")
+	}
+}
+
+func TestELABlockScanner_ExtractTransactionTypes(t *testing.T) {
+
+	var (
+		lockAddress = "XKUh4GLhFJiqAMTF6HyWQrV9pK9HcGUdfJ"
+		receiver    = "EQZFJqni8nGrbU4gkmP4V9Qmi1BHbnWuEe"
+		prevID      = fmt.Sprintf("%064x", 1)
+		withdrawID  = fmt.Sprintf("%064x", 2)
+		coinbaseID  = fmt.Sprintf("%064x", 3)
+		missingID   = fmt.Sprintf("%064x", 4)
+		accountID   = "account"
+	)
+
+	txs := map[string]interface{}{
+		prevID: map[string]interface{}{
+			"txid": prevID,
+			"type": TxTypeTransferCrossChainAsset,
+			"vout": []map[string]interface{}{
+				{"assetid": elastosTransaction.AssetID_ELA, "value": "10", "n": 0, "address": lockAddress},
+			},
+		},
+		//侧链提现，锁定地址的输出转到主链地址
+		withdrawID: map[string]interface{}{
+			"txid":           withdrawID,
+			"type":           TxTypeWithdrawFromSideChain,
+			"payloadversion": 1,
+			"payload":        map[string]interface{}{"sidechaintransactionhashes": []string{fmt.Sprintf("%064x", 9)}},
+			"blockhash":      "block",
+			"confirmations":  1,
+			"vin":            []map[string]interface{}{{"txid": prevID, "vout": 0}},
+			"vout": []map[string]interface{}{
+				{"assetid": elastosTransaction.AssetID_ELA, "value": "2", "n": 0, "address": receiver},
+				{"assetid": elastosTransaction.AssetID_ELA, "value": "7.9999", "n": 1, "address": lockAddress},
+			},
+		},
+		coinbaseID: map[string]interface{}{
+			"txid":      coinbaseID,
+			"type":      TxTypeCoinBase,
+			"blockhash": "block",
+			"vin":       []map[string]interface{}{{"txid": fmt.Sprintf("%064x", 0), "vout": 65535}},
+			"vout": []map[string]interface{}{
+				{"assetid": elastosTransaction.AssetID_ELA, "value": "1.5", "n": 0, "address": receiver},
+			},
+		},
+		//上一笔交易单无法查询
+		missingID: map[string]interface{}{
+			"txid":      missingID,
+			"type":      TxTypeReturnDepositCoin,
+			"blockhash": "block",
+			"vin":       []map[string]interface{}{{"txid": fmt.Sprintf("%064x", 8), "vout": 0}},
+			"vout": []map[string]interface{}{
+				{"assetid": elastosTransaction.AssetID_ELA, "value": "5000", "n": 0, "address": receiver},
+			},
+		},
+	}
+
+	wm, node, _ := newTestTransactionNode(t, txs)
+	defer node.Close()
+
+	scanAddress := func(address string) (string, bool) {
+		return accountID, address == receiver
+	}
+
+	result := wm.Blockscanner.ExtractTransaction(100, "block", withdrawID, scanAddress)
+	if !result.Success {
+		t.Fatalf("ExtractTransaction of withdraw transaction failed")
+	}
+	data := result.extractData[accountID]
+	if data == nil || len(data.TxInputs) != 0 || len(data.TxOutputs) != 1 || data.TxOutputs[0].Amount != "2" {
+		t.Fatalf("withdraw extract data = %+v, expected 1 output of 2", data)
+	}
+	ext := data.Transaction.GetExtParam()
+	if ext.Get("txType").Int() != int64(TxTypeWithdrawFromSideChain) || ext.Get("txTypeName").String() != "WithdrawFromSideChain" || ext.Get("payloadVersion").Int() != 1 {
+		t.Errorf("withdraw transaction ext param = %s", data.Transaction.ExtParam)
+	}
+	if data.Transaction.Fees != "0.00010000" {
+		t.Errorf("withdraw transaction fees = %s, expected = 0.00010000", data.Transaction.Fees)
+	}
+
+	//coinbase没有输入，手续费为0
+	result = wm.Blockscanner.ExtractTransaction(100, "block", coinbaseID, scanAddress)
+	data = result.extractData[accountID]
+	if !result.Success || data == nil || len(data.TxOutputs) != 1 {
+		t.Fatalf("coinbase extract data = %+v, success = %v", data, result.Success)
+	}
+	if data.Transaction.Fees != "0" || data.Transaction.GetExtParam().Get("txTypeName").String() != "CoinBase" {
+		t.Errorf("coinbase transaction fees = %s, ext param = %s", data.Transaction.Fees, data.Transaction.ExtParam)
+	}
+
+	result = wm.Blockscanner.ExtractTransaction(100, "block", missingID, scanAddress)
+	if result.Success {
+		t.Errorf("ExtractTransaction should be failed when previous transaction is unavailable")
+	}
+
+	if name := txTypeName(0x7f); name != "0x7f" {
+		t.Errorf("txTypeName of unknown type = %s, expected = 0x7f", name)
+	}
+}
+
+func TestELABlockScanner_ExtractMemo(t *testing.T) {
+
+	var (
+		sender    = "ESUQkMEsfUdbmrounnCrNdVHLXrvSzvy7A"
+		receiver  = "EQZFJqni8nGrbU4gkmP4V9Qmi1BHbnWuEe"
+		prevID    = fmt.Sprintf("%064x", 1)
+		txid      = fmt.Sprintf("%064x", 2)
+		accountID = "account"
+	)
+
+	txs := map[string]interface{}{
+		prevID: map[string]interface{}{
+			"txid": prevID,
+			"type": TxTypeTransferAsset,
+			"vout": []map[string]interface{}{
+				{"assetid": elastosTransaction.AssetID_ELA, "value": "1", "n": 0, "address": sender},
+			},
+		},
+		txid: map[string]interface{}{
+			"txid":      txid,
+			"type":      TxTypeTransferAsset,
+			"blockhash": "block",
+			"attributes": []map[string]interface{}{
+				{"usage": 0, "data": "0102"},
+				{"usage": AttributeUsageMemo, "data": hex.EncodeToString([]byte("deposit:10086"))},
+			},
+			"vin": []map[string]interface{}{{"txid": prevID, "vout": 0}},
+			"vout": []map[string]interface{}{
+				{"assetid": elastosTransaction.AssetID_ELA, "value": "0.9999", "n": 0, "address": receiver},
+			},
+		},
+	}
+
+	wm, node, _ := newTestTransactionNode(t, txs)
+	defer node.Close()
+
+	result := wm.Blockscanner.ExtractTransaction(100, "block", txid, func(address string) (string, bool) {
+		return accountID, address == receiver
+	})
+	data := result.extractData[accountID]
+	if !result.Success || data == nil {
+		t.Fatalf("ExtractTransaction failed")
+	}
+	if memo := data.Transaction.GetExtParam().Get("memo").String(); memo != "deposit:10086" {
+		t.Errorf("transaction memo = %s, expected = deposit:10086", memo)
+	}
+}
+
+//testExtractObserver 记录提取结果通知
+type testExtractObserver struct {
+	data map[string][]*openwallet.TxExtractData
+}
+
+func (o *testExtractObserver) BlockScanNotify(header *openwallet.BlockHeader) error {
+	return nil
+}
+
+func (o *testExtractObserver) BlockExtractDataNotify(sourceKey string, data *openwallet.TxExtractData) error {
+	o.data[data.Transaction.TxID] = append(o.data[data.Transaction.TxID], data)
+	return nil
+}
+
+func TestELABlockScanner_ExtractBatch(t *testing.T) {
+
+	var (
+		sender    = "ESUQkMEsfUdbmrounnCrNdVHLXrvSzvy7A"
+		receiver  = "EQZFJqni8nGrbU4gkmP4V9Qmi1BHbnWuEe"
+		prevID    = fmt.Sprintf("%064x", 1)
+		firstID   = fmt.Sprintf("%064x", 2)
+		secondID  = fmt.Sprintf("%064x", 3)
+		thirdID   = fmt.Sprintf("%064x", 4)
+		accountID = "account"
+	)
+
+	newTx := func(txid string, vin []map[string]interface{}, value string) map[string]interface{} {
+		return map[string]interface{}{
+			"txid":          txid,
+			"type":          2,
+			"blockhash":     "block",
+			"confirmations": 1,
+			"vin":           vin,
+			"vout": []map[string]interface{}{
+				{"assetid": elastosTransaction.AssetID_ELA, "value": value, "n": 0, "address": receiver},
+			},
+		}
+	}
+
+	txs := map[string]interface{}{
+		prevID: map[string]interface{}{
+			"txid": prevID,
+			"type": 2,
+			"vout": []map[string]interface{}{
+				{"assetid": elastosTransaction.AssetID_ELA, "value": "3", "n": 0, "address": sender},
+				{"assetid": elastosTransaction.AssetID_ELA, "value": "2", "n": 1, "address": sender},
+			},
+		},
+		//第一、三笔引用区块外的同一笔交易，第二笔引用区块内的第一笔交易
+		firstID:  newTx(firstID, []map[string]interface{}{{"txid": prevID, "vout": 0}}, "2.9999"),
+		secondID: newTx(secondID, []map[string]interface{}{{"txid": firstID, "vout": 0}}, "2.9998"),
+		thirdID:  newTx(thirdID, []map[string]interface{}{{"txid": prevID, "vout": 1}}, "1.9999"),
+	}
+
+	wm, node, calls := newTestTransactionNode(t, txs)
+	defer node.Close()
+
+	observer := &testExtractObserver{data: make(map[string][]*openwallet.TxExtractData)}
+	wm.Blockscanner.AddObserver(observer)
+	wm.Blockscanner.SetBlockScanAddressFunc(func(address string) (string, bool) {
+		return accountID, address == sender || address == receiver
+	})
+
+	err := wm.Blockscanner.BatchExtractTransaction(100, "block", []string{firstID, secondID, thirdID})
+	if err != nil {
+		t.Fatalf("BatchExtractTransaction failed unexpected error: %v", err)
+	}
+
+	//区块内的交易单和引用的交易单各只查询一次
+	for _, txid := range []string{prevID, firstID, secondID, thirdID} {
+		if calls[txid] != 1 {
+			t.Errorf("transaction: %s is queried %d times, expected once", txid, calls[txid])
+		}
+	}
+
+	wantInputs := map[string]string{firstID: "3", secondID: "2.9999", thirdID: "2"}
+	for txid, amount := range wantInputs {
+		data := observer.data[txid]
+		if len(data) != 1 || len(data[0].TxInputs) != 1 {
+			t.Errorf("transaction: %s extract data = %v", txid, data)
+			continue
+		}
+		if data[0].TxInputs[0].Amount != amount || data[0].TxInputs[0].Address == "" {
+			t.Errorf("transaction: %s input = %+v, expected amount = %s", txid, data[0].TxInputs[0], amount)
+		}
+	}
+}
+
+func TestELABlockScanner_ExtractBlockDetails(t *testing.T) {
+
+	var (
+		sender    = "ESUQkMEsfUdbmrounnCrNdVHLXrvSzvy7A"
+		receiver  = "EQZFJqni8nGrbU4gkmP4V9Qmi1BHbnWuEe"
+		prevID    = fmt.Sprintf("%064x", 1)
+		txid      = fmt.Sprintf("%064x", 2)
+		blockHash = fmt.Sprintf("%064x", 100)
+		accountID = "account"
+	)
+
+	prevTx := map[string]interface{}{
+		"txid": prevID,
+		"type": 2,
+		"vout": []map[string]interface{}{
+			{"assetid": elastosTransaction.AssetID_ELA, "value": "3", "n": 0, "address": sender},
+		},
+	}
+	tx := map[string]interface{}{
+		"txid": txid,
+		"type": 2,
+		"vin":  []map[string]interface{}{{"txid": prevID, "vout": 0}},
+		"vout": []map[string]interface{}{
+			{"assetid": elastosTransaction.AssetID_ELA, "value": "2.9999", "n": 0, "address": receiver},
+		},
+	}
+
+	for _, verbose := range []bool{true, false} {
+
+		calls := make(map[string]int)
+		node := newTestNode(t, map[string]testNodeHandler{
+			"getblockhash": func(params gjson.Result) (interface{}, error) {
+				return blockHash, nil
+			},
+			"getblock": func(params gjson.Result) (interface{}, error) {
+				block := map[string]interface{}{"hash": blockHash, "height": 100, "tx": []string{txid}}
+				switch params.Array()[1].Uint() {
+				case BlockVerbosityTransactions:
+					if !verbose {
+						return nil, errors.New("invalid verbosity")
+					}
+					block["tx"] = []interface{}{tx}
+				case BlockVerbosityTxIDs:
+				default:
+					t.Errorf("unexpected getblock params: %s", params.Raw)
+				}
+				return block, nil
+			},
+			"getrawtransaction": func(params gjson.Result) (interface{}, error) {
+				id := params.Array()[0].String()
+				calls[id]++
+				switch id {
+				case prevID:
+					return prevTx, nil
+				case txid:
+					return tx, nil
+				}
+				return nil, errors.New("unknown transaction")
+			},
+		})
+
+		wm := newTestWalletManager(t, node.URL)
+		observer := &testExtractObserver{data: make(map[string][]*openwallet.TxExtractData)}
+		wm.Blockscanner.AddObserver(observer)
+		wm.Blockscanner.SetBlockScanAddressFunc(func(address string) (string, bool) {
+			return accountID, address == sender
+		})
+
+		block, err := wm.Blockscanner.scanBlock(100)
+		node.Close()
+		if err != nil {
+			t.Fatalf("verbose: %v, scanBlock failed unexpected error: %v", verbose, err)
+		}
+
+		if verbose && (len(block.txDetails) != 1 || block.txDetails[0].BlockHeight != 100 || block.txDetails[0].BlockHash != blockHash) {
+			t.Errorf("block transaction details = %+v", block.txDetails)
+		}
+
+		//区块包含交易详情时，只查询输入引用的交易单
+		wantCalls := 1
+		if verbose {
+			wantCalls = 0
+		}
+		if calls[txid] != wantCalls || calls[prevID] != 1 {
+			t.Errorf("verbose: %v, transaction queried = %d, previous transaction queried = %d", verbose, calls[txid], calls[prevID])
+		}
+
+		data := observer.data[txid]
+		if len(data) != 1 || len(data[0].TxInputs) != 1 || data[0].TxInputs[0].Amount != "3" || data[0].Transaction.BlockHeight != 100 {
+			t.Errorf("verbose: %v, extract data = %+v", verbose, data)
+		}
+	}
+}
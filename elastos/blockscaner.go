@@ -24,6 +24,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/blocktree/go-owcdrivers/elastosTransaction"
 	"github.com/blocktree/openwallet/common"
 	"github.com/blocktree/openwallet/openwallet"
 	gosocketio "github.com/graarh/golang-socketio"
@@ -47,6 +48,8 @@ type ELABlockScanner struct {
 	socketIO             *gosocketio.Client //socketIO客户端
 	setupSocketIOOnce    sync.Once
 	stopSocketIO         chan struct{}
+	client               *Client //本轮扫描固定使用的节点
+	clientMu             sync.RWMutex
 
 	//用于实现浏览器
 	IsSkipFailedBlock bool //是否跳过失败区块
@@ -56,7 +59,7 @@ type ELABlockScanner struct {
 //ExtractResult 扫描完成的提取结果
 type ExtractResult struct {
 	extractData     map[string]*openwallet.TxExtractData
-	extractOmniData map[string]*openwallet.TxExtractData //代币交易
+	extractOmniData map[string]map[string]*openwallet.TxExtractData //代币交易，资产ID -> 账户 -> 提取数据
 	TxID            string
 	BlockHeight     uint64
 	Success         bool
@@ -117,6 +120,15 @@ func (bs *ELABlockScanner) ScanBlockTask() {
 	currentHeight := blockHeader.Height
 	currentHash := blockHeader.Hash
 
+	//本轮扫描固定使用区块高度最高的节点，避免不同节点的分叉数据混在一起
+	client, err := bs.wm.WalletClient.Pin()
+	if err != nil {
+		bs.wm.Log.Std.Info("block scanner can not select node; unexpected error: %v", err)
+		return
+	}
+	bs.setNodeClient(client)
+	defer bs.setNodeClient(nil)
+
 	for {
 
 		if !bs.Scanning {
@@ -125,7 +137,7 @@ func (bs *ELABlockScanner) ScanBlockTask() {
 		}
 
 		//获取最大高度
-		maxHeight, err := bs.wm.GetBlockHeight()
+		maxHeight, err := bs.nodeClient().getBlockHeight()
 		if err != nil {
 			//下一个高度找不到会报异常
 			bs.wm.Log.Std.Info("block scanner can not get rpc-server block height; unexpected error: %v", err)
@@ -143,14 +155,14 @@ func (bs *ELABlockScanner) ScanBlockTask() {
 
 		bs.wm.Log.Std.Info("block scanner scanning height: %d ...", currentHeight)
 
-		hash, err := bs.wm.GetBlockHash(currentHeight)
+		hash, err := bs.nodeClient().getBlockHash(currentHeight)
 		if err != nil {
 			//下一个高度找不到会报异常
 			bs.wm.Log.Std.Info("block scanner can not get new block hash; unexpected error: %v", err)
 			break
 		}
 
-		block, err := bs.wm.GetBlock(hash)
+		block, err := bs.nodeClient().getBlockWithTransactions(hash)
 		if err != nil {
 			bs.wm.Log.Std.Info("block scanner can not get new block data; unexpected error: %v", err)
 
@@ -191,13 +203,13 @@ func (bs *ELABlockScanner) ScanBlockTask() {
 				//查找core钱包的RPC
 				bs.wm.Log.Info("block scanner prev block height:", currentHeight)
 
-				prevHash, err := bs.wm.GetBlockHash(currentHeight)
+				prevHash, err := bs.nodeClient().getBlockHash(currentHeight)
 				if err != nil {
 					bs.wm.Log.Std.Error("block scanner can not get prev block; unexpected error: %v", err)
 					break
 				}
 
-				localBlock, err = bs.wm.GetBlock(prevHash)
+				localBlock, err = bs.nodeClient().getBlock(prevHash)
 				if err != nil {
 					bs.wm.Log.Std.Error("block scanner can not get prev block; unexpected error: %v", err)
 					break
@@ -223,7 +235,7 @@ func (bs *ELABlockScanner) ScanBlockTask() {
 
 		} else {
 
-			err = bs.BatchExtractTransaction(block.Height, block.Hash, block.tx)
+			err = bs.extractBlockTransaction(block)
 			if err != nil {
 				bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
 			}
@@ -274,14 +286,14 @@ func (bs *ELABlockScanner) ScanBlock(height uint64) error {
 
 func (bs *ELABlockScanner) scanBlock(height uint64) (*Block, error) {
 
-	hash, err := bs.wm.GetBlockHash(height)
+	hash, err := bs.nodeClient().getBlockHash(height)
 	if err != nil {
 		//下一个高度找不到会报异常
 		bs.wm.Log.Std.Info("block scanner can not get new block hash; unexpected error: %v", err)
 		return nil, err
 	}
 
-	block, err := bs.wm.GetBlock(hash)
+	block, err := bs.nodeClient().getBlockWithTransactions(hash)
 	if err != nil {
 		bs.wm.Log.Std.Info("block scanner can not get new block data; unexpected error: %v", err)
 
@@ -294,7 +306,7 @@ func (bs *ELABlockScanner) scanBlock(height uint64) (*Block, error) {
 
 	bs.wm.Log.Std.Info("block scanner scanning height: %d ...", block.Height)
 
-	err = bs.BatchExtractTransaction(block.Height, block.Hash, block.tx)
+	err = bs.extractBlockTransaction(block)
 	if err != nil {
 		bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
 	}
@@ -311,7 +323,7 @@ func (bs *ELABlockScanner) ScanTxMemPool() {
 	bs.wm.Log.Std.Info("block scanner scanning mempool ...")
 
 	//提取未确认的交易单
-	txIDsInMemPool, err := bs.wm.GetTxIDsInMemPool()
+	txIDsInMemPool, err := bs.nodeClient().getTxIDsInMemPool()
 	if err != nil {
 		bs.wm.Log.Std.Info("block scanner can not get mempool data; unexpected error: %v", err)
 		return
@@ -361,29 +373,35 @@ func (bs *ELABlockScanner) RescanFailedRecord() {
 			continue
 		}
 
-		var hash string
+		var (
+			hash  string
+			block *Block
+		)
 
 		bs.wm.Log.Std.Info("block scanner rescanning height: %d ...", height)
 
 		if len(txs) == 0 {
 
-			hash, err := bs.wm.GetBlockHash(height)
+			hash, err = bs.nodeClient().getBlockHash(height)
 			if err != nil {
 				//下一个高度找不到会报异常
 				bs.wm.Log.Std.Info("block scanner can not get new block hash; unexpected error: %v", err)
 				continue
 			}
 
-			block, err := bs.wm.GetBlock(hash)
+			block, err = bs.nodeClient().getBlockWithTransactions(hash)
 			if err != nil {
 				bs.wm.Log.Std.Info("block scanner can not get new block data; unexpected error: %v", err)
 				continue
 			}
+		}
 
-			txs = block.tx
+		if block != nil {
+			err = bs.extractBlockTransaction(block)
+		} else {
+			err = bs.BatchExtractTransaction(height, hash, txs)
 		}
 
-		err = bs.BatchExtractTransaction(height, hash, txs)
 		if err != nil {
 			bs.wm.Log.Std.Info("block scanner can not extractRechargeRecords; unexpected error: %v", err)
 			continue
@@ -397,6 +415,23 @@ func (bs *ELABlockScanner) RescanFailedRecord() {
 	bs.wm.Blockscanner.DeleteUnscanRecordNotFindTX()
 }
 
+//setNodeClient 设置本轮扫描固定使用的节点，nil为不固定
+func (bs *ELABlockScanner) setNodeClient(client *Client) {
+	bs.clientMu.Lock()
+	defer bs.clientMu.Unlock()
+	bs.client = client
+}
+
+//nodeClient 扫描使用的节点客户端，没有固定节点时使用钱包的客户端
+func (bs *ELABlockScanner) nodeClient() *Client {
+	bs.clientMu.RLock()
+	defer bs.clientMu.RUnlock()
+	if bs.client != nil {
+		return bs.client
+	}
+	return bs.wm.WalletClient
+}
+
 //newBlockNotify 获得新区块后，通知给观测者
 func (bs *ELABlockScanner) newBlockNotify(block *Block, isFork bool) {
 	header := block.BlockHeader(bs.wm.Symbol())
@@ -404,20 +439,43 @@ func (bs *ELABlockScanner) newBlockNotify(block *Block, isFork bool) {
 	bs.NewBlockNotify(header)
 }
 
+//extractBlockTransaction 提取区块的交易单，区块包含所有交易详情时直接提取，否则逐个获取交易单
+func (bs *ELABlockScanner) extractBlockTransaction(block *Block) error {
+
+	if len(block.tx) == 0 || len(block.txDetails) != len(block.tx) {
+		return bs.BatchExtractTransaction(block.Height, block.Hash, block.tx)
+	}
+
+	return bs.batchExtractTransaction(block.Height, block.Hash, block.tx, block.txDetails, make([]error, len(block.tx)))
+}
+
 //BatchExtractTransaction 批量提取交易单
 //bitcoin 1M的区块链可以容纳3000笔交易，批量多线程处理，速度更快
 func (bs *ELABlockScanner) BatchExtractTransaction(blockHeight uint64, blockHash string, txs []string) error {
 
+	if len(txs) == 0 {
+		return errors.New("BatchExtractTransaction block is nil.")
+	}
+
+	//批量获取交易单，减少请求次数
+	trxs, errs := bs.nodeClient().getTransactions(txs)
+
+	return bs.batchExtractTransaction(blockHeight, blockHash, txs, trxs, errs)
+}
+
+//batchExtractTransaction 多线程提取已获取的交易单，trxs、errs与txs一一对应，errs为获取交易单的错误
+func (bs *ELABlockScanner) batchExtractTransaction(blockHeight uint64, blockHash string, txs []string, trxs []*Transaction, errs []error) error {
+
 	var (
 		quit       = make(chan struct{})
 		done       = 0 //完成标记
 		failed     = 0
 		shouldDone = len(txs) //需要完成的总数
+		spent      = make([]string, 0)
 	)
 
-	if len(txs) == 0 {
-		return errors.New("BatchExtractTransaction block is nil.")
-	}
+	//批量获取输入引用的交易单，减少请求次数
+	bs.fillTxInputs(trxs)
 
 	//生产通道
 	producer := make(chan ExtractResult)
@@ -434,6 +492,11 @@ func (bs *ELABlockScanner) BatchExtractTransaction(blockHeight uint64, blockHash
 
 			if gets.Success {
 
+				spent = append(spent, spentUnspentKeys(gets.extractData)...)
+				for _, omniData := range gets.extractOmniData {
+					spent = append(spent, spentUnspentKeys(omniData)...)
+				}
+
 				notifyErr := bs.newExtractDataNotify(height, gets.extractData)
 				//saveErr := bs.SaveRechargeToWalletDB(height, gets.Recharges)
 				if notifyErr != nil {
@@ -441,11 +504,12 @@ func (bs *ELABlockScanner) BatchExtractTransaction(blockHeight uint64, blockHash
 					bs.wm.Log.Std.Info("newExtractDataNotify unexpected error: %v", notifyErr)
 				}
 
-				notifyErr = nil
-				notifyErr = bs.newExtractDataNotify(height, gets.extractOmniData)
-				if notifyErr != nil {
-					failed++ //标记保存失败数
-					bs.wm.Log.Std.Info("newExtractDataNotify unexpected error: %v", notifyErr)
+				for _, omniData := range gets.extractOmniData {
+					notifyErr = bs.newExtractDataNotify(height, omniData)
+					if notifyErr != nil {
+						failed++ //标记保存失败数
+						bs.wm.Log.Std.Info("newExtractDataNotify unexpected error: %v", notifyErr)
+					}
 				}
 
 			} else {
@@ -466,17 +530,17 @@ func (bs *ELABlockScanner) BatchExtractTransaction(blockHeight uint64, blockHash
 
 	//提取工作
 	extractWork := func(eblockHeight uint64, eBlockHash string, mTxs []string, eProducer chan ExtractResult) {
-		for _, txid := range mTxs {
+		for i, txid := range mTxs {
 			bs.extractingCH <- struct{}{}
 			//shouldDone++
-			go func(mBlockHeight uint64, mTxid string, end chan struct{}, mProducer chan<- ExtractResult) {
+			go func(mBlockHeight uint64, mTxid string, mTrx *Transaction, mErr error, end chan struct{}, mProducer chan<- ExtractResult) {
 
 				//导出提出的交易
-				mProducer <- bs.ExtractTransaction(mBlockHeight, eBlockHash, mTxid, bs.ScanAddressFunc)
+				mProducer <- bs.extractFetchedTransaction(mBlockHeight, eBlockHash, mTxid, mTrx, mErr, bs.ScanAddressFunc)
 				//释放
 				<-end
 
-			}(eblockHeight, txid, bs.extractingCH, eProducer)
+			}(eblockHeight, txid, trxs[i], errs[i], bs.extractingCH, eProducer)
 		}
 	}
 
@@ -491,6 +555,13 @@ func (bs *ELABlockScanner) BatchExtractTransaction(blockHeight uint64, blockHash
 	//以下使用生产消费模式
 	bs.extractRuntime(producer, worker, quit)
 
+	//区块中已被花费的utxo解除锁定，每个区块只打开一次锁定表
+	if len(spent) > 0 {
+		if err := bs.wm.UnlockUnspentsByKey(spent...); err != nil {
+			bs.wm.Log.Std.Error("block scanner can not unlock spent utxo; unexpected error: %v", err)
+		}
+	}
+
 	if failed > 0 {
 		return fmt.Errorf("block scanner saveWork failed")
 	} else {
@@ -536,18 +607,24 @@ func (bs *ELABlockScanner) extractRuntime(producer chan ExtractResult, worker ch
 //ExtractTransaction 提取交易单
 func (bs *ELABlockScanner) ExtractTransaction(blockHeight uint64, blockHash string, txid string, scanAddressFunc openwallet.BlockScanAddressFunc) ExtractResult {
 
+	//获取bitcoin的交易单
+	trx, err := bs.nodeClient().getTransaction(txid)
+
+	return bs.extractFetchedTransaction(blockHeight, blockHash, txid, trx, err, scanAddressFunc)
+}
+
+//extractFetchedTransaction 提取已获取的交易单，err为获取交易单的错误
+func (bs *ELABlockScanner) extractFetchedTransaction(blockHeight uint64, blockHash string, txid string, trx *Transaction, err error, scanAddressFunc openwallet.BlockScanAddressFunc) ExtractResult {
+
 	var (
 		result = ExtractResult{
 			BlockHeight:     blockHeight,
 			TxID:            txid,
 			extractData:     make(map[string]*openwallet.TxExtractData),
-			extractOmniData: make(map[string]*openwallet.TxExtractData),
+			extractOmniData: make(map[string]map[string]*openwallet.TxExtractData),
 		}
 	)
 
-	//获取bitcoin的交易单
-	trx, err := bs.wm.GetTransaction(txid)
-
 	if err != nil {
 		bs.wm.Log.Std.Info("block scanner can not extract transaction data; unexpected error: %v", err)
 		result.Success = false
@@ -566,6 +643,62 @@ func (bs *ELABlockScanner) ExtractTransaction(blockHeight uint64, blockHash stri
 
 }
 
+//fillTxInputs 批量查询交易单输入引用的交易单，填充输入缺少的地址和金额。
+//引用同一批次中的交易单时不再查询，查询失败的输入由extractTransaction逐个查询。
+func (bs *ELABlockScanner) fillTxInputs(trxs []*Transaction) {
+
+	var (
+		known   = make(map[string]*Transaction)
+		missing = make([]string, 0)
+	)
+
+	for _, trx := range trxs {
+		if trx != nil {
+			known[trx.TxID] = trx
+		}
+	}
+
+	for _, trx := range trxs {
+		if trx == nil {
+			continue
+		}
+		for _, input := range trx.Vins {
+			if len(input.Coinbase) > 0 || len(input.Addr) > 0 {
+				continue
+			}
+			if _, exist := known[input.TxID]; !exist {
+				known[input.TxID] = nil
+				missing = append(missing, input.TxID)
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		prevTxs, _ := bs.nodeClient().getTransactions(missing)
+		for i, prevTx := range prevTxs {
+			known[missing[i]] = prevTx
+		}
+	}
+
+	for _, trx := range trxs {
+		if trx == nil {
+			continue
+		}
+		for _, input := range trx.Vins {
+			if len(input.Coinbase) > 0 || len(input.Addr) > 0 {
+				continue
+			}
+			prevTx := known[input.TxID]
+			if prevTx != nil && len(prevTx.Vouts) > int(input.Vout) {
+				prevOut := prevTx.Vouts[input.Vout]
+				input.Addr = prevOut.Addr
+				input.Value = prevOut.Value
+				input.AssetID = prevOut.AssetID
+			}
+		}
+	}
+}
+
 //ExtractTransactionData 提取交易单
 func (bs *ELABlockScanner) extractTransaction(trx *Transaction, result *ExtractResult, scanAddressFunc openwallet.BlockScanAddressFunc) {
 
@@ -577,86 +710,189 @@ func (bs *ELABlockScanner) extractTransaction(trx *Transaction, result *ExtractR
 		//记录哪个区块哪个交易单没有完成扫描
 		success = false
 	} else {
-		if trx.Type == 0 || trx.Type == 2 {
-			vin := trx.Vins
-			blocktime := trx.Blocktime
+		//所有类型的交易单都可能转移资产，例如侧链提现、抵押退还等，按输入输出提取
+		vin := trx.Vins
 
-			//检查交易单输入信息是否完整，不完整查上一笔交易单的输出填充数据
-			for _, input := range vin {
+		//检查交易单输入信息是否完整，不完整查上一笔交易单的输出填充数据
+		for _, input := range vin {
 
-				if len(input.Coinbase) > 0 {
-					//coinbase skip
-					success = true
-					break
-				}
+			if len(input.Coinbase) > 0 {
+				//coinbase skip
+				break
+			}
 
-				//如果input中没有地址，需要查上一笔交易的output提取
-				if len(input.Addr) == 0 {
-
-					intxid := input.TxID
-					vout := input.Vout
-
-					preTx, err := bs.wm.GetTransaction(intxid)
-					if err != nil {
-						success = false
-						break
-					} else {
-						preVouts := preTx.Vouts
-						if len(preVouts) > int(vout) {
-							preOut := preVouts[vout]
-							input.Addr = preOut.Addr
-							input.Value = preOut.Value
-							success = true
-						}
-					}
+			//如果input中没有地址，需要查上一笔交易的output提取
+			if len(input.Addr) == 0 {
 
+				intxid := input.TxID
+				vout := input.Vout
+
+				preTx, err := bs.nodeClient().getTransaction(intxid)
+				if err != nil {
+					bs.wm.Log.Std.Info("block scanner can not get previous transaction: %s of transaction: %s; unexpected error: %v", intxid, trx.TxID, err)
+					success = false
+					break
 				}
 
+				preVouts := preTx.Vouts
+				if len(preVouts) > int(vout) {
+					preOut := preVouts[vout]
+					input.Addr = preOut.Addr
+					input.Value = preOut.Value
+					input.AssetID = preOut.AssetID
+				}
 			}
+		}
 
-			if success {
-
-				//提取出账部分记录
-				from, totalSpent := bs.extractTxInput(trx, result, scanAddressFunc)
-
-				//提取入账部分记录
-				to, totalReceived := bs.extractTxOutput(trx, result, scanAddressFunc)
-
-				for _, extractData := range result.extractData {
-					tx := &openwallet.Transaction{
-						From: from,
-						To:   to,
-						Fees: totalSpent.Sub(totalReceived).StringFixed(bs.wm.Decimal()),
-						Coin: openwallet.Coin{
-							Symbol:     bs.wm.Symbol(),
-							IsContract: false,
-						},
-						BlockHash:   trx.BlockHash,
-						BlockHeight: trx.BlockHeight,
-						TxID:        trx.TxID,
-						Decimal:     bs.wm.Decimal(),
-						ConfirmTime: blocktime,
-						Status:      openwallet.TxStatusSuccess,
-					}
-					wxID := openwallet.GenTransactionWxID(tx)
-					tx.WxID = wxID
-					extractData.Transaction = tx
-				}
+		if success {
 
+			//按资产分别提取，ELA记录到extractData，其他资产记录到extractOmniData
+			for _, assetID := range transactionAssetIDs(trx) {
+				if err := bs.extractAssetTransaction(trx, assetID, result, scanAddressFunc); err != nil {
+					bs.wm.Log.Std.Info("block scanner can not extract asset: %s of transaction: %s; unexpected error: %v", assetID, trx.TxID, err)
+					success = false
+					break
+				}
 			}
+		}
+	}
+
+	result.Success = success
+}
 
-			success = true
+//extractAssetTransaction 提取交易单中一种资产的出入账记录，ELA的手续费为ELA输入总额减去输出总额
+func (bs *ELABlockScanner) extractAssetTransaction(trx *Transaction, assetID string, result *ExtractResult, scanAddressFunc openwallet.BlockScanAddressFunc) error {
 
-		} else {
-			success = true
+	var (
+		isELA       = assetID == elastosTransaction.AssetID_ELA
+		extractData = make(map[string]*openwallet.TxExtractData)
+		coin        = openwallet.Coin{Symbol: bs.wm.Symbol(), IsContract: false}
+		decimals    = bs.wm.Decimal()
+	)
+
+	//与扫描地址无关的代币不查询资产信息，也不提取
+	if !isELA && !bs.isAssetRelated(trx, assetID, scanAddressFunc) {
+		return nil
+	}
+
+	if isELA {
+		extractData = result.extractData
+	} else {
+		contract, err := bs.wm.GetAssetContract(assetID)
+		if err != nil {
+			return err
 		}
+		coin = openwallet.Coin{
+			Symbol:     bs.wm.Symbol(),
+			IsContract: true,
+			ContractID: contract.ContractID,
+			Contract:   *contract,
+		}
+		decimals = int32(contract.Decimals)
 	}
 
-	result.Success = success
+	//提取出账部分记录
+	from, totalSpent := bs.extractTxInput(trx, assetID, coin, extractData, scanAddressFunc)
+
+	//提取入账部分记录
+	to, totalReceived := bs.extractTxOutput(trx, assetID, coin, extractData, scanAddressFunc)
+
+	//coinbase等没有输入的交易单不计算手续费
+	fees := "0"
+	if isELA && totalSpent.IsPositive() {
+		fees = totalSpent.Sub(totalReceived).StringFixed(bs.wm.Decimal())
+	}
+
+	for _, ed := range extractData {
+		tx := &openwallet.Transaction{
+			From:        from,
+			To:          to,
+			Fees:        fees,
+			Coin:        coin,
+			BlockHash:   trx.BlockHash,
+			BlockHeight: trx.BlockHeight,
+			TxID:        trx.TxID,
+			Decimal:     decimals,
+			ConfirmTime: trx.Blocktime,
+			Status:      openwallet.TxStatusSuccess,
+		}
+		//记录Elastos的交易类型
+		tx.SetExtParam("txType", trx.Type)
+		tx.SetExtParam("txTypeName", txTypeName(trx.Type))
+		tx.SetExtParam("payloadVersion", trx.PayloadVersion)
+		if len(trx.Memo) > 0 {
+			tx.SetExtParam("memo", trx.Memo)
+		}
+		wxID := openwallet.GenTransactionWxID(tx)
+		tx.WxID = wxID
+		ed.Transaction = tx
+	}
+
+	if !isELA && len(extractData) > 0 {
+		result.extractOmniData[assetID] = extractData
+	}
+
+	return nil
+}
+
+//isAssetRelated 交易单中该资产的输入或输出是否包含扫描地址
+func (bs *ELABlockScanner) isAssetRelated(trx *Transaction, assetID string, scanAddressFunc openwallet.BlockScanAddressFunc) bool {
+	for _, input := range trx.Vins {
+		if vinAssetID(input) != assetID {
+			continue
+		}
+		if _, ok := scanAddressFunc(input.Addr); ok {
+			return true
+		}
+	}
+	for _, output := range trx.Vouts {
+		if voutAssetID(output) != assetID {
+			continue
+		}
+		if _, ok := scanAddressFunc(output.Addr); ok {
+			return true
+		}
+	}
+	return false
+}
+
+//transactionAssetIDs 交易单输入输出包含的资产，ELA排在最前
+func transactionAssetIDs(trx *Transaction) []string {
+	assetIDs := []string{elastosTransaction.AssetID_ELA}
+	exist := map[string]bool{elastosTransaction.AssetID_ELA: true}
+	add := func(assetID string) {
+		if !exist[assetID] {
+			exist[assetID] = true
+			assetIDs = append(assetIDs, assetID)
+		}
+	}
+	for _, input := range trx.Vins {
+		add(vinAssetID(input))
+	}
+	for _, output := range trx.Vouts {
+		add(voutAssetID(output))
+	}
+	return assetIDs
 }
 
-//ExtractTxInput 提取交易单输入部分
-func (bs *ELABlockScanner) extractTxInput(trx *Transaction, result *ExtractResult, scanAddressFunc openwallet.BlockScanAddressFunc) ([]string, decimal.Decimal) {
+//vinAssetID 输入的资产ID，没有记录时为ELA
+func vinAssetID(input *Vin) string {
+	if len(input.AssetID) == 0 {
+		return elastosTransaction.AssetID_ELA
+	}
+	return input.AssetID
+}
+
+//voutAssetID 输出的资产ID，没有记录时为ELA
+func voutAssetID(output *Vout) string {
+	if len(output.AssetID) == 0 {
+		return elastosTransaction.AssetID_ELA
+	}
+	return output.AssetID
+}
+
+//ExtractTxInput 提取交易单输入部分，只提取assetID的资产
+func (bs *ELABlockScanner) extractTxInput(trx *Transaction, assetID string, coin openwallet.Coin, extractData map[string]*openwallet.TxExtractData, scanAddressFunc openwallet.BlockScanAddressFunc) ([]string, decimal.Decimal) {
 	var (
 		from        = make([]string, 0)
 		totalAmount = decimal.Zero
@@ -665,6 +901,10 @@ func (bs *ELABlockScanner) extractTxInput(trx *Transaction, result *ExtractResul
 	createAt := time.Now().Unix()
 	for i, output := range trx.Vins {
 
+		if vinAssetID(output) != assetID {
+			continue
+		}
+
 		txid := output.TxID
 		vout := output.Vout
 
@@ -675,16 +915,13 @@ func (bs *ELABlockScanner) extractTxInput(trx *Transaction, result *ExtractResul
 			input := openwallet.TxInput{}
 			input.SourceTxID = txid
 			input.SourceIndex = vout
-			input.TxID = result.TxID
+			input.TxID = trx.TxID
 			input.Address = addr
 			//transaction.AccountID = a.AccountID
 			input.Amount = amount
-			input.Coin = openwallet.Coin{
-				Symbol:     bs.wm.Symbol(),
-				IsContract: false,
-			}
+			input.Coin = coin
 			input.Index = output.N
-			input.Sid = openwallet.GenTxInputSID(txid, bs.wm.Symbol(), "", uint64(i))
+			input.Sid = openwallet.GenTxInputSID(txid, bs.wm.Symbol(), coin.ContractID, uint64(i))
 			//input.Sid = base64.StdEncoding.EncodeToString(crypto.SHA1([]byte(fmt.Sprintf("input_%s_%d_%s", result.TxID, i, addr))))
 			input.CreateAt = createAt
 			//在哪个区块高度时消费
@@ -693,14 +930,13 @@ func (bs *ELABlockScanner) extractTxInput(trx *Transaction, result *ExtractResul
 
 			//transactions = append(transactions, &transaction)
 
-			ed := result.extractData[sourceKey]
+			ed := extractData[sourceKey]
 			if ed == nil {
 				ed = openwallet.NewBlockExtractData()
-				result.extractData[sourceKey] = ed
+				extractData[sourceKey] = ed
 			}
 
 			ed.TxInputs = append(ed.TxInputs, &input)
-
 		}
 
 		from = append(from, addr+":"+amount)
@@ -708,11 +944,23 @@ func (bs *ELABlockScanner) extractTxInput(trx *Transaction, result *ExtractResul
 		totalAmount = totalAmount.Add(dAmount)
 
 	}
+
 	return from, totalAmount
 }
 
-//ExtractTxInput 提取交易单输入部分
-func (bs *ELABlockScanner) extractTxOutput(trx *Transaction, result *ExtractResult, scanAddressFunc openwallet.BlockScanAddressFunc) ([]string, decimal.Decimal) {
+//spentUnspentKeys 提取记录中扫描地址花费的utxo，key为txid_vout
+func spentUnspentKeys(extractData map[string]*openwallet.TxExtractData) []string {
+	keys := make([]string, 0)
+	for _, ed := range extractData {
+		for _, input := range ed.TxInputs {
+			keys = append(keys, unspentKey(input.SourceTxID, input.SourceIndex))
+		}
+	}
+	return keys
+}
+
+//ExtractTxInput 提取交易单输出部分，只提取assetID的资产
+func (bs *ELABlockScanner) extractTxOutput(trx *Transaction, assetID string, coin openwallet.Coin, extractData map[string]*openwallet.TxExtractData, scanAddressFunc openwallet.BlockScanAddressFunc) ([]string, decimal.Decimal) {
 
 	var (
 		to          = make([]string, 0)
@@ -726,6 +974,10 @@ func (bs *ELABlockScanner) extractTxOutput(trx *Transaction, result *ExtractResu
 	createAt := time.Now().Unix()
 	for _, output := range vout {
 
+		if voutAssetID(output) != assetID {
+			continue
+		}
+
 		amount := output.Value
 		n := output.N
 		addr := output.Addr
@@ -742,12 +994,9 @@ func (bs *ELABlockScanner) extractTxOutput(trx *Transaction, result *ExtractResu
 			outPut.Address = addr
 			//transaction.AccountID = a.AccountID
 			outPut.Amount = amount
-			outPut.Coin = openwallet.Coin{
-				Symbol:     bs.wm.Symbol(),
-				IsContract: false,
-			}
+			outPut.Coin = coin
 			outPut.Index = n
-			outPut.Sid = openwallet.GenTxOutPutSID(txid, bs.wm.Symbol(), "", n)
+			outPut.Sid = openwallet.GenTxOutPutSID(txid, bs.wm.Symbol(), coin.ContractID, n)
 			//outPut.Sid = base64.StdEncoding.EncodeToString(crypto.SHA1([]byte(fmt.Sprintf("output_%s_%d_%s", txid, n, addr))))
 
 			//保存utxo到扩展字段
@@ -759,10 +1008,10 @@ func (bs *ELABlockScanner) extractTxOutput(trx *Transaction, result *ExtractResu
 
 			//transactions = append(transactions, &transaction)
 
-			ed := result.extractData[sourceKey]
+			ed := extractData[sourceKey]
 			if ed == nil {
 				ed = openwallet.NewBlockExtractData()
-				result.extractData[sourceKey] = ed
+				extractData[sourceKey] = ed
 			}
 
 			ed.TxOutputs = append(ed.TxOutputs, &outPut)
@@ -917,6 +1166,12 @@ func (bs *ELABlockScanner) ExtractTransactionData(txid string, scanTargetFunc op
 		txs = append(txs, data)
 		extData[key] = txs
 	}
+	//代币交易
+	for _, omniData := range result.extractOmniData {
+		for key, data := range omniData {
+			extData[key] = append(extData[key], data)
+		}
+	}
 	return extData, nil
 }
 
@@ -991,8 +1246,13 @@ func (bs *ELABlockScanner) GetBalanceByAddress(address ...string) ([]*openwallet
 
 //getBalanceByExplorer 获取地址余额
 func (wm *WalletManager) getBalanceCalUnspent(address ...string) ([]*openwallet.Balance, error) {
+	return wm.getAssetBalanceCalUnspent(elastosTransaction.AssetID_ELA, address...)
+}
+
+//getAssetBalanceCalUnspent 通过未花计算地址指定资产的余额
+func (wm *WalletManager) getAssetBalanceCalUnspent(assetID string, address ...string) ([]*openwallet.Balance, error) {
 
-	utxos, err := wm.ListUnspent(0, address...)
+	utxos, err := wm.ListAssetUnspent(assetID, 0, address...)
 	if err != nil {
 		return nil, err
 	}
@@ -1020,6 +1280,39 @@ func (wm *WalletManager) getBalanceCalUnspent(address ...string) ([]*openwallet.
 	return addrBalanceArr, nil
 }
 
+//GetLockedBalance 查询地址被锁定的ELA余额
+func (wm *WalletManager) GetLockedBalance(address ...string) ([]*LockedBalance, error) {
+	return wm.getAssetLockedBalance(elastosTransaction.AssetID_ELA, address...)
+}
+
+//getAssetLockedBalance 通过未花计算地址指定资产被锁定的余额
+func (wm *WalletManager) getAssetLockedBalance(assetID string, address ...string) ([]*LockedBalance, error) {
+
+	utxos, err := wm.ListAssetUnspent(assetID, 0, address...)
+	if err != nil {
+		return nil, err
+	}
+
+	locked := make(map[string]decimal.Decimal)
+	for _, utxo := range utxos {
+		if utxo.Locked {
+			amount, _ := decimal.NewFromString(utxo.Amount)
+			locked[utxo.Address] = locked[utxo.Address].Add(amount)
+		}
+	}
+
+	balances := make([]*LockedBalance, 0, len(address))
+	for _, a := range address {
+		balances = append(balances, &LockedBalance{
+			Symbol:  wm.Symbol(),
+			Address: a,
+			Balance: locked[a].StringFixed(wm.Decimal()),
+		})
+	}
+
+	return balances, nil
+}
+
 //calculateUnspentByExplorer 通过未花计算余额
 func (wm *WalletManager) calculateUnspent(utxos []*Unspent) map[string]*openwallet.Balance {
 
@@ -1087,9 +1380,10 @@ func (bs *ELABlockScanner) GetTransactionsByAddress(offset, limit int, coin open
 	for _, tx := range trxs {
 
 		result := ExtractResult{
-			BlockHeight: tx.BlockHeight,
-			TxID:        tx.TxID,
-			extractData: make(map[string]*openwallet.TxExtractData),
+			BlockHeight:     tx.BlockHeight,
+			TxID:            tx.TxID,
+			extractData:     make(map[string]*openwallet.TxExtractData),
+			extractOmniData: make(map[string]map[string]*openwallet.TxExtractData),
 		}
 
 		bs.extractTransaction(tx, &result, scanAddressFunc)
@@ -0,0 +1,433 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package elastos
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	//选币策略名称
+	CoinSelectionSmallestFirst  = "smallestFirst"
+	CoinSelectionLargestFirst   = "largestFirst"
+	CoinSelectionBranchAndBound = "branchAndBound"
+	CoinSelectionRandomImprove  = "randomImprove"
+	CoinSelectionSingleAddress  = "singleAddress"
+
+	//branchAndBound默认的最大搜索次数
+	DefaultBranchAndBoundTries = 100000
+)
+
+//CoinSelectionTarget 选币目标。
+//手续费按签名后的交易单长度计算，长度由选币前算好的基础长度加上输入、解锁脚本及找零输出的长度，选币时不需要序列化交易单
+type CoinSelectionTarget struct {
+	Amount      decimal.Decimal //发送总额，不含手续费
+	MaxInputs   int             //单笔交易的输入上限，超过时由交易单解析器先归集
+	FeeRate     decimal.Decimal //每KB的费率，为0时手续费为MinFees
+	MinFees     decimal.Decimal //手续费下限
+	Decimals    int32           //手续费的小数位数，不足的部分向上取整
+	BaseSize    int64           //没有输入及找零输出的交易单长度，输入及解锁脚本的数量按1字节计算
+	InputSize   int64           //一个输入的长度
+	ProgramSize int64           //一个输入地址的解锁脚本长度，同一地址的输入共用解锁脚本
+	ChangeSize  int64           //找零输出的长度
+	Fixed       []*Unspent      //交易单必须包含的其他输入，只计入手续费，不计入余额及MaxInputs
+}
+
+//Fees 使用这些utxo的手续费，hasChange表示是否有找零输出
+func (target *CoinSelectionTarget) Fees(used []*Unspent, hasChange bool) decimal.Decimal {
+	size := newSelectionSize(target)
+	for _, u := range used {
+		size.add(u)
+	}
+	return size.fees(hasChange)
+}
+
+//isCovered 余额是否足够支付发送总额及无找零时的手续费
+func (target *CoinSelectionTarget) isCovered(used []*Unspent) bool {
+	if len(used) == 0 {
+		return false
+	}
+	return sumUnspents(used).GreaterThanOrEqual(target.Amount.Add(target.Fees(used, false)))
+}
+
+//feesOfSize 交易单长度对应的手续费
+func (target *CoinSelectionTarget) feesOfSize(size int64) decimal.Decimal {
+	fees := decimal.Zero
+	if target.FeeRate.IsPositive() {
+		fees = decimal.New(size, 0).Div(decimal.New(1000, 0)).Mul(target.FeeRate)
+		fees = fees.Shift(target.Decimals).Ceil().Shift(-target.Decimals)
+	}
+	return decimal.Max(fees, target.MinFees)
+}
+
+//selectionSize 选币过程中增量计算交易单长度，加入或移除一个输入只需要常数时间
+type selectionSize struct {
+	target    *CoinSelectionTarget
+	inputs    int
+	addresses map[string]int //每个输入地址的输入数量
+}
+
+func newSelectionSize(target *CoinSelectionTarget) *selectionSize {
+	size := &selectionSize{target: target, addresses: make(map[string]int)}
+	for _, u := range target.Fixed {
+		size.add(u)
+	}
+	return size
+}
+
+func (size *selectionSize) add(u *Unspent) {
+	size.inputs++
+	size.addresses[u.Address]++
+}
+
+func (size *selectionSize) remove(u *Unspent) {
+	size.inputs--
+	if size.addresses[u.Address]--; size.addresses[u.Address] == 0 {
+		delete(size.addresses, u.Address)
+	}
+}
+
+//size 交易单长度，数量超过1字节变长整数时加上多出的字节
+func (size *selectionSize) size(hasChange bool) int64 {
+	target := size.target
+	programs := len(size.addresses)
+	length := target.BaseSize + int64(size.inputs)*target.InputSize + int64(programs)*target.ProgramSize
+	length += int64(len(writeVarUint(uint64(size.inputs))) - 1 + len(writeVarUint(uint64(programs))) - 1)
+	if hasChange {
+		length += target.ChangeSize
+	}
+	return length
+}
+
+func (size *selectionSize) fees(hasChange bool) decimal.Decimal {
+	return size.target.feesOfSize(size.size(hasChange))
+}
+
+//CoinSelector utxo选择策略
+type CoinSelector interface {
+	//Name 策略名称，用于配置及交易单ExtParam的coinSelection字段
+	Name() string
+	//Select 从可用utxo中选择足够支付发送总额及手续费的utxo
+	Select(unspents []*Unspent, target *CoinSelectionTarget) ([]*Unspent, error)
+}
+
+//smallestFirstSelector 从小到大累加utxo，能清理零散的utxo，但输入数量最多
+type smallestFirstSelector struct{}
+
+//NewSmallestFirstSelector 从小到大选币
+func NewSmallestFirstSelector() CoinSelector {
+	return &smallestFirstSelector{}
+}
+
+func (s *smallestFirstSelector) Name() string {
+	return CoinSelectionSmallestFirst
+}
+
+func (s *smallestFirstSelector) Select(unspents []*Unspent, target *CoinSelectionTarget) ([]*Unspent, error) {
+	sorted := spendableUnspents(unspents)
+	sortUnspentsByAmount(sorted)
+	return accumulateUnspents(sorted, target)
+}
+
+//largestFirstSelector 从大到小累加utxo，输入数量最少
+type largestFirstSelector struct{}
+
+//NewLargestFirstSelector 从大到小选币
+func NewLargestFirstSelector() CoinSelector {
+	return &largestFirstSelector{}
+}
+
+func (s *largestFirstSelector) Name() string {
+	return CoinSelectionLargestFirst
+}
+
+func (s *largestFirstSelector) Select(unspents []*Unspent, target *CoinSelectionTarget) ([]*Unspent, error) {
+	sorted := spendableUnspents(unspents)
+	sortUnspentsByAmountDesc(sorted)
+	return accumulateUnspents(sorted, target)
+}
+
+//branchAndBoundSelector 深度优先搜索总额刚好支付发送总额及手续费的组合，不产生找零。
+//多出的金额不超过一个找零输出的手续费时也视为匹配，多出部分作为手续费。
+//搜索不到时使用Fallback策略。
+type branchAndBoundSelector struct {
+	MaxTries int
+	Fallback CoinSelector
+}
+
+//NewBranchAndBoundSelector 精确匹配选币，搜索不到时从大到小选币
+func NewBranchAndBoundSelector() CoinSelector {
+	return &branchAndBoundSelector{
+		MaxTries: DefaultBranchAndBoundTries,
+		Fallback: NewLargestFirstSelector(),
+	}
+}
+
+func (s *branchAndBoundSelector) Name() string {
+	return CoinSelectionBranchAndBound
+}
+
+func (s *branchAndBoundSelector) Select(unspents []*Unspent, target *CoinSelectionTarget) ([]*Unspent, error) {
+
+	var (
+		sorted    = spendableUnspents(unspents)
+		amounts   = make([]decimal.Decimal, 0, len(sorted))
+		remains   = make([]decimal.Decimal, len(sorted)+1)
+		selected  = make([]*Unspent, 0)
+		size      = newSelectionSize(target)
+		best      []*Unspent
+		bestWaste decimal.Decimal
+		tries     = 0
+		search    func(i int, balance decimal.Decimal) bool
+	)
+
+	sortUnspentsByAmountDesc(sorted)
+	for _, u := range sorted {
+		amounts = append(amounts, unspentAmount(u))
+	}
+	//remains[i] = 第i个之后所有utxo的总额
+	remains[len(sorted)] = decimal.Zero
+	for i := len(sorted) - 1; i >= 0; i-- {
+		remains[i] = remains[i+1].Add(amounts[i])
+	}
+
+	//search 返回true表示停止搜索
+	search = func(i int, balance decimal.Decimal) bool {
+
+		tries++
+		if tries > s.MaxTries {
+			return true
+		}
+
+		if len(selected) > 0 {
+			lower := target.Amount.Add(size.fees(false))
+			upper := target.Amount.Add(size.fees(true))
+
+			//超出找零成本，再加输入只会更多
+			if balance.GreaterThan(upper) {
+				return false
+			}
+
+			if balance.GreaterThanOrEqual(lower) {
+				waste := balance.Sub(lower)
+				if best == nil || waste.LessThan(bestWaste) {
+					best = append([]*Unspent{}, selected...)
+					bestWaste = waste
+				}
+				return waste.IsZero()
+			}
+
+			//剩余的utxo全部加上也不够
+			if balance.Add(remains[i]).LessThan(lower) {
+				return false
+			}
+		}
+
+		if i >= len(sorted) || (target.MaxInputs > 0 && len(selected) >= target.MaxInputs) {
+			return false
+		}
+
+		//包含第i个
+		selected = append(selected, sorted[i])
+		size.add(sorted[i])
+		if search(i+1, balance.Add(amounts[i])) {
+			return true
+		}
+		size.remove(sorted[i])
+		selected = selected[:len(selected)-1]
+
+		//不包含第i个
+		return search(i+1, balance)
+	}
+
+	search(0, decimal.Zero)
+
+	if best != nil {
+		return best, nil
+	}
+
+	if s.Fallback == nil {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "can not find utxo exactly match the amount: %s", target.Amount.String())
+	}
+
+	return s.Fallback.Select(unspents, target)
+}
+
+//randomImproveSelector 随机选币，先随机累加到足够支付，再随机加入utxo使总额接近发送总额的2倍，
+//使找零与发送金额相近，同时逐步合并零散的utxo
+type randomImproveSelector struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+//NewRandomImproveSelector 随机改进选币
+func NewRandomImproveSelector() CoinSelector {
+	return &randomImproveSelector{
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (s *randomImproveSelector) Name() string {
+	return CoinSelectionRandomImprove
+}
+
+func (s *randomImproveSelector) Select(unspents []*Unspent, target *CoinSelectionTarget) ([]*Unspent, error) {
+
+	shuffled := spendableUnspents(unspents)
+	s.mu.Lock()
+	s.rand.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	s.mu.Unlock()
+
+	//随机累加到足够支付，随机选到的输入太多，或选到的零散utxo不足以支付其手续费时，改为从大到小
+	selected, err := accumulateUnspents(shuffled, target)
+	if err != nil {
+		return NewLargestFirstSelector().Select(unspents, target)
+	}
+
+	//改进：总额向发送总额的2倍靠近，且不超过3倍。
+	//每加入一个输入都重新计算手续费，加入后不足以支付手续费的utxo跳过
+	ideal := target.Amount.Mul(decimal.New(2, 0))
+	upper := target.Amount.Mul(decimal.New(3, 0))
+	balance := sumUnspents(selected)
+	size := newSelectionSize(target)
+	for _, u := range selected {
+		size.add(u)
+	}
+	for next := len(selected); next < len(shuffled); next++ {
+		if target.MaxInputs > 0 && len(selected) >= target.MaxInputs {
+			break
+		}
+		candidate := balance.Add(unspentAmount(shuffled[next]))
+		if candidate.GreaterThan(upper) {
+			continue
+		}
+		if !candidate.Sub(ideal).Abs().LessThan(balance.Sub(ideal).Abs()) {
+			continue
+		}
+		size.add(shuffled[next])
+		if candidate.LessThan(target.Amount.Add(size.fees(false))) {
+			size.remove(shuffled[next])
+			continue
+		}
+		selected = append(selected, shuffled[next])
+		balance = candidate
+	}
+
+	return selected, nil
+}
+
+//singleAddressSelector 只使用一个地址的utxo，找零也回到该地址，避免关联账户的多个地址。
+//优先选择输入数量最少的地址，数量相同时选择使用金额较小的地址。
+type singleAddressSelector struct{}
+
+//NewSingleAddressSelector 单地址选币
+func NewSingleAddressSelector() CoinSelector {
+	return &singleAddressSelector{}
+}
+
+func (s *singleAddressSelector) Name() string {
+	return CoinSelectionSingleAddress
+}
+
+func (s *singleAddressSelector) Select(unspents []*Unspent, target *CoinSelectionTarget) ([]*Unspent, error) {
+
+	var (
+		groups = make(map[string][]*Unspent)
+		best   []*Unspent
+	)
+
+	for _, u := range spendableUnspents(unspents) {
+		groups[u.Address] = append(groups[u.Address], u)
+	}
+
+	for _, group := range groups {
+		sortUnspentsByAmountDesc(group)
+		selected, err := accumulateUnspents(group, target)
+		if err != nil {
+			continue
+		}
+		if best == nil || len(selected) < len(best) ||
+			(len(selected) == len(best) && sumUnspents(selected).LessThan(sumUnspents(best))) {
+			best = selected
+		}
+	}
+
+	if best == nil {
+		return nil, openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAddress, "there is no address balance enough to send: %s", target.Amount.StringFixed(Decimals))
+	}
+
+	return best, nil
+}
+
+//accumulateUnspents 按顺序累加utxo，直到足够支付，输入数量不超过MaxInputs
+func accumulateUnspents(sorted []*Unspent, target *CoinSelectionTarget) ([]*Unspent, error) {
+	selected := make([]*Unspent, 0)
+	balance := decimal.Zero
+	size := newSelectionSize(target)
+	for _, u := range sorted {
+		if target.MaxInputs > 0 && len(selected) >= target.MaxInputs {
+			return nil, openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAccount, "the balance of %d inputs: %s is not enough, max inputs: %d",
+				len(selected), balance.StringFixed(Decimals), target.MaxInputs)
+		}
+		selected = append(selected, u)
+		balance = balance.Add(unspentAmount(u))
+		size.add(u)
+		if balance.GreaterThanOrEqual(target.Amount.Add(size.fees(false))) {
+			return selected, nil
+		}
+	}
+	return nil, openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAccount, "the balance: %s is not enough", balance.StringFixed(Decimals))
+}
+
+//spendableUnspents 可用的utxo
+func spendableUnspents(unspents []*Unspent) []*Unspent {
+	spendable := make([]*Unspent, 0, len(unspents))
+	for _, u := range unspents {
+		if u.Spendable {
+			spendable = append(spendable, u)
+		}
+	}
+	return spendable
+}
+
+//sumUnspents utxo总额
+func sumUnspents(unspents []*Unspent) decimal.Decimal {
+	balance := decimal.Zero
+	for _, u := range unspents {
+		balance = balance.Add(unspentAmount(u))
+	}
+	return balance
+}
+
+func unspentAmount(u *Unspent) decimal.Decimal {
+	amount, _ := decimal.NewFromString(u.Amount)
+	return amount
+}
+
+//sortUnspentsByAmountDesc utxo按金额从大到小排序
+func sortUnspentsByAmountDesc(unspents []*Unspent) {
+	sort.SliceStable(unspents, func(i, j int) bool {
+		return unspentAmount(unspents[i]).GreaterThan(unspentAmount(unspents[j]))
+	})
+}
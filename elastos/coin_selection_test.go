@@ -0,0 +1,232 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package elastos
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/shopspring/decimal"
+)
+
+func testUnspents(address string, amounts ...string) []*Unspent {
+	unspents := make([]*Unspent, 0)
+	for _, amount := range amounts {
+		unspents = append(unspents, &Unspent{
+			TxID:      fmt.Sprintf("%064x", len(unspents)+1),
+			Address:   address,
+			Amount:    amount,
+			Spendable: true,
+		})
+	}
+	return unspents
+}
+
+//testCoinSelectionTarget 费率为每字节0.001，每个输入1字节，找零输出1字节
+func testCoinSelectionTarget(amount string) *CoinSelectionTarget {
+	return &CoinSelectionTarget{
+		Amount:     decimal.RequireFromString(amount),
+		MaxInputs:  50,
+		FeeRate:    decimal.New(1, 0),
+		Decimals:   Decimals,
+		InputSize:  1,
+		ChangeSize: 1,
+	}
+}
+
+func TestCoinSelector_Select(t *testing.T) {
+
+	unspents := testUnspents("ESUQkMEsfUdbmrounnCrNdVHLXrvSzvy7A", "0.1", "0.2", "0.3", "0.5", "1", "2")
+	unspents = append(unspents, testUnspents("EQZFJqni8nGrbU4gkmP4V9Qmi1BHbnWuEe", "0.8", "0.8")...)
+	unspents = append(unspents, &Unspent{Address: "EQZFJqni8nGrbU4gkmP4V9Qmi1BHbnWuEe", Amount: "100"})
+
+	tests := []struct {
+		selector CoinSelector
+		amount   string
+		expected []string
+	}{
+		{NewSmallestFirstSelector(), "0.5", []string{"0.1", "0.2", "0.3"}},
+		{NewLargestFirstSelector(), "0.5", []string{"2"}},
+		//0.3 + 0.2 = 0.5 + 2个输入的手续费，不需要找零
+		{NewBranchAndBoundSelector(), "0.498", []string{"0.3", "0.2"}},
+		//多出的0.0005小于找零成本，作为手续费
+		{NewBranchAndBoundSelector(), "0.4975", []string{"0.3", "0.2"}},
+		//单地址选最少的输入
+		{NewSingleAddressSelector(), "1.5", []string{"2"}},
+		{NewSingleAddressSelector(), "3", []string{"2", "1", "0.5"}},
+	}
+
+	for _, test := range tests {
+		used, err := test.selector.Select(unspents, testCoinSelectionTarget(test.amount))
+		if err != nil {
+			t.Errorf("%s select amount: %s failed unexpected error: %v", test.selector.Name(), test.amount, err)
+			continue
+		}
+		amounts := make([]string, 0)
+		for _, u := range used {
+			amounts = append(amounts, u.Amount)
+		}
+		if fmt.Sprint(amounts) != fmt.Sprint(test.expected) {
+			t.Errorf("%s select amount: %s used = %v, expected = %v", test.selector.Name(), test.amount, amounts, test.expected)
+		}
+	}
+
+	//不可用的utxo不能被选中，余额不足
+	for _, selector := range []CoinSelector{
+		NewSmallestFirstSelector(),
+		NewLargestFirstSelector(),
+		NewBranchAndBoundSelector(),
+		NewRandomImproveSelector(),
+		NewSingleAddressSelector(),
+	} {
+		_, err := selector.Select(unspents, testCoinSelectionTarget("10"))
+		if err == nil {
+			t.Errorf("%s select amount: 10 should be failed", selector.Name())
+		}
+	}
+}
+
+func TestCoinSelector_MaxInputs(t *testing.T) {
+
+	unspents := testUnspents("ESUQkMEsfUdbmrounnCrNdVHLXrvSzvy7A", "0.1", "0.1", "0.1", "0.1", "0.1", "0.1")
+
+	//需要6个输入，所有策略都不能超过输入上限
+	for _, selector := range []CoinSelector{
+		NewSmallestFirstSelector(),
+		NewLargestFirstSelector(),
+		NewBranchAndBoundSelector(),
+		NewRandomImproveSelector(),
+		NewSingleAddressSelector(),
+	} {
+		target := testCoinSelectionTarget("0.5")
+		target.MaxInputs = 5
+		used, err := selector.Select(unspents, target)
+		if err == nil {
+			t.Errorf("%s select inputs: %d over max inputs: %d", selector.Name(), len(used), target.MaxInputs)
+		}
+	}
+}
+
+func TestCoinSelector_RandomImprove(t *testing.T) {
+
+	unspents := testUnspents("ESUQkMEsfUdbmrounnCrNdVHLXrvSzvy7A", "0.1", "0.1", "0.1", "0.1", "0.1", "0.1", "0.1", "0.1", "0.1", "0.1", "1")
+	selector := NewRandomImproveSelector()
+
+	for i := 0; i < 20; i++ {
+		target := testCoinSelectionTarget("0.3")
+		used, err := selector.Select(unspents, target)
+		if err != nil {
+			t.Fatalf("randomImprove select failed unexpected error: %v", err)
+		}
+		covered := target.isCovered(used)
+		if !covered {
+			t.Fatalf("randomImprove select balance: %s is not enough", sumUnspents(used).String())
+		}
+		//改进后不超过发送总额的3倍，除非第一轮随机就选中了大额utxo
+		balance := sumUnspents(used)
+		if balance.GreaterThan(decimal.RequireFromString("0.9")) && len(used) > 4 {
+			t.Errorf("randomImprove select balance: %s is too much", balance.String())
+		}
+	}
+}
+
+func TestCoinSelector_RandomImproveFees(t *testing.T) {
+
+	//0.601刚好支付发送总额及一个输入的手续费，加入零散utxo后总额更接近2倍，但不足以支付多一个输入的手续费
+	unspents := testUnspents("ESUQkMEsfUdbmrounnCrNdVHLXrvSzvy7A", "0.601", "0.0005")
+	target := testCoinSelectionTarget("0.6")
+
+	selector := NewRandomImproveSelector()
+	for i := 0; i < 20; i++ {
+		used, err := selector.Select(unspents, target)
+		if err != nil {
+			t.Fatalf("randomImprove select failed unexpected error: %v", err)
+		}
+		if !target.isCovered(used) || len(used) != 1 {
+			t.Fatalf("randomImprove select inputs: %d balance: %s can not pay fees", len(used), sumUnspents(used).String())
+		}
+	}
+}
+
+func TestCoinSelectionTarget_Fees(t *testing.T) {
+
+	//基础长度100，每个输入10，每个地址的解锁脚本100，找零输出20，费率每KB 0.01
+	target := &CoinSelectionTarget{
+		FeeRate:     decimal.RequireFromString("0.01"),
+		MinFees:     decimal.RequireFromString("0.000025"),
+		Decimals:    Decimals,
+		BaseSize:    100,
+		InputSize:   10,
+		ProgramSize: 100,
+		ChangeSize:  20,
+		Fixed:       testUnspents("EQZFJqni8nGrbU4gkmP4V9Qmi1BHbnWuEe", "1"),
+	}
+	unspents := testUnspents("ESUQkMEsfUdbmrounnCrNdVHLXrvSzvy7A", "0.1", "0.2")
+
+	tests := []struct {
+		used      []*Unspent
+		hasChange bool
+		fees      string
+	}{
+		//只有固定输入，手续费不低于下限
+		{nil, false, "0.0021"},
+		//同一地址的输入共用解锁脚本
+		{unspents[:1], false, "0.0032"},
+		{unspents, false, "0.0033"},
+		{unspents, true, "0.0035"},
+	}
+	for _, test := range tests {
+		if fees := target.Fees(test.used, test.hasChange); !fees.Equal(decimal.RequireFromString(test.fees)) {
+			t.Errorf("Fees inputs: %d change: %v = %s, expected = %s", len(test.used), test.hasChange, fees.String(), test.fees)
+		}
+	}
+
+	//超过252个输入时，输入数量多占2字节
+	size := newSelectionSize(&CoinSelectionTarget{InputSize: 1})
+	for i := 0; i < 0xFD; i++ {
+		size.add(&Unspent{Address: "ESUQkMEsfUdbmrounnCrNdVHLXrvSzvy7A"})
+	}
+	if length := size.size(false); length != 0xFD+2 {
+		t.Errorf("size of %d inputs = %d, expected = %d", 0xFD, length, 0xFD+2)
+	}
+	target.MinFees = decimal.New(1, 0)
+	if fees := target.Fees(unspents, true); !fees.Equal(decimal.New(1, 0)) {
+		t.Errorf("Fees = %s, expected min fees = 1", fees.String())
+	}
+}
+
+func TestTransactionDecoder_getCoinSelector(t *testing.T) {
+
+	decoder := NewTransactionDecoder(tw)
+
+	rawTx := &openwallet.RawTransaction{}
+	selector, err := decoder.getCoinSelector(rawTx)
+	if err != nil || selector.Name() != CoinSelectionSmallestFirst {
+		t.Errorf("getCoinSelector default = %v, error = %v", selector, err)
+	}
+
+	rawTx.SetExtParam("coinSelection", CoinSelectionBranchAndBound)
+	selector, err = decoder.getCoinSelector(rawTx)
+	if err != nil || selector.Name() != CoinSelectionBranchAndBound {
+		t.Errorf("getCoinSelector ExtParam = %v, error = %v", selector, err)
+	}
+
+	rawTx.SetExtParam("coinSelection", "unknown")
+	if _, err = decoder.getCoinSelector(rawTx); err == nil {
+		t.Errorf("getCoinSelector unknown strategy should be failed")
+	}
+}
@@ -16,7 +16,11 @@
 package elastos
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"strings"
 	"time"
@@ -43,6 +47,37 @@ const (
 	MasterKey = "Elastos seed"
 	CurveType = owcrypt.ECC_CURVE_SECP256R1
 	Decimals  = int32(8)
+	//coinbase输出需要的确认数
+	CoinbaseMaturity = 100
+	//多个节点时，默认的节点健康检查间隔
+	DefaultHealthCheckInterval = time.Minute
+	//默认的节点请求超时时间
+	DefaultRPCTimeout = 30 * time.Second
+	//默认的节点请求重试次数
+	DefaultRPCMaxRetries = 3
+	//默认的第一次重试等待时间及最大等待时间
+	DefaultRPCRetryBackoff    = 500 * time.Millisecond
+	DefaultRPCMaxRetryBackoff = 10 * time.Second
+	//json-rpc的节点内部错误码
+	RPCErrorCodeInternal = -32603
+	//默认的批量请求每次发送的最大调用数量
+	DefaultRPCBatchSize = 100
+	//getblock的verbosity，1返回交易单ID，2返回交易详情
+	BlockVerbosityTxIDs        = uint64(1)
+	BlockVerbosityTransactions = uint64(2)
+)
+
+const (
+	//私钥导出格式
+	PrivateKeyFormatHex = "hex" //官方钱包（ela-cli）导出和导入的16进制私钥
+	PrivateKeyFormatWIF = "wif" //带校验码的base58 WIF私钥
+)
+
+const (
+	//找零地址策略
+	ChangePolicyInput     = "input"     //找零到第一个输入地址
+	ChangePolicyDedicated = "dedicated" //找零到账户固定的找零地址
+	ChangePolicyFresh     = "fresh"     //每次找零到新创建的地址
 )
 
 type WalletConfig struct {
@@ -65,8 +100,11 @@ type WalletConfig struct {
 	configFilePath string
 	//配置文件名
 	configFileName string
-	//rpc证书
+	//rpc证书，节点https证书的CA，在证书目录中
 	CertFileName string
+	//客户端证书及私钥，节点要求客户端证书时使用，在证书目录中
+	ClientCertFileName string
+	ClientKeyFileName  string
 	//区块链数据文件
 	//BlockchainFile string
 	// 核心钱包是否只做监听
@@ -99,6 +137,40 @@ type WalletConfig struct {
 	UseFixedFee bool
 	//固定手续费
 	FixedFee string
+	//默认的选币策略
+	CoinSelection string
+	//默认的找零地址策略
+	ChangePolicy string
+	//私钥导出格式，hex或wif
+	PrivateKeyFormat string
+	//手续费率来源，按顺序回退
+	FeeRateSources []string
+	//默认的每KB手续费率
+	DefaultFeeRate string
+	//最低转发每KB手续费率，静态配置，需与节点的配置保持一致
+	MinRelayFeeRate string
+	//统计手续费率的最近区块数量
+	FeeRateBlocks int
+	//统计手续费率的最大交易样本数量
+	FeeRateSamples int
+	//utxo锁定时长，超过后未广播的交易单选用的utxo可被重新选用
+	UnspentLockExpiration time.Duration
+	//侧链的创世区块锁定地址，侧链名称 -> 锁定地址
+	SideChainLockAddresses map[string]string
+	//跨链手续费，每个跨链接收地址支付一次
+	CrossChainFee string
+	//多个节点时，检查节点区块高度并选择最高节点的间隔
+	NodeHealthCheckInterval time.Duration
+	//节点请求的超时时间
+	RPCTimeout time.Duration
+	//节点请求失败的最大重试次数
+	RPCMaxRetries int
+	//第一次重试的等待时间，之后每次加倍
+	RPCRetryBackoff time.Duration
+	//可以重试的json-rpc错误码
+	RPCRetryableCodes []int64
+	//批量请求每次发送的最大调用数量，0为不使用批量请求
+	RPCBatchSize int
 	//小数位精度
 	Decimals int32
 	// data directory
@@ -131,6 +203,9 @@ func NewConfig(symbol string, curveType uint32, decimals int32) *WalletConfig {
 	c.configFileName = c.Symbol + ".ini"
 	//rpc证书
 	c.CertFileName = "rpc.cert"
+	//客户端证书及私钥
+	c.ClientCertFileName = ""
+	c.ClientKeyFileName = ""
 	//区块链数据文件
 	//c.BlockchainFile = "blockchain.db"
 	// 核心钱包是否只做监听
@@ -157,6 +232,36 @@ func NewConfig(symbol string, curveType uint32, decimals int32) *WalletConfig {
 	c.WalletPassword = ""
 	//小数位精度
 	c.Decimals = decimals
+	//默认的选币策略
+	c.CoinSelection = CoinSelectionSmallestFirst
+	//默认的找零地址策略
+	c.ChangePolicy = ChangePolicyInput
+	//私钥导出格式，默认与官方钱包相同
+	c.PrivateKeyFormat = PrivateKeyFormatHex
+	//手续费率来源，按顺序回退，主链节点没有estimatesmartfee，默认不使用node
+	c.FeeRateSources = []string{FeeRateSourceBlockStats, FeeRateSourceDefault}
+	//默认的每KB手续费率
+	c.DefaultFeeRate = "0.0001"
+	//最低转发每KB手续费率，需与节点的配置保持一致
+	c.MinRelayFeeRate = "0.00001"
+	//统计手续费率的最近区块数量
+	c.FeeRateBlocks = 6
+	//统计手续费率的最大交易样本数量
+	c.FeeRateSamples = 50
+	//utxo锁定时长
+	c.UnspentLockExpiration = 30 * time.Minute
+	//侧链的创世区块锁定地址，需按网络配置
+	c.SideChainLockAddresses = make(map[string]string)
+	//跨链手续费
+	c.CrossChainFee = "0.0001"
+	//节点健康检查间隔
+	c.NodeHealthCheckInterval = DefaultHealthCheckInterval
+	//节点请求超时及重试
+	c.RPCTimeout = DefaultRPCTimeout
+	c.RPCMaxRetries = DefaultRPCMaxRetries
+	c.RPCRetryBackoff = DefaultRPCRetryBackoff
+	c.RPCRetryableCodes = []int64{RPCErrorCodeInternal}
+	c.RPCBatchSize = DefaultRPCBatchSize
 
 	//默认配置内容
 	c.DefaultConfig = `
@@ -172,12 +277,19 @@ mainNetDataPath = ""
 testNetDataPath = ""
 # RPC Server Type，0: CoreWallet RPC; 1: Explorer API
 rpcServerType = 0
-# RPC api url
+# RPC api url, multiple nodes are separated by comma, the node with the highest block is used
 serverAPI = ""
 # RPC Authentication Username
 rpcUser = ""
 # RPC Authentication Password
 rpcPassword = ""
+# directory of the RPC certificates, default is data/ela/certs
+certsDir = ""
+# CA certificate of the https node in certsDir, the system CAs are used if it does not exist
+certFileName = "rpc.cert"
+# client certificate and private key in certsDir, used when the node requires client certificate
+clientCertFileName = ""
+clientKeyFileName = ""
 # Is network test?
 isTestNet = false
 # the safe address that wallet send money to.
@@ -202,6 +314,42 @@ omniTransferCost = "0.00000546"
 omniSupport = false
 # support segWit
 supportSegWit = true
+# coin selection strategy: smallestFirst, largestFirst, branchAndBound, randomImprove, singleAddress
+coinSelection = "smallestFirst"
+# change address policy: input, dedicated, fresh
+changePolicy = "input"
+# private key export format: hex (same as the official wallet), wif (base58 with checksum)
+privateKeyFormat = "hex"
+# fee rate sources in fallback order: node, blockStats, minRelay, default
+# the main chain node has no estimatesmartfee, add node only if the node supports it
+feeRateSources = "blockStats,default"
+# default fee rate per KB, used by the default source
+defaultFeeRate = "0.0001"
+# minimum relay fee rate per KB, a static floor that is not queried from the node, keep it the same as the node
+# estimated fee rate will not be lower than it, it is also used by the minRelay source
+minRelayFeeRate = "0.00001"
+# number of recent blocks sampled by the blockStats source
+feeRateBlocks = 6
+# max number of transactions sampled by the blockStats source
+feeRateSamples = 50
+# how long the utxo selected by an unsubmitted transaction is locked, sample: 30m, 1h
+unspentLockExpiration = "30m"
+# genesis lock address of each sidechain for cross-chain transfer, sample: "ID:X...,ETH:X..."
+sideChainLockAddresses = ""
+# cross-chain fee paid for each sidechain receiver
+crossChainFee = "0.0001"
+# how often the block heights of multiple nodes are checked, sample: 1m, 30s
+nodeHealthCheckInterval = "1m"
+# timeout of each RPC request, sample: 30s, 1m
+rpcTimeout = "30s"
+# max retries of a failed RPC request, sendrawtransaction is only retried when the node can not be connected
+rpcMaxRetries = 3
+# wait time before the first retry, doubled for each later retry
+rpcRetryBackoff = "500ms"
+# retryable JSON-RPC error codes, separated by comma
+rpcRetryableCodes = "-32603"
+# max calls sent in one JSON-RPC batch request, 0 disables batch request
+rpcBatchSize = 100
 
 `
 
@@ -244,6 +392,42 @@ func (wc *WalletConfig) makeDataDir() {
 	file.MkdirAll(wc.dbPath)
 }
 
+//tlsConfig 加载证书目录中的CA证书及客户端证书，都没有时返回nil
+func (wc *WalletConfig) tlsConfig() (*tls.Config, error) {
+
+	var tlsConfig *tls.Config
+
+	if len(wc.CertFileName) > 0 {
+		caFile := filepath.Join(wc.CertsDir, wc.CertFileName)
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("certificate file: %s is invalid", caFile)
+			}
+			tlsConfig = &tls.Config{RootCAs: pool}
+		}
+	}
+
+	if len(wc.ClientCertFileName) > 0 || len(wc.ClientKeyFileName) > 0 {
+		cert, err := tls.LoadX509KeyPair(
+			filepath.Join(wc.CertsDir, wc.ClientCertFileName),
+			filepath.Join(wc.CertsDir, wc.ClientKeyFileName))
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate failed, unexpected error: %v", err)
+		}
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
 //initConfig 初始化配置文件
 func (wc *WalletConfig) InitConfig() {
 
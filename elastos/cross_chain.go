@@ -0,0 +1,90 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package elastos
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/shopspring/decimal"
+)
+
+/*
+	跨链转账：主链的ELA转到侧链。
+	交易单ExtParam的crossChain指定侧链名称，To的地址为侧链地址，金额为侧链到账金额。
+	每个侧链地址对应一个发送到侧链创世区块锁定地址的输出，输出金额为到账金额加上跨链手续费，
+	payload记录侧链地址、输出序号及到账金额。
+*/
+
+//crossChainParam 跨链转账参数
+type crossChainParam struct {
+	SideChain   string          //侧链名称
+	LockAddress string          //侧链的创世区块锁定地址
+	Fee         decimal.Decimal //每个侧链地址的跨链手续费
+}
+
+//getCrossChain 交易单的跨链参数，ExtParam没有crossChain时返回nil。
+//跨链手续费优先使用ExtParam的crossChainFee，其次是配置。
+func (decoder *TransactionDecoder) getCrossChain(rawTx *openwallet.RawTransaction) (*crossChainParam, error) {
+
+	sideChain := rawTx.GetExtParam().Get("crossChain").String()
+	if len(sideChain) == 0 {
+		return nil, nil
+	}
+
+	lockAddress, ok := decoder.wm.Config.SideChainLockAddresses[sideChain]
+	if !ok || len(lockAddress) == 0 {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "side chain: %s lock address is not configured", sideChain)
+	}
+
+	addressType, err := decoder.wm.Decoder.GetAddressType(lockAddress)
+	if err != nil || addressType != AddressTypeCrossChain {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "side chain: %s lock address: %s is invalid", sideChain, lockAddress)
+	}
+
+	feeValue := decoder.wm.Config.CrossChainFee
+	if custom := rawTx.GetExtParam().Get("crossChainFee").String(); len(custom) > 0 {
+		feeValue = custom
+	}
+	fee, err := decimal.NewFromString(feeValue)
+	if err != nil || fee.IsNegative() {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "cross chain fee: %s is invalid", feeValue)
+	}
+
+	return &crossChainParam{SideChain: sideChain, LockAddress: lockAddress, Fee: fee}, nil
+}
+
+//checkSideChainAddress 检查侧链接收地址，支持标准地址、DID地址及EVM侧链的0x地址
+func (decoder *TransactionDecoder) checkSideChainAddress(address string) *openwallet.Error {
+
+	if strings.HasPrefix(address, "0x") {
+		hash, err := hex.DecodeString(address[2:])
+		if err != nil || len(hash) != 20 {
+			return openwallet.Errorf(openwallet.ErrAdressDecodeFailed, "side chain address: %s is invalid", address)
+		}
+		return nil
+	}
+
+	addressType, err := decoder.wm.Decoder.GetAddressType(address)
+	if err != nil {
+		return openwallet.Errorf(openwallet.ErrAdressDecodeFailed, "side chain address is invalid, %v", err)
+	}
+	if addressType != AddressTypeStandard && addressType != AddressTypeIDChain {
+		return openwallet.Errorf(openwallet.ErrAdressDecodeFailed, "side chain address: %s type: %s is not supported", address, addressType)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package elastos
+
+//ListProducers 分页查询超级节点及票数，state为空时查询所有状态
+func (wm *WalletManager) ListProducers(start, limit int, state string) (*ProducerList, error) {
+	return wm.WalletClient.listProducers(start, limit, state)
+}
+
+//GetProducerStatus 查询超级节点的状态
+func (wm *WalletManager) GetProducerStatus(publicKey string) (string, error) {
+	return wm.WalletClient.getProducerStatus(publicKey)
+}
+
+//GetVoteStatus 查询地址的投票状态，Voting为地址已用于投票的金额
+func (wm *WalletManager) GetVoteStatus(address ...string) ([]*VoteStatus, error) {
+
+	status := make([]*VoteStatus, 0, len(address))
+	for _, addr := range address {
+		s, err := wm.WalletClient.getVoteStatus(addr)
+		if err != nil {
+			return nil, err
+		}
+		status = append(status, s)
+	}
+
+	return status, nil
+}
+
+//GetArbitratorsInfo 查询当前及下一轮的仲裁人
+func (wm *WalletManager) GetArbitratorsInfo() (*ArbitratorsInfo, error) {
+	return wm.WalletClient.getArbitratorsInfo()
+}
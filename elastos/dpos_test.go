@@ -0,0 +1,106 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package elastos
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestWalletManager_DPoS(t *testing.T) {
+
+	owner := "021a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a"
+	addr := "ESUQkMEsfUdbmrounnCrNdVHLXrvSzvy7A"
+
+	node := newTestNode(t, map[string]testNodeHandler{
+		"listproducers": func(params gjson.Result) (interface{}, error) {
+			if params.Get("start").Int() != 10 || params.Get("limit").Int() != 5 || params.Get("state").String() != "active" {
+				return nil, errors.New("invalid params: " + params.Raw)
+			}
+			return map[string]interface{}{
+				"producers": []map[string]interface{}{
+					{"ownerpublickey": owner, "nodepublickey": owner, "nickname": "node", "url": "https://node", "location": 86,
+						"active": true, "votes": "12345.6789", "state": "Active", "registerheight": 360000, "index": 10},
+				},
+				"totalvotes":  "99999.5",
+				"totalcounts": 96,
+			}, nil
+		},
+		"producerstatus": func(params gjson.Result) (interface{}, error) {
+			if params.Get("publickey").String() != owner {
+				return "Unregistered", nil
+			}
+			return "Active", nil
+		},
+		"votestatus": func(params gjson.Result) (interface{}, error) {
+			if params.Get("address").String() != addr {
+				return nil, errors.New("invalid address")
+			}
+			return map[string]interface{}{"total": "10.5", "voting": "8", "pending": true}, nil
+		},
+		"getarbitratorsinfo": func(params gjson.Result) (interface{}, error) {
+			return map[string]interface{}{
+				"arbitrators":            []string{owner},
+				"candidates":             []string{},
+				"nextarbitrators":        []string{owner},
+				"nextcandidates":         []string{owner},
+				"ondutyarbitrator":       owner,
+				"currentturnstartheight": 400000,
+				"nextturnstartheight":    400036,
+			}, nil
+		},
+	})
+	defer node.Close()
+
+	wm := newTestWalletManager(t, node.URL)
+
+	list, err := wm.ListProducers(10, 5, "active")
+	if err != nil {
+		t.Fatalf("ListProducers failed unexpected error: %v", err)
+	}
+	if list.TotalCounts != 96 || list.TotalVotes != "99999.5" || len(list.Producers) != 1 {
+		t.Fatalf("ListProducers = %+v", list)
+	}
+	p := list.Producers[0]
+	if p.OwnerPublicKey != owner || p.Votes != "12345.6789" || p.State != "Active" || !p.Active || p.Location != 86 || p.RegisterHeight != 360000 || p.Index != 10 {
+		t.Errorf("producer = %+v", p)
+	}
+
+	if status, err := wm.GetProducerStatus(owner); err != nil || status != "Active" {
+		t.Errorf("GetProducerStatus = %s, err = %v", status, err)
+	}
+
+	votes, err := wm.GetVoteStatus(addr)
+	if err != nil || len(votes) != 1 {
+		t.Fatalf("GetVoteStatus = %v, err = %v", votes, err)
+	}
+	if v := votes[0]; v.Address != addr || v.Total != "10.5" || v.Voting != "8" || !v.Pending {
+		t.Errorf("vote status = %+v", v)
+	}
+	if _, err := wm.GetVoteStatus(addr, "EQZFJqni8nGrbU4gkmP4V9Qmi1BHbnWuEe"); err == nil {
+		t.Errorf("GetVoteStatus should be failed when node returns error")
+	}
+
+	info, err := wm.GetArbitratorsInfo()
+	if err != nil {
+		t.Fatalf("GetArbitratorsInfo failed unexpected error: %v", err)
+	}
+	if len(info.Arbitrators) != 1 || len(info.Candidates) != 0 || len(info.NextCandidates) != 1 || info.OnDutyArbitrator != owner || info.NextTurnStartHeight != 400036 {
+		t.Errorf("arbitrators info = %+v", info)
+	}
+}
@@ -16,6 +16,10 @@
 package elastos
 
 import (
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/astaxie/beego/config"
 	"github.com/blocktree/openwallet/log"
 	"github.com/blocktree/openwallet/openwallet"
@@ -65,7 +69,100 @@ func (wm *WalletManager) LoadAssetsConfig(c config.Configer) error {
 	wm.Config.ServerAPI = c.String("serverAPI")
 	wm.Config.UseFixedFee, _ = c.Bool("useFixedFee")
 	wm.Config.FixedFee = c.String("fixedFee")
+	if coinSelection := c.String("coinSelection"); len(coinSelection) > 0 {
+		wm.Config.CoinSelection = coinSelection
+	}
+	if changePolicy := c.String("changePolicy"); len(changePolicy) > 0 {
+		wm.Config.ChangePolicy = changePolicy
+	}
+	if privateKeyFormat := c.String("privateKeyFormat"); len(privateKeyFormat) > 0 {
+		wm.Config.PrivateKeyFormat = privateKeyFormat
+	}
+	if feeRateSources := c.String("feeRateSources"); len(feeRateSources) > 0 {
+		wm.Config.FeeRateSources = make([]string, 0)
+		for _, source := range strings.Split(feeRateSources, ",") {
+			if source = strings.TrimSpace(source); len(source) > 0 {
+				wm.Config.FeeRateSources = append(wm.Config.FeeRateSources, source)
+			}
+		}
+	}
+	if defaultFeeRate := c.String("defaultFeeRate"); len(defaultFeeRate) > 0 {
+		wm.Config.DefaultFeeRate = defaultFeeRate
+	}
+	if minRelayFeeRate := c.String("minRelayFeeRate"); len(minRelayFeeRate) > 0 {
+		wm.Config.MinRelayFeeRate = minRelayFeeRate
+	}
+	if feeRateBlocks, err := c.Int("feeRateBlocks"); err == nil && feeRateBlocks > 0 {
+		wm.Config.FeeRateBlocks = feeRateBlocks
+	}
+	if feeRateSamples, err := c.Int("feeRateSamples"); err == nil && feeRateSamples > 0 {
+		wm.Config.FeeRateSamples = feeRateSamples
+	}
+	if expiration, err := time.ParseDuration(c.String("unspentLockExpiration")); err == nil && expiration > 0 {
+		wm.Config.UnspentLockExpiration = expiration
+	}
+	if lockAddresses := c.String("sideChainLockAddresses"); len(lockAddresses) > 0 {
+		wm.Config.SideChainLockAddresses = make(map[string]string)
+		for _, pair := range strings.Split(lockAddresses, ",") {
+			kv := strings.SplitN(strings.TrimSpace(pair), ":", 2)
+			if len(kv) == 2 && len(kv[0]) > 0 && len(kv[1]) > 0 {
+				wm.Config.SideChainLockAddresses[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+			}
+		}
+	}
+	if crossChainFee := c.String("crossChainFee"); len(crossChainFee) > 0 {
+		wm.Config.CrossChainFee = crossChainFee
+	}
+	if interval, err := time.ParseDuration(c.String("nodeHealthCheckInterval")); err == nil && interval > 0 {
+		wm.Config.NodeHealthCheckInterval = interval
+	}
+	if timeout, err := time.ParseDuration(c.String("rpcTimeout")); err == nil && timeout > 0 {
+		wm.Config.RPCTimeout = timeout
+	}
+	if maxRetries, err := c.Int("rpcMaxRetries"); err == nil && maxRetries >= 0 {
+		wm.Config.RPCMaxRetries = maxRetries
+	}
+	if backoff, err := time.ParseDuration(c.String("rpcRetryBackoff")); err == nil && backoff > 0 {
+		wm.Config.RPCRetryBackoff = backoff
+	}
+	if retryableCodes := c.String("rpcRetryableCodes"); len(retryableCodes) > 0 {
+		wm.Config.RPCRetryableCodes = make([]int64, 0)
+		for _, code := range strings.Split(retryableCodes, ",") {
+			if n, err := strconv.ParseInt(strings.TrimSpace(code), 10, 64); err == nil {
+				wm.Config.RPCRetryableCodes = append(wm.Config.RPCRetryableCodes, n)
+			}
+		}
+	}
+	if batchSize, err := c.Int("rpcBatchSize"); err == nil && batchSize >= 0 {
+		wm.Config.RPCBatchSize = batchSize
+	}
+	wm.Config.RpcUser = c.String("rpcUser")
+	wm.Config.RpcPassword = c.String("rpcPassword")
+	if certsDir := c.String("certsDir"); len(certsDir) > 0 {
+		wm.Config.CertsDir = certsDir
+	}
+	if certFileName := c.String("certFileName"); len(certFileName) > 0 {
+		wm.Config.CertFileName = certFileName
+	}
+	wm.Config.ClientCertFileName = c.String("clientCertFileName")
+	wm.Config.ClientKeyFileName = c.String("clientKeyFileName")
+	tlsConfig, err := wm.Config.tlsConfig()
+	if err != nil {
+		return err
+	}
 	wm.WalletClient = NewClient(wm.Config.ServerAPI, false)
+	wm.WalletClient.SetBasicAuth(wm.Config.RpcUser, wm.Config.RpcPassword)
+	if tlsConfig != nil {
+		if err := wm.WalletClient.SetTLSConfig(tlsConfig); err != nil {
+			return err
+		}
+	}
+	wm.WalletClient.HealthCheckInterval = wm.Config.NodeHealthCheckInterval
+	wm.WalletClient.Timeout = wm.Config.RPCTimeout
+	wm.WalletClient.MaxRetries = wm.Config.RPCMaxRetries
+	wm.WalletClient.RetryBackoff = wm.Config.RPCRetryBackoff
+	wm.WalletClient.RetryableCodes = wm.Config.RPCRetryableCodes
+	wm.WalletClient.BatchSize = wm.Config.RPCBatchSize
 	wm.Config.DataDir = c.String("dataDir")
 
 	//数据文件夹
@@ -0,0 +1,286 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package elastos
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/blocktree/go-owcdrivers/elastosTransaction"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	//手续费率来源
+	FeeRateSourceNode       = "node"       //节点的estimatesmartfee
+	FeeRateSourceBlockStats = "blockStats" //最近区块的交易费率中位数
+	FeeRateSourceMinRelay   = "minRelay"   //配置的最低转发费率，不查询节点
+	FeeRateSourceDefault    = "default"    //配置的默认费率
+)
+
+//FeeRateProvider 手续费率来源，费率单位为每KB
+type FeeRateProvider interface {
+	//Name 来源名称，用于配置feeRateSources
+	Name() string
+	//FeeRate 获取每KB的手续费率
+	FeeRate() (decimal.Decimal, error)
+}
+
+//nodeFeeRateProvider 节点的费率估算，主链节点没有estimatesmartfee时失败
+type nodeFeeRateProvider struct {
+	wm *WalletManager
+}
+
+func (p *nodeFeeRateProvider) Name() string {
+	return FeeRateSourceNode
+}
+
+func (p *nodeFeeRateProvider) FeeRate() (decimal.Decimal, error) {
+	feeRate, err := p.wm.WalletClient.estimateFeeRate()
+	if err != nil {
+		return decimal.Zero, err
+	}
+	if !feeRate.IsPositive() {
+		return decimal.Zero, fmt.Errorf("node fee rate: %s is invalid", feeRate.String())
+	}
+	return feeRate, nil
+}
+
+//blockStatsFeeRateProvider 统计最近区块中交易的每KB手续费，取中位数。
+//每个区块的费率样本按高度缓存，区块哈希变化时重新统计
+type blockStatsFeeRateProvider struct {
+	wm    *WalletManager
+	mu    sync.Mutex
+	cache map[uint64]*blockFeeRates
+}
+
+//blockFeeRates 一个区块的交易费率样本
+type blockFeeRates struct {
+	hash  string
+	rates []decimal.Decimal
+}
+
+func (p *blockStatsFeeRateProvider) Name() string {
+	return FeeRateSourceBlockStats
+}
+
+func (p *blockStatsFeeRateProvider) FeeRate() (decimal.Decimal, error) {
+
+	var (
+		client  = p.wm.WalletClient
+		samples = make([]decimal.Decimal, 0)
+		recent  = make(map[uint64]*blockFeeRates)
+	)
+
+	height, err := client.getBlockHeight()
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i := uint64(0); i < uint64(p.wm.Config.FeeRateBlocks) && i <= height && len(samples) < p.wm.Config.FeeRateSamples; i++ {
+
+		hash, err := client.getBlockHash(height - i)
+		if err != nil {
+			return decimal.Zero, err
+		}
+
+		block, ok := p.cache[height-i]
+		if !ok || block.hash != hash {
+			rates, err := p.blockFeeRates(hash, p.wm.Config.FeeRateSamples)
+			if err != nil {
+				return decimal.Zero, err
+			}
+			block = &blockFeeRates{hash: hash, rates: rates}
+		}
+		recent[height-i] = block
+
+		for _, rate := range block.rates {
+			if len(samples) >= p.wm.Config.FeeRateSamples {
+				break
+			}
+			samples = append(samples, rate)
+		}
+	}
+
+	//只保留最近区块的缓存
+	p.cache = recent
+
+	if len(samples) == 0 {
+		return decimal.Zero, fmt.Errorf("there is no transaction fee in recent %d blocks", p.wm.Config.FeeRateBlocks)
+	}
+
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].LessThan(samples[j])
+	})
+
+	return samples[len(samples)/2], nil
+}
+
+//blockFeeRates 统计区块中最多limit笔交易的每KB手续费，交易及其前置交易都批量获取
+func (p *blockStatsFeeRateProvider) blockFeeRates(hash string, limit int) ([]decimal.Decimal, error) {
+
+	client := p.wm.WalletClient
+
+	block, err := client.getBlockWithTransactions(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	trxs := block.txDetails
+	if len(trxs) != len(block.tx) {
+		trxs, _ = client.getTransactions(block.tx)
+	}
+
+	sampled := make([]*Transaction, 0)
+	for _, tx := range trxs {
+		if len(sampled) >= limit {
+			break
+		}
+		if tx == nil || tx.IsCoinBase || tx.Size == 0 || len(tx.Vins) == 0 {
+			continue
+		}
+		sampled = append(sampled, tx)
+	}
+
+	//补全输入的前置输出金额
+	p.wm.Blockscanner.fillTxInputs(sampled)
+
+	rates := make([]decimal.Decimal, 0, len(sampled))
+	for _, tx := range sampled {
+		if feeRate, ok := p.transactionFeeRate(tx); ok {
+			rates = append(rates, feeRate)
+		}
+	}
+	return rates, nil
+}
+
+//transactionFeeRate 交易的每KB手续费，手续费 = ELA输入总额 - ELA输出总额，前置输出未知时跳过
+func (p *blockStatsFeeRateProvider) transactionFeeRate(tx *Transaction) (decimal.Decimal, bool) {
+
+	fees := decimal.Zero
+	for _, vin := range tx.Vins {
+		if len(vin.Value) == 0 {
+			return decimal.Zero, false
+		}
+		if vin.AssetID == elastosTransaction.AssetID_ELA {
+			value, _ := decimal.NewFromString(vin.Value)
+			fees = fees.Add(value)
+		}
+	}
+	for _, vout := range tx.Vouts {
+		if vout.AssetID == elastosTransaction.AssetID_ELA {
+			value, _ := decimal.NewFromString(vout.Value)
+			fees = fees.Sub(value)
+		}
+	}
+
+	if !fees.IsPositive() {
+		return decimal.Zero, false
+	}
+
+	return fees.Mul(decimal.New(1000, 0)).Div(decimal.New(int64(tx.Size), 0)).Round(p.wm.Decimal()), true
+}
+
+//configMinRelayFeeRateProvider 配置minRelayFeeRate给出的静态费率下限。
+//节点没有提供查询最低转发费率的接口，不会访问节点，配置值需要与节点的配置保持一致
+type configMinRelayFeeRateProvider struct {
+	wm *WalletManager
+}
+
+func (p *configMinRelayFeeRateProvider) Name() string {
+	return FeeRateSourceMinRelay
+}
+
+func (p *configMinRelayFeeRateProvider) FeeRate() (decimal.Decimal, error) {
+	return parseFeeRateConfig("minRelayFeeRate", p.wm.Config.MinRelayFeeRate)
+}
+
+//defaultFeeRateProvider 配置的默认费率
+type defaultFeeRateProvider struct {
+	wm *WalletManager
+}
+
+func (p *defaultFeeRateProvider) Name() string {
+	return FeeRateSourceDefault
+}
+
+func (p *defaultFeeRateProvider) FeeRate() (decimal.Decimal, error) {
+	return parseFeeRateConfig("defaultFeeRate", p.wm.Config.DefaultFeeRate)
+}
+
+func parseFeeRateConfig(name, value string) (decimal.Decimal, error) {
+	feeRate, err := decimal.NewFromString(value)
+	if err != nil || !feeRate.IsPositive() {
+		return decimal.Zero, fmt.Errorf("%s: %s is invalid", name, value)
+	}
+	return feeRate, nil
+}
+
+//RegisterFeeRateProvider 注册手续费率来源，同名来源会被替换
+func (wm *WalletManager) RegisterFeeRateProvider(provider FeeRateProvider) {
+	wm.FeeRateProviders[provider.Name()] = provider
+}
+
+//FeeRateEstimate 费率估算结果
+type FeeRateEstimate struct {
+	FeeRate decimal.Decimal //每KB的手续费率
+	Source  string          //给出费率的来源
+	//来源给出的费率低于配置的最低转发费率，FeeRate已提高到最低转发费率
+	MinRelayApplied bool
+}
+
+//EstimateFeeRateWithSource 按配置的来源顺序获取费率，前一个失败时使用下一个。
+//费率低于配置的最低转发费率minRelayFeeRate时，使用最低转发费率，来源仍是给出费率的来源。
+func (wm *WalletManager) EstimateFeeRateWithSource() (*FeeRateEstimate, error) {
+
+	var (
+		estimate *FeeRateEstimate
+		errs     = make([]string, 0)
+	)
+
+	for _, name := range wm.Config.FeeRateSources {
+		provider, ok := wm.FeeRateProviders[name]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("%s: not supported", name))
+			continue
+		}
+		rate, err := provider.FeeRate()
+		if err != nil {
+			wm.Log.Debugf("fee rate source: %s failed, %v", name, err)
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		estimate = &FeeRateEstimate{FeeRate: rate, Source: name}
+		break
+	}
+
+	if estimate == nil {
+		return nil, fmt.Errorf("all fee rate sources failed, %s", strings.Join(errs, "; "))
+	}
+
+	if minRelay, err := parseFeeRateConfig("minRelayFeeRate", wm.Config.MinRelayFeeRate); err == nil && estimate.FeeRate.LessThan(minRelay) {
+		wm.Log.Debugf("fee rate: %s of source: %s is lower than min relay fee rate: %s", estimate.FeeRate.String(), estimate.Source, minRelay.String())
+		estimate.FeeRate = minRelay
+		estimate.MinRelayApplied = true
+	}
+
+	return estimate, nil
+}
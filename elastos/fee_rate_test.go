@@ -0,0 +1,267 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package elastos
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/astaxie/beego/config"
+	"github.com/blocktree/go-owcdrivers/elastosTransaction"
+	"github.com/shopspring/decimal"
+	"github.com/tidwall/gjson"
+)
+
+//testFeeTx 模拟的交易单，输入引用的前置交易输出金额为inputs
+type testFeeTx struct {
+	txType int
+	size   int
+	inputs []string
+	output string
+}
+
+//newTestFeeRateNode 创建模拟的节点，blocks按高度从低到高排列，每个区块包含的交易单id，calls记录每个方法的调用次数
+func newTestFeeRateNode(t *testing.T, smartFee interface{}, blocks [][]string, txs map[string]testFeeTx) (*WalletManager, *httptest.Server, map[string]int) {
+
+	rawTxs := make(map[string]interface{})
+	for txid, tx := range txs {
+		vins := make([]map[string]interface{}, 0)
+		for i, amount := range tx.inputs {
+			prevID := fmt.Sprintf("%s-prev-%d", txid, i)
+			rawTxs[prevID] = map[string]interface{}{
+				"txid": prevID,
+				"type": 2,
+				"vout": []map[string]interface{}{{"assetid": elastosTransaction.AssetID_ELA, "value": amount, "n": 0}},
+			}
+			vins = append(vins, map[string]interface{}{"txid": prevID, "vout": 0})
+		}
+		rawTxs[txid] = map[string]interface{}{
+			"txid": txid,
+			"type": tx.txType,
+			"size": tx.size,
+			"vin":  vins,
+			"vout": []map[string]interface{}{{"assetid": elastosTransaction.AssetID_ELA, "value": tx.output, "n": 0}},
+		}
+	}
+
+	handlers := map[string]testNodeHandler{
+		"estimatesmartfee": func(params gjson.Result) (interface{}, error) {
+			if smartFee == nil {
+				return nil, errors.New("method not found")
+			}
+			return smartFee, nil
+		},
+		"getblockcount": func(params gjson.Result) (interface{}, error) {
+			return len(blocks), nil
+		},
+		"getblockhash": func(params gjson.Result) (interface{}, error) {
+			return fmt.Sprintf("block-%d", params.Array()[0].Int()), nil
+		},
+		"getblock": func(params gjson.Result) (interface{}, error) {
+			var height int
+			fmt.Sscanf(params.Array()[0].String(), "block-%d", &height)
+			return map[string]interface{}{"hash": params.Array()[0].String(), "height": height, "tx": blocks[height]}, nil
+		},
+		"getrawtransaction": func(params gjson.Result) (interface{}, error) {
+			tx, ok := rawTxs[params.Array()[0].String()]
+			if !ok {
+				return nil, errors.New("unknown transaction")
+			}
+			return tx, nil
+		},
+	}
+
+	calls := make(map[string]int)
+	for method, handler := range handlers {
+		method, handler := method, handler
+		handlers[method] = func(params gjson.Result) (interface{}, error) {
+			calls[method]++
+			return handler(params)
+		}
+	}
+	node := newTestNode(t, handlers)
+
+	return newTestWalletManager(t, node.URL), node, calls
+}
+
+func TestFeeRateProvider_BlockStats(t *testing.T) {
+
+	blocks := [][]string{
+		{"coinbase0", "tx3"},
+		{"coinbase1", "tx1", "tx2"},
+	}
+	txs := map[string]testFeeTx{
+		"coinbase0": {txType: 0, size: 100, output: "5"},
+		"coinbase1": {txType: 0, size: 100, output: "5"},
+		//0.0001 / 250B = 0.0004/KB
+		"tx1": {txType: 2, size: 250, inputs: []string{"0.6", "0.4"}, output: "0.9999"},
+		//0.0005 / 500B = 0.001/KB
+		"tx2": {txType: 2, size: 500, inputs: []string{"1"}, output: "0.9995"},
+		//0.00002 / 200B = 0.0001/KB
+		"tx3": {txType: 2, size: 200, inputs: []string{"2"}, output: "1.99998"},
+	}
+
+	wm, node, calls := newTestFeeRateNode(t, nil, blocks, txs)
+	defer node.Close()
+
+	feeRate, err := wm.FeeRateProviders[FeeRateSourceBlockStats].FeeRate()
+	if err != nil {
+		t.Fatalf("blockStats FeeRate failed unexpected error: %v", err)
+	}
+	if !feeRate.Equal(decimal.RequireFromString("0.0004")) {
+		t.Errorf("blockStats fee rate = %s, expected = 0.0004", feeRate.String())
+	}
+
+	//区块没有变化时使用缓存的样本，不再获取交易单
+	fetched := calls["getrawtransaction"]
+	feeRate, err = wm.FeeRateProviders[FeeRateSourceBlockStats].FeeRate()
+	if err != nil || !feeRate.Equal(decimal.RequireFromString("0.0004")) {
+		t.Errorf("blockStats cached fee rate = %s, error = %v", feeRate.String(), err)
+	}
+	if calls["getrawtransaction"] != fetched || calls["getblock"] != len(blocks) {
+		t.Errorf("blockStats cached fee rate getrawtransaction calls: %d, getblock calls: %d", calls["getrawtransaction"]-fetched, calls["getblock"])
+	}
+
+	//只统计最近1个区块
+	wm.Config.FeeRateBlocks = 1
+	wm.Config.FeeRateSamples = 1
+	feeRate, err = wm.FeeRateProviders[FeeRateSourceBlockStats].FeeRate()
+	if err != nil {
+		t.Fatalf("blockStats FeeRate failed unexpected error: %v", err)
+	}
+	if !feeRate.Equal(decimal.RequireFromString("0.0004")) {
+		t.Errorf("blockStats fee rate = %s, expected = 0.0004", feeRate.String())
+	}
+
+	//区块中只有coinbase交易
+	empty, emptyNode, _ := newTestFeeRateNode(t, nil, [][]string{{"coinbase0"}}, txs)
+	defer emptyNode.Close()
+	if _, err := empty.FeeRateProviders[FeeRateSourceBlockStats].FeeRate(); err == nil {
+		t.Errorf("blockStats FeeRate without transactions should be failed")
+	}
+}
+
+func TestWalletManager_EstimateFeeRateWithSource(t *testing.T) {
+
+	blocks := [][]string{{"coinbase0", "tx1"}}
+	txs := map[string]testFeeTx{
+		"coinbase0": {txType: 0, size: 100, output: "5"},
+		"tx1":       {txType: 2, size: 250, inputs: []string{"1"}, output: "0.9999"},
+	}
+
+	tests := []struct {
+		name     string
+		smartFee interface{}
+		blocks   [][]string
+		sources  []string
+		feeRate  string
+		source   string
+		minRelay bool
+	}{
+		//节点支持estimatesmartfee，单位为sela
+		{"node", 20000, blocks, []string{FeeRateSourceNode, FeeRateSourceBlockStats, FeeRateSourceDefault}, "0.0002", FeeRateSourceNode, false},
+		//节点不支持estimatesmartfee，回退到区块统计
+		{"blockStats", nil, blocks, []string{FeeRateSourceNode, FeeRateSourceBlockStats, FeeRateSourceDefault}, "0.0004", FeeRateSourceBlockStats, false},
+		//默认配置不使用节点
+		{"default sources", 20000, blocks, NewConfig(Symbol, CurveType, Decimals).FeeRateSources, "0.0004", FeeRateSourceBlockStats, false},
+		//区块中没有交易，回退到默认费率
+		{"default", nil, [][]string{{"coinbase0"}}, []string{FeeRateSourceNode, FeeRateSourceBlockStats, FeeRateSourceDefault}, "0.0001", FeeRateSourceDefault, false},
+		//低于最低转发费率，来源仍是节点
+		{"minRelay floor", 100, blocks, []string{FeeRateSourceNode}, "0.00001", FeeRateSourceNode, true},
+		{"minRelay", nil, blocks, []string{FeeRateSourceMinRelay}, "0.00001", FeeRateSourceMinRelay, false},
+		//未知来源被跳过
+		{"unknown", nil, blocks, []string{"unknown", FeeRateSourceDefault}, "0.0001", FeeRateSourceDefault, false},
+	}
+
+	for _, test := range tests {
+		wm, node, _ := newTestFeeRateNode(t, test.smartFee, test.blocks, txs)
+		wm.Config.FeeRateSources = test.sources
+
+		estimate, err := wm.EstimateFeeRateWithSource()
+		if err != nil {
+			t.Errorf("%s: EstimateFeeRateWithSource failed unexpected error: %v", test.name, err)
+		} else {
+			if !estimate.FeeRate.Equal(decimal.RequireFromString(test.feeRate)) {
+				t.Errorf("%s: fee rate = %s, expected = %s", test.name, estimate.FeeRate.String(), test.feeRate)
+			}
+			if estimate.Source != test.source || estimate.MinRelayApplied != test.minRelay {
+				t.Errorf("%s: source = %s, min relay applied = %v, expected = %s, %v", test.name, estimate.Source, estimate.MinRelayApplied, test.source, test.minRelay)
+			}
+		}
+
+		decoder := wm.TxDecoder.(*TransactionDecoder)
+		rate, unit, source, err := decoder.GetRawTransactionFeeRateWithSource()
+		if err != nil {
+			t.Errorf("%s: GetRawTransactionFeeRateWithSource failed unexpected error: %v", test.name, err)
+		} else if !decimal.RequireFromString(rate).Equal(decimal.RequireFromString(test.feeRate)) || unit != "K" || source != test.source {
+			t.Errorf("%s: GetRawTransactionFeeRateWithSource = %s/%s %s, expected = %s/K %s", test.name, rate, unit, source, test.feeRate, test.source)
+		}
+
+		node.Close()
+	}
+
+	//所有来源都失败
+	wm, node, _ := newTestFeeRateNode(t, nil, [][]string{{"coinbase0"}}, txs)
+	defer node.Close()
+	wm.Config.FeeRateSources = []string{FeeRateSourceNode, FeeRateSourceBlockStats}
+	if _, err := wm.EstimateFeeRateWithSource(); err == nil {
+		t.Errorf("EstimateFeeRateWithSource should be failed when all sources failed")
+	} else {
+		t.Logf("EstimateFeeRateWithSource error: %v", err)
+	}
+}
+
+func TestWalletManager_LoadFeeRateConfig(t *testing.T) {
+
+	//minRelay来源只读取配置，不访问节点
+	node := newTestNode(t, map[string]testNodeHandler{})
+	defer node.Close()
+
+	dataDir, err := ioutil.TempDir(testDataDir, "data")
+	if err != nil {
+		t.Fatalf("create data dir failed unexpected error: %v", err)
+	}
+	c, err := config.NewConfigData("ini", []byte(fmt.Sprintf("serverAPI = %s\ndataDir = %s\n"+
+		"feeRateSources = minRelay, default\nminRelayFeeRate = 0.00002\nfeeRateBlocks = 3\nfeeRateSamples = 20\n",
+		node.URL, filepath.Join(dataDir, "data"))))
+	if err != nil {
+		t.Fatalf("NewConfigData failed unexpected error: %v", err)
+	}
+
+	wm := NewWalletManager()
+	if err := wm.LoadAssetsConfig(c); err != nil {
+		t.Fatalf("LoadAssetsConfig failed unexpected error: %v", err)
+	}
+	if len(wm.Config.FeeRateSources) != 2 || wm.Config.FeeRateSources[0] != FeeRateSourceMinRelay || wm.Config.FeeRateSources[1] != FeeRateSourceDefault {
+		t.Errorf("feeRateSources = %v, expected = [%s %s]", wm.Config.FeeRateSources, FeeRateSourceMinRelay, FeeRateSourceDefault)
+	}
+	if wm.Config.MinRelayFeeRate != "0.00002" || wm.Config.FeeRateBlocks != 3 || wm.Config.FeeRateSamples != 20 {
+		t.Errorf("minRelayFeeRate = %s, feeRateBlocks = %d, feeRateSamples = %d, expected = 0.00002, 3, 20",
+			wm.Config.MinRelayFeeRate, wm.Config.FeeRateBlocks, wm.Config.FeeRateSamples)
+	}
+
+	estimate, err := wm.EstimateFeeRateWithSource()
+	if err != nil {
+		t.Fatalf("EstimateFeeRateWithSource failed unexpected error: %v", err)
+	}
+	if !estimate.FeeRate.Equal(decimal.RequireFromString("0.00002")) || estimate.Source != FeeRateSourceMinRelay {
+		t.Errorf("fee rate = %s, source = %s, expected = 0.00002, %s", estimate.FeeRate.String(), estimate.Source, FeeRateSourceMinRelay)
+	}
+}
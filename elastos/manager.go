@@ -17,7 +17,9 @@ package elastos
 
 import (
 	"math"
+	"sync"
 
+	"github.com/blocktree/go-owcdrivers/elastosTransaction"
 	"github.com/blocktree/openwallet/hdkeystore"
 	"github.com/blocktree/openwallet/log"
 	"github.com/blocktree/openwallet/openwallet"
@@ -36,6 +38,12 @@ type WalletManager struct {
 	TxDecoder       openwallet.TransactionDecoder //交易单编码器
 	Log             *log.OWLogger                 //日志工具
 	ContractDecoder openwallet.SmartContractDecoder
+	//手续费率来源
+	FeeRateProviders map[string]FeeRateProvider
+	//utxo锁定表的读写锁
+	unspentLockMu sync.Mutex
+	//资产信息缓存的读写锁
+	assetMu sync.Mutex
 }
 
 func NewWalletManager() *WalletManager {
@@ -51,11 +59,36 @@ func NewWalletManager() *WalletManager {
 	wm.TxDecoder = NewTransactionDecoder(&wm)
 	wm.Log = log.NewOWLogger(wm.Symbol())
 	wm.ContractDecoder = NewContractDecoder(&wm)
+	wm.FeeRateProviders = make(map[string]FeeRateProvider)
+	wm.RegisterFeeRateProvider(&nodeFeeRateProvider{wm: &wm})
+	wm.RegisterFeeRateProvider(&blockStatsFeeRateProvider{wm: &wm})
+	wm.RegisterFeeRateProvider(&configMinRelayFeeRateProvider{wm: &wm})
+	wm.RegisterFeeRateProvider(&defaultFeeRateProvider{wm: &wm})
 	return &wm
 }
 
-//ListUnspent 获取未花记录
+//ListUnspent 获取ELA的未花记录
 func (wm *WalletManager) ListUnspent(min uint64, addresses ...string) ([]*Unspent, error) {
+	return wm.ListAssetUnspent(elastosTransaction.AssetID_ELA, min, addresses...)
+}
+
+//ListAssetUnspent 获取指定资产的未花记录
+func (wm *WalletManager) ListAssetUnspent(assetID string, min uint64, addresses ...string) ([]*Unspent, error) {
+	utxos, err := wm.listAllUnspent(min, addresses...)
+	if err != nil {
+		return nil, err
+	}
+	assetUTXOs := make([]*Unspent, 0, len(utxos))
+	for _, u := range utxos {
+		if u.AssetID == assetID {
+			assetUTXOs = append(assetUTXOs, u)
+		}
+	}
+	return assetUTXOs, nil
+}
+
+//listAllUnspent 获取所有资产的未花记录
+func (wm *WalletManager) listAllUnspent(min uint64, addresses ...string) ([]*Unspent, error) {
 
 	//:分页限制
 
@@ -89,15 +122,56 @@ func (wm *WalletManager) ListUnspent(min uint64, addresses ...string) ([]*Unspen
 
 		utxo = append(utxo, pice...)
 	}
+
+	if err := wm.markLockedUnspents(utxo); err != nil {
+		return nil, err
+	}
+
 	return utxo, nil
 }
 
+//markLockedUnspents 标记输出锁定及未成熟的coinbase为不可花费，有输出锁定时才查询区块高度
+func (wm *WalletManager) markLockedUnspents(utxos []*Unspent) error {
+
+	var (
+		height    uint64
+		hasHeight = false
+	)
+
+	for _, u := range utxos {
+		if u.IsCoinBase && u.Confirmations < CoinbaseMaturity {
+			u.Locked = true
+		}
+
+		if u.OutputLock > 0 {
+			if !hasHeight {
+				h, err := wm.WalletClient.getBlockHeight()
+				if err != nil {
+					return err
+				}
+				height = h
+				hasHeight = true
+			}
+			//交易单的LockTime要达到输出锁定高度，并且不超过当前高度
+			if u.OutputLock > height {
+				u.Locked = true
+			}
+		}
+
+		if u.Locked {
+			u.Spendable = false
+		}
+	}
+
+	return nil
+}
+
 //SendRawTransaction 广播交易
 func (wm *WalletManager) SendRawTransaction(txHex string) (string, error) {
 	return wm.WalletClient.sendRawTransaction(txHex)
 }
 
-//EstimateFee 预估手续费
+//EstimateFee 预估手续费，sigs为输入的标准地址数量
 func (wm *WalletManager) EstimateFee(inputs, outputs, sigs int64, feeRate decimal.Decimal) (decimal.Decimal, error) {
 
 	var piece int64 = 1
@@ -107,16 +181,25 @@ func (wm *WalletManager) EstimateFee(inputs, outputs, sigs int64, feeRate decima
 		piece = int64(math.Ceil(float64(inputs) / float64(wm.Config.MaxTxInputs)))
 	}
 
-	//计算公式如下：148 * 输入数额 + 34 * 输出数额 + 10
-	trx_bytes := decimal.New(inputs*38+outputs*65+piece*10+sigs*102, 0)
-	trx_fee := trx_bytes.Div(decimal.New(1000, 0)).Mul(feeRate)
-	trx_fee = trx_fee.Round(wm.Decimal())
-	//是否低于最小手续费
+	//每笔交易单：交易类型 + 载荷版本 + 属性数量 + 锁定时间 + 输入输出及解锁脚本的数量
+	trx_bytes := piece * (1 + 1 + 1 + 4)
+	trx_bytes += int64(len(writeVarUint(uint64(inputs))) + len(writeVarUint(uint64(outputs))) + len(writeVarUint(uint64(sigs))))
+	trx_bytes += inputs*TxInputSize + outputs*TxOutputSize + sigs*int64(programSize(1, 1))
 
-	return trx_fee, nil
+	return wm.CalculateFee(trx_bytes, feeRate), nil
 }
 
-//EstimateFeeRate 预估的没KB手续费率
+//CalculateFee 按交易单字节数及每KB费率计算手续费，不足1聪的部分向上取整
+func (wm *WalletManager) CalculateFee(size int64, feeRate decimal.Decimal) decimal.Decimal {
+	trx_fee := decimal.New(size, 0).Div(decimal.New(1000, 0)).Mul(feeRate)
+	return trx_fee.Shift(wm.Decimal()).Ceil().Shift(-wm.Decimal())
+}
+
+//EstimateFeeRate 预估的没KB手续费率，按配置的来源顺序获取
 func (wm *WalletManager) EstimateFeeRate() (decimal.Decimal, error) {
-	return wm.WalletClient.estimateFeeRate()
+	estimate, err := wm.EstimateFeeRateWithSource()
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return estimate.FeeRate, nil
 }
@@ -16,7 +16,9 @@
 package elastos
 
 import (
+	"io/ioutil"
 	"math"
+	"os"
 	"testing"
 
 	"github.com/codeskyblue/go-sh"
@@ -24,8 +26,21 @@ import (
 
 var (
 	tw *WalletManager
+	//测试数据库的临时目录
+	testDataDir string
 )
 
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "elastos-adapter-test")
+	if err != nil {
+		panic(err)
+	}
+	testDataDir = dir
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 func init() {
 	tw = NewWalletManager()
 	tw.Config.ServerAPI = "http://127.0.0.1:20336"
@@ -16,7 +16,9 @@
 package elastos
 
 import (
+	"encoding/hex"
 	"fmt"
+	"time"
 
 	"github.com/blocktree/openwallet/crypto"
 	"github.com/blocktree/openwallet/openwallet"
@@ -69,6 +71,7 @@ type Unspent struct {
 		    }
 	*/
 	Key     string `storm:"id"`
+	AssetID string `json:"assetid"`
 	TxID    string `json:"txid"`
 	Vout    uint64 `json:"vout"`
 	Address string `json:"address"`
@@ -78,12 +81,16 @@ type Unspent struct {
 	Confirmations uint64 `json:"confirmations"`
 	Spendable     bool   `json:"spendable"`
 	Solvable      bool   `json:"solvable"`
+	OutputLock    uint64 `json:"outputlock"` //输出锁定的区块高度，到达该高度前不能花费
+	IsCoinBase    bool   `json:"coinbase"`   //coinbase输出，确认数达到CoinbaseMaturity前不能花费
+	Locked        bool   `json:"locked"`     //输出锁定或coinbase未成熟
 	HDAddress     openwallet.Address
 }
 
 func NewUnspent(json *gjson.Result) *Unspent {
 	obj := &Unspent{}
 	//解析json
+	obj.AssetID = gjson.Get(json.Raw, "assetid").String()
 	obj.TxID = gjson.Get(json.Raw, "txid").String()
 	obj.Vout = gjson.Get(json.Raw, "vout").Uint()
 	obj.Address = gjson.Get(json.Raw, "address").String()
@@ -94,6 +101,11 @@ func NewUnspent(json *gjson.Result) *Unspent {
 	//obj.Spendable = gjson.Get(json.Raw, "spendable").Bool()
 	obj.Spendable = true
 	obj.Solvable = gjson.Get(json.Raw, "solvable").Bool()
+	obj.OutputLock = gjson.Get(json.Raw, "outputlock").Uint()
+	//节点没有返回txtype时不能判断是否coinbase
+	if txType := gjson.Get(json.Raw, "txtype"); txType.Exists() {
+		obj.IsCoinBase = txType.Int() == int64(TxTypeCoinBase)
+	}
 
 	return obj
 }
@@ -146,10 +158,19 @@ func (c *Client) NewBlock(json *gjson.Result) *Block {
 	obj.Version = gjson.Get(json.Raw, "version").Uint()
 	obj.Time = gjson.Get(json.Raw, "time").Uint()
 
+	//verbosity为2时，tx为交易详情
 	txs := make([]string, 0)
 	txDetails := make([]*Transaction, 0)
 	for _, tx := range gjson.Get(json.Raw, "tx").Array() {
-		txs = append(txs, tx.String())
+		if !tx.IsObject() {
+			txs = append(txs, tx.String())
+			continue
+		}
+		trx := c.newTx(&tx)
+		trx.BlockHeight = obj.Height
+		trx.BlockHash = obj.Hash
+		txs = append(txs, trx.TxID)
+		txDetails = append(txDetails, trx)
 	}
 
 	obj.tx = txs
@@ -192,22 +213,204 @@ func NewUnscanRecord(height uint64, txID, reason string) *UnscanRecord {
 	return &obj
 }
 
+//UnspentLock 已被未广播的交易单选用的utxo
+type UnspentLock struct {
+	Key       string `storm:"id"` //txid_vout
+	TxID      string
+	Vout      uint64
+	Address   string
+	LockID    string `storm:"index"` //锁定utxo的交易单id
+	LockedAt  int64
+	ExpiredAt int64
+}
+
+func NewUnspentLock(utxo *Unspent, lockID string, expiration time.Duration) *UnspentLock {
+	now := time.Now()
+	obj := UnspentLock{}
+	obj.Key = unspentKey(utxo.TxID, utxo.Vout)
+	obj.TxID = utxo.TxID
+	obj.Vout = utxo.Vout
+	obj.Address = utxo.Address
+	obj.LockID = lockID
+	obj.LockedAt = now.Unix()
+	obj.ExpiredAt = now.Add(expiration).Unix()
+	return &obj
+}
+
+//IsExpired 锁定是否已过期
+func (lock *UnspentLock) IsExpired() bool {
+	return time.Now().Unix() >= lock.ExpiredAt
+}
+
+//LockedBalance 地址被输出锁定及未成熟coinbase占用的余额，不计入可用余额
+type LockedBalance struct {
+	Symbol  string
+	Address string
+	Balance string
+}
+
+//unspentKey utxo的唯一标识
+func unspentKey(txid string, vout uint64) string {
+	return fmt.Sprintf("%s_%d", txid, vout)
+}
+
+//AssetInfo 资产信息，来自资产注册交易，资产ID即注册交易的txid
+type AssetInfo struct {
+	AssetID     string `storm:"id"`
+	Name        string
+	Description string
+	Precision   int32
+	AssetType   int64
+	RecordType  int64
+	Amount      string
+	Controller  string
+}
+
+//NewAssetInfo 解析资产注册交易的payload
+func NewAssetInfo(assetID string, payload *gjson.Result) *AssetInfo {
+	//节点不同版本的payload字段有大小写差异
+	get := func(paths ...string) gjson.Result {
+		for _, path := range paths {
+			if r := payload.Get(path); r.Exists() {
+				return r
+			}
+		}
+		return gjson.Result{}
+	}
+	obj := AssetInfo{}
+	obj.AssetID = assetID
+	obj.Name = get("asset.name", "Asset.Name").String()
+	obj.Description = get("asset.description", "Asset.Description").String()
+	obj.Precision = int32(get("asset.precision", "Asset.Precision").Int())
+	obj.AssetType = get("asset.assettype", "Asset.AssetType").Int()
+	obj.RecordType = get("asset.recordtype", "Asset.RecordType").Int()
+	obj.Amount = get("amount", "Amount").String()
+	obj.Controller = get("controller", "Controller").String()
+	return &obj
+}
+
+//Producer 超级节点，Votes为获得的票数（ELA）
+type Producer struct {
+	OwnerPublicKey string
+	NodePublicKey  string
+	Nickname       string
+	URL            string
+	Location       uint64
+	Active         bool
+	Votes          string
+	State          string
+	RegisterHeight uint64
+	CancelHeight   uint64
+	InactiveHeight uint64
+	IllegalHeight  uint64
+	Index          uint64
+}
+
+//NewProducer 解析listproducers返回的超级节点
+func NewProducer(json *gjson.Result) *Producer {
+	obj := Producer{}
+	obj.OwnerPublicKey = json.Get("ownerpublickey").String()
+	obj.NodePublicKey = json.Get("nodepublickey").String()
+	obj.Nickname = json.Get("nickname").String()
+	obj.URL = json.Get("url").String()
+	obj.Location = json.Get("location").Uint()
+	obj.Active = json.Get("active").Bool()
+	obj.Votes = json.Get("votes").String()
+	obj.State = json.Get("state").String()
+	obj.RegisterHeight = json.Get("registerheight").Uint()
+	obj.CancelHeight = json.Get("cancelheight").Uint()
+	obj.InactiveHeight = json.Get("inactiveheight").Uint()
+	obj.IllegalHeight = json.Get("illegalheight").Uint()
+	obj.Index = json.Get("index").Uint()
+	return &obj
+}
+
+//ProducerList 超级节点分页列表，TotalVotes及TotalCounts为所有超级节点的合计
+type ProducerList struct {
+	Producers   []*Producer
+	TotalVotes  string
+	TotalCounts uint64
+}
+
+//NewProducerList 解析listproducers的结果
+func NewProducerList(json *gjson.Result) *ProducerList {
+	obj := ProducerList{Producers: make([]*Producer, 0)}
+	for _, p := range json.Get("producers").Array() {
+		obj.Producers = append(obj.Producers, NewProducer(&p))
+	}
+	obj.TotalVotes = json.Get("totalvotes").String()
+	obj.TotalCounts = json.Get("totalcounts").Uint()
+	return &obj
+}
+
+//VoteStatus 地址的投票状态，Total为地址的余额，Voting为已投票的金额，Pending表示有未确认的投票交易
+type VoteStatus struct {
+	Address string
+	Total   string
+	Voting  string
+	Pending bool
+}
+
+//NewVoteStatus 解析votestatus的结果
+func NewVoteStatus(address string, json *gjson.Result) *VoteStatus {
+	obj := VoteStatus{}
+	obj.Address = address
+	obj.Total = json.Get("total").String()
+	obj.Voting = json.Get("voting").String()
+	obj.Pending = json.Get("pending").Bool()
+	return &obj
+}
+
+//ArbitratorsInfo 当前及下一轮的仲裁人和候选人公钥
+type ArbitratorsInfo struct {
+	Arbitrators            []string
+	Candidates             []string
+	NextArbitrators        []string
+	NextCandidates         []string
+	OnDutyArbitrator       string
+	CurrentTurnStartHeight uint64
+	NextTurnStartHeight    uint64
+}
+
+//NewArbitratorsInfo 解析getarbitratorsinfo的结果
+func NewArbitratorsInfo(json *gjson.Result) *ArbitratorsInfo {
+	array := func(path string) []string {
+		arr := make([]string, 0)
+		for _, s := range json.Get(path).Array() {
+			arr = append(arr, s.String())
+		}
+		return arr
+	}
+	obj := ArbitratorsInfo{}
+	obj.Arbitrators = array("arbitrators")
+	obj.Candidates = array("candidates")
+	obj.NextArbitrators = array("nextarbitrators")
+	obj.NextCandidates = array("nextcandidates")
+	obj.OnDutyArbitrator = json.Get("ondutyarbitrator").String()
+	obj.CurrentTurnStartHeight = json.Get("currentturnstartheight").Uint()
+	obj.NextTurnStartHeight = json.Get("nextturnstartheight").Uint()
+	return &obj
+}
+
 type Transaction struct {
-	TxID          string
-	Size          uint64
-	Version       uint64
-	LockTime      int64
-	Hex           string
-	BlockHash     string
-	BlockHeight   uint64
-	Confirmations uint64
-	Blocktime     int64
-	IsCoinBase    bool
-	Fees          string
-	Decimals      int32
-	Type          int32
-	Vins          []*Vin
-	Vouts         []*Vout
+	TxID           string
+	Size           uint64
+	Version        uint64
+	LockTime       int64
+	Hex            string
+	BlockHash      string
+	BlockHeight    uint64
+	Confirmations  uint64
+	Blocktime      int64
+	IsCoinBase     bool
+	Fees           string
+	Decimals       int32
+	Type           int32
+	PayloadVersion int32
+	Payload        string //payload的json
+	Memo           string //备注属性的内容
+	Vins           []*Vin
+	Vouts          []*Vout
 }
 
 type Vin struct {
@@ -217,6 +420,7 @@ type Vin struct {
 	N        uint64
 	Addr     string
 	Value    string
+	AssetID  string //前置输出的资产ID
 }
 
 type Vout struct {
@@ -239,6 +443,19 @@ func (c *Client) newTx(json *gjson.Result) *Transaction {
 	obj.Blocktime = gjson.Get(json.Raw, "blocktime").Int()
 	obj.Size = gjson.Get(json.Raw, "size").Uint()
 	obj.Type = int32(gjson.Get(json.Raw, "type").Int())
+	obj.PayloadVersion = int32(gjson.Get(json.Raw, "payloadversion").Int())
+	obj.Payload = gjson.Get(json.Raw, "payload").Raw
+	//属性的data为hex编码，多个备注属性按顺序拼接
+	for _, attr := range gjson.Get(json.Raw, "attributes").Array() {
+		if attr.Get("usage").Uint() != uint64(AttributeUsageMemo) {
+			continue
+		}
+		data, err := hex.DecodeString(attr.Get("data").String())
+		if err != nil {
+			continue
+		}
+		obj.Memo += string(data)
+	}
 	if obj.Type == 0 {
 		obj.IsCoinBase = true
 	}
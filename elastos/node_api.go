@@ -16,11 +16,20 @@
 package elastos
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/blocktree/go-owcdrivers/elastosTransaction"
 	"github.com/blocktree/openwallet/log"
 	"github.com/imroc/req"
 	"github.com/shopspring/decimal"
@@ -35,11 +44,67 @@ type ClientInterface interface {
 // request and responses. A Client must be configured with a secret token
 // to authenticate with other Cores on the network.
 type Client struct {
-	BaseURL string
-	// AccessToken string
-	Debug  bool
-	client *req.Req
+	BaseURL     string //当前使用的节点
+	AccessToken string //Basic认证的token，为空时不认证
+	Debug       bool
+	client      *req.Req
 	//Client *req.Req
+
+	//HealthCheckInterval 多个节点时，重新检查节点区块高度的间隔
+	HealthCheckInterval time.Duration
+	//Timeout 每次请求的超时时间，0为不限制
+	Timeout time.Duration
+	//MaxRetries 请求失败后的最大重试次数
+	MaxRetries int
+	//RetryBackoff 第一次重试的等待时间，之后每次加倍，不超过MaxRetryBackoff
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+	//RetryableCodes 可以重试的json-rpc错误码
+	RetryableCodes []int64
+	//BatchSize 批量请求每次发送的最大调用数量，0为不使用批量请求
+	BatchSize int
+
+	endpoints        []*nodeEndpoint
+	checkedAt        time.Time
+	mu               sync.RWMutex
+	batchUnsupported int32 //节点不支持批量请求时为1
+}
+
+//nonIdempotentMethods 重复执行会产生副作用的方法，只有确定请求未发送到节点时才重试
+var nonIdempotentMethods = map[string]bool{
+	"sendrawtransaction": true,
+}
+
+//rpcError 节点返回的json-rpc错误
+type rpcError struct {
+	Code    int64
+	Message string
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("[%d]%s", e.Code, e.Message)
+}
+
+//errBatchUnsupported 节点不支持json-rpc批量请求
+var errBatchUnsupported = errors.New("node does not support batch request")
+
+//batchRequest 批量请求中的一个调用
+type batchRequest struct {
+	Method string
+	Params interface{}
+}
+
+//batchResult 批量请求中一个调用的结果
+type batchResult struct {
+	Result *gjson.Result
+	Err    error
+}
+
+//nodeEndpoint 节点地址及最近一次健康检查的结果
+type nodeEndpoint struct {
+	URL     string
+	Height  uint64
+	Healthy bool
 }
 
 type Response struct {
@@ -50,48 +115,345 @@ type Response struct {
 	Id      string      `json:"id,omitempty"`
 }
 
+//NewClient 创建节点客户端，url可以是逗号分隔的多个节点，默认使用第一个
 func NewClient(url string, debug bool) *Client {
 	c := Client{
-		BaseURL: url,
 		//	AccessToken: token,
-		Debug: debug,
+		Debug:               debug,
+		HealthCheckInterval: DefaultHealthCheckInterval,
+		Timeout:             DefaultRPCTimeout,
+		MaxRetries:          DefaultRPCMaxRetries,
+		RetryBackoff:        DefaultRPCRetryBackoff,
+		MaxRetryBackoff:     DefaultRPCMaxRetryBackoff,
+		RetryableCodes:      []int64{RPCErrorCodeInternal},
+		BatchSize:           DefaultRPCBatchSize,
+	}
+
+	for _, u := range strings.Split(url, ",") {
+		if u = strings.TrimSpace(u); len(u) > 0 {
+			c.endpoints = append(c.endpoints, &nodeEndpoint{URL: u, Healthy: true})
+		}
+	}
+	if len(c.endpoints) > 0 {
+		c.BaseURL = c.endpoints[0].URL
 	}
 
 	api := req.New()
-	//trans, _ := api.Client().Transport.(*http.Transport)
-	//trans.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	//提前创建http客户端，req是在首次请求时创建，并发检查节点时会有竞争
+	api.Client()
 	c.client = api
 
 	return &c
 }
 
+//SetBasicAuth 设置节点的Basic认证账户，用户名为空时不认证
+func (c *Client) SetBasicAuth(username, password string) {
+	if len(username) == 0 {
+		c.AccessToken = ""
+		return
+	}
+	c.AccessToken = BasicAuth(username, password)
+}
+
+//SetTLSConfig 设置连接https节点使用的TLS配置，需在发送请求前设置
+func (c *Client) SetTLSConfig(tlsConfig *tls.Config) error {
+	trans, ok := c.client.Client().Transport.(*http.Transport)
+	if !ok {
+		return errors.New("http transport does not support TLS config")
+	}
+	trans.TLSClientConfig = tlsConfig
+	return nil
+}
+
 // Call calls a remote procedure on another node, specified by the path.
 func (c *Client) Call(path string, request []interface{}) (*gjson.Result, error) {
+	return c.call(path, request)
+}
 
-	var (
-		body = make(map[string]interface{}, 0)
-	)
+//CallContext 同Call，ctx取消时停止请求和重试
+func (c *Client) CallContext(ctx context.Context, path string, request []interface{}) (*gjson.Result, error) {
+	return c.callContext(ctx, path, request)
+}
+
+//activeURL 当前使用的节点
+func (c *Client) activeURL() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.BaseURL
+}
+
+//Pin 选择区块高度最高的节点，返回固定使用该节点的客户端，节点不可用时不会切换。
+//区块扫描在每轮分叉检查时使用，保证一轮扫描的数据来自同一个节点。
+func (c *Client) Pin() (*Client, error) {
+
+	if len(c.endpoints) < 2 {
+		return c, nil
+	}
+
+	url, err := c.selectEndpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	pinned := &Client{
+		BaseURL:          url,
+		AccessToken:      c.AccessToken,
+		Debug:            c.Debug,
+		client:           c.client,
+		Timeout:          c.Timeout,
+		MaxRetries:       c.MaxRetries,
+		RetryBackoff:     c.RetryBackoff,
+		MaxRetryBackoff:  c.MaxRetryBackoff,
+		RetryableCodes:   c.RetryableCodes,
+		BatchSize:        c.BatchSize,
+		endpoints:        []*nodeEndpoint{{URL: url, Healthy: true}},
+		batchUnsupported: atomic.LoadInt32(&c.batchUnsupported),
+	}
+	return pinned, nil
+}
+
+//selectEndpoint 用getblockcount检查所有节点，选择区块高度最高的节点，高度相同时优先当前节点
+func (c *Client) selectEndpoint() (string, error) {
+
+	type check struct {
+		height  uint64
+		healthy bool
+	}
+
+	//检查时不持有锁，避免阻塞其他请求
+	checks := make([]check, len(c.endpoints))
+	var wg sync.WaitGroup
+	for i, ep := range c.endpoints {
+		wg.Add(1)
+		go func(i int, url string) {
+			defer wg.Done()
+			result, available, err := c.post(context.Background(), url, "getblockcount", nil)
+			checks[i] = check{healthy: available && err == nil}
+			if checks[i].healthy {
+				checks[i].height = result.Uint()
+			}
+		}(i, ep.URL)
+	}
+	wg.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checkedAt = time.Now()
+	var best *nodeEndpoint
+	for i, ep := range c.endpoints {
+		ep.Healthy = checks[i].healthy
+		ep.Height = checks[i].height
+		if !ep.Healthy {
+			log.Std.Warning("node: %s is unavailable", ep.URL)
+			continue
+		}
+		if best == nil || ep.Height > best.Height || (ep.Height == best.Height && ep.URL == c.BaseURL) {
+			best = ep
+		}
+	}
+
+	if best == nil {
+		return "", errors.New("all nodes are unavailable")
+	}
+
+	if best.URL != c.BaseURL {
+		log.Std.Info("switch node from: %s to: %s, block count: %d", c.BaseURL, best.URL, best.Height)
+		c.BaseURL = best.URL
+	}
+
+	return best.URL, nil
+}
+
+//needHealthCheck 多个节点时，超过检查间隔需要重新选择节点
+func (c *Client) needHealthCheck() bool {
+	if len(c.endpoints) < 2 || c.HealthCheckInterval <= 0 {
+		return false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return time.Since(c.checkedAt) >= c.HealthCheckInterval
+}
+
+//callWithNamedParams 按参数名调用，节点的DPoS接口使用命名参数
+func (c *Client) callWithNamedParams(path string, params map[string]interface{}) (*gjson.Result, error) {
+	return c.call(path, params)
+}
+
+//call 发送json-rpc请求，params为参数数组或命名参数
+func (c *Client) call(path string, params interface{}) (*gjson.Result, error) {
+	return c.callContext(context.Background(), path, params)
+}
+
+//callContext 发送json-rpc请求，失败时按退避时间重试
+func (c *Client) callContext(ctx context.Context, path string, params interface{}) (*gjson.Result, error) {
+
+	var result *gjson.Result
+	err := c.retry(ctx, path, func(url string) (bool, error) {
+		var (
+			available bool
+			err       error
+		)
+		result, available, err = c.post(ctx, url, path, params)
+		return available, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+//retry 执行请求，失败时按退避时间重试，request返回节点是否已返回json-rpc结果及错误。
+//节点无法访问时，多个节点会切换到区块高度最高的可用节点重试；节点返回的错误只有RetryableCodes中的错误码重试。
+//nonIdempotentMethods中的方法，只有确定请求未发送到节点时才重试，避免重复执行。
+func (c *Client) retry(ctx context.Context, path string, request func(url string) (bool, error)) error {
 
 	if c.client == nil {
-		return nil, errors.New("API url is not setup. ")
+		return errors.New("API url is not setup. ")
 	}
 
-	authHeader := req.Header{
-		"Accept":        "application/json",
-		"Authorization": "Basic ", // + c.AccessToken,
+	if c.needHealthCheck() {
+		if _, err := c.selectEndpoint(); err != nil {
+			log.Std.Warning("node health check failed, unexpected error: %v", err)
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+
+		url := c.activeURL()
+		available, err := request(url)
+		if err == nil {
+			return nil
+		}
+
+		if ctx.Err() != nil || attempt >= c.MaxRetries || !c.isRetryable(path, available, err) {
+			return err
+		}
+
+		//节点无法访问，切换到其他节点后马上重试
+		if !available && len(c.endpoints) > 1 {
+			if next, selectErr := c.selectEndpoint(); selectErr == nil && next != url {
+				log.Std.Warning("node: %s is unavailable, retry %s on node: %s", url, path, next)
+				continue
+			}
+		}
+
+		wait := c.retryBackoff(attempt)
+		log.Std.Warning("call %s failed, retry after %v, unexpected error: %v", path, wait, err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+//isRetryable 请求失败是否可以重试，available表示节点已返回json-rpc结果
+func (c *Client) isRetryable(path string, available bool, err error) bool {
+
+	if !available {
+		if nonIdempotentMethods[path] {
+			return isDialError(err)
+		}
+		return true
+	}
+
+	if nonIdempotentMethods[path] {
+		return false
+	}
+
+	if rpcErr, ok := err.(*rpcError); ok {
+		for _, code := range c.RetryableCodes {
+			if rpcErr.Code == code {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+//retryBackoff 第attempt次失败后的等待时间
+func (c *Client) retryBackoff(attempt int) time.Duration {
+	wait := c.RetryBackoff
+	for i := 0; i < attempt && (c.MaxRetryBackoff <= 0 || wait < c.MaxRetryBackoff); i++ {
+		wait *= 2
+	}
+	if c.MaxRetryBackoff > 0 && wait > c.MaxRetryBackoff {
+		wait = c.MaxRetryBackoff
+	}
+	return wait
+}
+
+//isDialError 是否连接节点失败，此时请求还没有发送到节点
+func isDialError(err error) bool {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	opErr, ok := err.(*net.OpError)
+	return ok && opErr.Op == "dial"
+}
+
+//isRequestRejected 节点是否确定没有执行请求：节点返回了json-rpc错误，或连接节点失败请求未发送。
+//超时、连接中断等情况节点可能已执行请求，不能确定失败
+func isRequestRejected(err error) bool {
+	if _, ok := err.(*rpcError); ok {
+		return true
 	}
+	return isDialError(err)
+}
+
+//post 向指定节点发送请求，available表示节点是否可以访问并返回了json-rpc结果
+func (c *Client) post(ctx context.Context, url, path string, params interface{}) (*gjson.Result, bool, error) {
+
+	var (
+		body = make(map[string]interface{}, 0)
+	)
 
 	//json-rpc
 	body["jsonrpc"] = "2.0"
 	body["id"] = "1"
 	body["method"] = path
-	body["params"] = request
+	body["params"] = params
+
+	resp, err := c.postJSON(ctx, url, body)
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = isError(resp)
+	if err != nil {
+		return nil, true, err
+	}
+
+	result := resp.Get("result")
+
+	return &result, true, nil
+}
+
+//postJSON 向指定节点发送json请求体，返回节点的json响应
+func (c *Client) postJSON(ctx context.Context, url string, body interface{}) (*gjson.Result, error) {
+
+	authHeader := req.Header{
+		"Accept": "application/json",
+	}
+	if len(c.AccessToken) > 0 {
+		authHeader["Authorization"] = "Basic " + c.AccessToken
+	}
 
 	if c.Debug {
 		log.Std.Info("Start Request API...")
 	}
 
-	r, err := c.client.Post(c.BaseURL, req.BodyJSON(&body), authHeader)
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	r, err := c.client.Post(url, req.BodyJSON(body), authHeader, ctx)
 
 	if c.Debug {
 		log.Std.Info("Request API Completed")
@@ -105,15 +467,113 @@ func (c *Client) Call(path string, request []interface{}) (*gjson.Result, error)
 		return nil, err
 	}
 
+	if !gjson.ValidBytes(r.Bytes()) {
+		return nil, fmt.Errorf("node: %s response is invalid, status: %s", url, r.Response().Status)
+	}
+
 	resp := gjson.ParseBytes(r.Bytes())
-	err = isError(&resp)
+
+	return &resp, nil
+}
+
+//callBatch 按BatchSize分批发送json-rpc 2.0批量请求，结果与requests一一对应。
+//节点不支持批量请求时，改为逐个调用。
+func (c *Client) callBatch(requests []*batchRequest) []*batchResult {
+
+	results := make([]*batchResult, len(requests))
+
+	//callEach 逐个调用
+	callEach := func(start int) {
+		for i := start; i < len(requests); i++ {
+			result, err := c.call(requests[i].Method, requests[i].Params)
+			results[i] = &batchResult{Result: result, Err: err}
+		}
+	}
+
+	if c.BatchSize <= 0 || atomic.LoadInt32(&c.batchUnsupported) == 1 {
+		callEach(0)
+		return results
+	}
+
+	for start := 0; start < len(requests); start += c.BatchSize {
+
+		end := start + c.BatchSize
+		if end > len(requests) {
+			end = len(requests)
+		}
+
+		var chunk []*batchResult
+		err := c.retry(context.Background(), "batch", func(url string) (bool, error) {
+			var (
+				available bool
+				err       error
+			)
+			chunk, available, err = c.postBatch(context.Background(), url, requests[start:end])
+			return available, err
+		})
+		if err == errBatchUnsupported {
+			log.Std.Warning("node does not support batch request, call one by one")
+			atomic.StoreInt32(&c.batchUnsupported, 1)
+			callEach(start)
+			break
+		}
+
+		for i := start; i < end; i++ {
+			if err != nil {
+				results[i] = &batchResult{Err: err}
+			} else {
+				results[i] = chunk[i-start]
+			}
+		}
+	}
+
+	return results
+}
+
+//postBatch 向指定节点发送一次批量请求，按id匹配每个调用的结果
+func (c *Client) postBatch(ctx context.Context, url string, requests []*batchRequest) ([]*batchResult, bool, error) {
+
+	body := make([]map[string]interface{}, 0, len(requests))
+	for i, r := range requests {
+		body = append(body, map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      strconv.Itoa(i),
+			"method":  r.Method,
+			"params":  r.Params,
+		})
+	}
+
+	resp, err := c.postJSON(ctx, url, body)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	result := resp.Get("result")
+	//不支持批量请求的节点会返回单个错误
+	if !resp.IsArray() {
+		return nil, true, errBatchUnsupported
+	}
+
+	results := make([]*batchResult, len(requests))
+	for _, item := range resp.Array() {
+		i, err := strconv.Atoi(item.Get("id").String())
+		if err != nil || i < 0 || i >= len(requests) {
+			continue
+		}
+		if err := isError(&item); err != nil {
+			results[i] = &batchResult{Err: err}
+			continue
+		}
+		result := item.Get("result")
+		results[i] = &batchResult{Result: &result}
+	}
 
-	return &result, nil
+	for i, r := range results {
+		if r == nil {
+			results[i] = &batchResult{Err: fmt.Errorf("node: %s response of %s is missing", url, requests[i].Method)}
+		}
+	}
+
+	return results, true, nil
 }
 
 // See 2 (end of page 4) http://www.ietf.org/rfc/rfc2617.txt
@@ -153,10 +613,10 @@ func isError(result *gjson.Result) error {
 		return nil
 	}
 
-	errInfo := fmt.Sprintf("[%d]%s",
-		result.Get("error.code").Int(),
-		result.Get("error.message").String())
-	err = errors.New(errInfo)
+	err = &rpcError{
+		Code:    result.Get("error.code").Int(),
+		Message: result.Get("error.message").String(),
+	}
 
 	return err
 }
@@ -206,6 +666,17 @@ func (c *Client) getBlock(hash string, format ...uint64) (*Block, error) {
 	return c.NewBlock(result), nil
 }
 
+//getBlockWithTransactions 获取包含交易详情的区块，节点不支持时只返回交易单ID
+func (c *Client) getBlockWithTransactions(hash string) (*Block, error) {
+
+	block, err := c.getBlock(hash, BlockVerbosityTransactions)
+	if _, ok := err.(*rpcError); ok {
+		return c.getBlock(hash, BlockVerbosityTxIDs)
+	}
+
+	return block, err
+}
+
 //getTransaction 获取交易单
 func (c *Client) getTransaction(txid string) (*Transaction, error) {
 
@@ -236,6 +707,48 @@ func (c *Client) getTransaction(txid string) (*Transaction, error) {
 	return c.newTx(result), nil
 }
 
+//getTransactions 批量获取交易单，结果与txids一一对应，批量获取失败的交易单再逐个获取
+func (c *Client) getTransactions(txids []string) ([]*Transaction, []error) {
+
+	requests := make([]*batchRequest, 0, len(txids))
+	for _, txid := range txids {
+		requests = append(requests, &batchRequest{Method: "getrawtransaction", Params: []interface{}{txid, true}})
+	}
+
+	trxs := make([]*Transaction, len(txids))
+	errs := make([]error, len(txids))
+	for i, r := range c.callBatch(requests) {
+		if r.Err != nil {
+			trxs[i], errs[i] = c.getTransaction(txids[i])
+			continue
+		}
+		trxs[i] = c.newTx(r.Result)
+	}
+
+	return trxs, errs
+}
+
+//getAssetInfo 通过资产注册交易获取资产信息，资产ID即注册交易的txid
+func (c *Client) getAssetInfo(assetID string) (*AssetInfo, error) {
+
+	request := []interface{}{
+		assetID,
+		true,
+	}
+
+	result, err := c.Call("getrawtransaction", request)
+	if err != nil {
+		return nil, err
+	}
+
+	if txType := result.Get("type").Uint(); txType != uint64(TxTypeRegisterAsset) {
+		return nil, fmt.Errorf("transaction: %s type: %d is not asset registration", assetID, txType)
+	}
+
+	payload := result.Get("payload")
+	return NewAssetInfo(assetID, &payload), nil
+}
+
 //getTxOut 获取交易单输出信息，用于追溯交易单输入源头
 func (c *Client) getTxOut(txid string, vout uint64) (*Vout, error) {
 
@@ -286,7 +799,7 @@ func (c *Client) getTxIDsInMemPool() ([]string, error) {
 	return txids, nil
 }
 
-//getTransaction 获取交易单
+//getListUnspent 获取地址的未花记录，包含所有资产
 func (c *Client) getListUnspent(min uint64, addresses ...string) ([]*Unspent, error) {
 
 	var (
@@ -304,7 +817,7 @@ func (c *Client) getListUnspent(min uint64, addresses ...string) ([]*Unspent, er
 
 	array := result.Array()
 	for _, a := range array {
-		if a.Get("assetid").String() == elastosTransaction.AssetID_ELA && a.Get("confirmations").Uint() >= min {
+		if a.Get("confirmations").Uint() >= min {
 			utxos = append(utxos, NewUnspent(&a))
 		}
 	}
@@ -350,3 +863,63 @@ func (c *Client) sendRawTransaction(txHex string) (string, error) {
 	return result.String(), nil
 
 }
+
+//listProducers 分页查询超级节点，state为空时查询所有状态，可选active、inactive、pending、canceled、illegal、returned
+func (c *Client) listProducers(start, limit int, state string) (*ProducerList, error) {
+
+	params := map[string]interface{}{
+		"start": start,
+		"limit": limit,
+	}
+	if len(state) > 0 {
+		params["state"] = state
+	}
+
+	result, err := c.callWithNamedParams("listproducers", params)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewProducerList(result), nil
+}
+
+//getProducerStatus 查询超级节点的状态，未注册时节点返回Unregistered
+func (c *Client) getProducerStatus(publicKey string) (string, error) {
+
+	params := map[string]interface{}{
+		"publickey": publicKey,
+	}
+
+	result, err := c.callWithNamedParams("producerstatus", params)
+	if err != nil {
+		return "", err
+	}
+
+	return result.String(), nil
+}
+
+//getVoteStatus 查询地址的投票状态
+func (c *Client) getVoteStatus(address string) (*VoteStatus, error) {
+
+	params := map[string]interface{}{
+		"address": address,
+	}
+
+	result, err := c.callWithNamedParams("votestatus", params)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewVoteStatus(address, result), nil
+}
+
+//getArbitratorsInfo 查询当前及下一轮的仲裁人
+func (c *Client) getArbitratorsInfo() (*ArbitratorsInfo, error) {
+
+	result, err := c.callWithNamedParams("getarbitratorsinfo", map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+
+	return NewArbitratorsInfo(result), nil
+}
@@ -1,10 +1,74 @@
 package elastos
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/astaxie/beego/config"
+	"github.com/tidwall/gjson"
 )
 
+//testNodeHandler 模拟节点的RPC方法，返回result或error
+type testNodeHandler func(params gjson.Result) (interface{}, error)
+
+//newTestNode 创建模拟的节点，按方法名分发json-rpc请求
+func newTestNode(t *testing.T, handlers map[string]testNodeHandler) *httptest.Server {
+	handle := func(request gjson.Result) map[string]interface{} {
+		resp := map[string]interface{}{"id": request.Get("id").Value(), "jsonrpc": "2.0"}
+		handler, ok := handlers[request.Get("method").String()]
+		if !ok {
+			t.Errorf("unexpected rpc method: %s", request.Get("method").String())
+			resp["error"] = map[string]interface{}{"code": -32601, "message": "method not found"}
+		} else if result, err := handler(request.Get("params")); err != nil {
+			resp["error"] = map[string]interface{}{"code": -1, "message": err.Error()}
+		} else {
+			resp["result"] = result
+		}
+		return resp
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		request := gjson.ParseBytes(body)
+		//批量请求
+		if request.IsArray() {
+			resps := make([]map[string]interface{}, 0)
+			for _, item := range request.Array() {
+				resps = append(resps, handle(item))
+			}
+			json.NewEncoder(w).Encode(resps)
+			return
+		}
+		json.NewEncoder(w).Encode(handle(request))
+	}))
+}
+
+//newTestWalletManager 创建连接模拟节点的钱包管理，每个实例使用独立的数据库目录
+func newTestWalletManager(t *testing.T, url string) *WalletManager {
+	dbPath, err := ioutil.TempDir(testDataDir, "db")
+	if err != nil {
+		t.Fatalf("create db path failed unexpected error: %v", err)
+	}
+	wm := NewWalletManager()
+	wm.WalletClient = NewClient(url, false)
+	wm.Config.dbPath = dbPath
+	return wm
+}
+
 func Test_getBlockHeight(t *testing.T) {
 	c := NewClient("http://127.0.0.1:20336", false)
 	height, err := c.getBlockHeight()
@@ -85,3 +149,336 @@ func Test_tmp(t *testing.T) {
 	fmt.Println(err)
 	fmt.Println(resp)
 }
+
+func TestClient_Failover(t *testing.T) {
+
+	var (
+		heightA, heightB int64 = 100, 101
+		countCalls       int64
+	)
+
+	newNode := func(name string, height *int64) *httptest.Server {
+		return newTestNode(t, map[string]testNodeHandler{
+			"getblockcount": func(params gjson.Result) (interface{}, error) {
+				atomic.AddInt64(&countCalls, 1)
+				return atomic.LoadInt64(height), nil
+			},
+			"getbestblockhash": func(params gjson.Result) (interface{}, error) {
+				return name, nil
+			},
+		})
+	}
+
+	nodeA := newNode("a", &heightA)
+	defer nodeA.Close()
+	nodeB := newNode("b", &heightB)
+	defer nodeB.Close()
+
+	//单个节点不做健康检查
+	single := NewClient(nodeA.URL, false)
+	if hash, err := single.Call("getbestblockhash", nil); err != nil || hash.String() != "a" {
+		t.Fatalf("single node call = %v, err = %v", hash, err)
+	}
+	if pinned, err := single.Pin(); err != nil || pinned != single {
+		t.Errorf("single node Pin should return itself, err = %v", err)
+	}
+	if n := atomic.LoadInt64(&countCalls); n != 0 {
+		t.Errorf("single node should not check block count, calls = %d", n)
+	}
+
+	//选择区块高度最高的节点
+	c := NewClient(nodeA.URL+", "+nodeB.URL, false)
+	c.RetryBackoff = time.Millisecond
+	if c.BaseURL != nodeA.URL || len(c.endpoints) != 2 {
+		t.Fatalf("NewClient endpoints = %v, base url = %s", c.endpoints, c.BaseURL)
+	}
+	if hash, err := c.Call("getbestblockhash", nil); err != nil || hash.String() != "b" {
+		t.Fatalf("call should use the highest node, got = %v, err = %v", hash, err)
+	}
+
+	//固定节点后，其他节点更高也不切换
+	pinned, err := c.Pin()
+	if err != nil || pinned.BaseURL != nodeB.URL {
+		t.Fatalf("Pin = %v, err = %v", pinned, err)
+	}
+	atomic.StoreInt64(&heightA, 200)
+	c.HealthCheckInterval = 0
+	if hash, err := pinned.Call("getbestblockhash", nil); err != nil || hash.String() != "b" {
+		t.Errorf("pinned client should not switch node, got = %v, err = %v", hash, err)
+	}
+
+	//当前节点不可用时，切换到可用节点重试
+	nodeB.Close()
+	if hash, err := c.Call("getbestblockhash", nil); err != nil || hash.String() != "a" {
+		t.Errorf("call should fail over to available node, got = %v, err = %v", hash, err)
+	}
+	if c.BaseURL != nodeA.URL {
+		t.Errorf("base url = %s, want = %s", c.BaseURL, nodeA.URL)
+	}
+	if _, err := pinned.Call("getbestblockhash", nil); err == nil {
+		t.Errorf("pinned client should fail when its node is unavailable")
+	}
+
+	//所有节点都不可用
+	nodeA.Close()
+	if _, err := c.Call("getbestblockhash", nil); err == nil {
+		t.Errorf("call should fail when all nodes are unavailable")
+	}
+}
+
+func TestClient_Retry(t *testing.T) {
+
+	var (
+		calls   int64
+		failing int64
+		code    int64
+		delay   int64
+		abort   int64
+	)
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&calls, 1)
+		time.Sleep(time.Duration(atomic.LoadInt64(&delay)))
+		if atomic.AddInt64(&failing, -1) >= 0 {
+			if atomic.LoadInt64(&abort) > 0 {
+				//断开连接，模拟请求已发送但没有返回
+				panic(http.ErrAbortHandler)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": "1", "error": map[string]interface{}{"code": atomic.LoadInt64(&code), "message": "failed"}})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": "1", "result": "ok"})
+	}))
+	defer node.Close()
+
+	c := NewClient(node.URL, false)
+	c.RetryBackoff = time.Millisecond
+	c.MaxRetries = 2
+
+	tests := []struct {
+		name    string
+		method  string
+		failing int64
+		code    int64
+		abort   bool
+		wantErr bool
+		calls   int64
+	}{
+		{name: "retryable code", method: "getblockcount", failing: 2, code: RPCErrorCodeInternal, calls: 3},
+		{name: "over max retries", method: "getblockcount", failing: 3, code: RPCErrorCodeInternal, wantErr: true, calls: 3},
+		{name: "not retryable code", method: "getblockcount", failing: 1, code: -8, wantErr: true, calls: 1},
+		{name: "connection dropped", method: "getblockcount", failing: 1, abort: true, calls: 2},
+		{name: "send with retryable code", method: "sendrawtransaction", failing: 1, code: RPCErrorCodeInternal, wantErr: true, calls: 1},
+		{name: "send with connection dropped", method: "sendrawtransaction", failing: 1, abort: true, wantErr: true, calls: 1},
+	}
+
+	for _, test := range tests {
+		atomic.StoreInt64(&calls, 0)
+		atomic.StoreInt64(&failing, test.failing)
+		atomic.StoreInt64(&code, test.code)
+		atomic.StoreInt64(&abort, 0)
+		if test.abort {
+			atomic.StoreInt64(&abort, 1)
+		}
+		_, err := c.Call(test.method, nil)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: err = %v, wantErr = %v", test.name, err, test.wantErr)
+		}
+		if n := atomic.LoadInt64(&calls); n != test.calls {
+			t.Errorf("%s: calls = %d, want = %d", test.name, n, test.calls)
+		}
+	}
+
+	//请求超时后重试
+	atomic.StoreInt64(&calls, 0)
+	atomic.StoreInt64(&failing, 0)
+	atomic.StoreInt64(&delay, int64(50*time.Millisecond))
+	c.Timeout = 10 * time.Millisecond
+	if _, err := c.Call("getblockcount", nil); err == nil {
+		t.Errorf("call should be failed when timeout")
+	}
+	if n := atomic.LoadInt64(&calls); n != 3 {
+		t.Errorf("timeout calls = %d, want = 3", n)
+	}
+
+	//取消后不再重试
+	atomic.StoreInt64(&calls, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.CallContext(ctx, "getblockcount", nil); err == nil {
+		t.Errorf("call should be failed when context is canceled")
+	}
+	if n := atomic.LoadInt64(&calls); n != 0 {
+		t.Errorf("canceled calls = %d, want = 0", n)
+	}
+
+	//节点无法连接时，广播交易可以重试
+	node.Close()
+	_, err := c.Call("sendrawtransaction", nil)
+	if err == nil || !isDialError(err) {
+		t.Errorf("send to closed node err = %v, want dial error", err)
+	}
+	if !c.isRetryable("sendrawtransaction", false, err) {
+		t.Errorf("sendrawtransaction should be retried when the node can not be connected")
+	}
+}
+
+func TestClient_Batch(t *testing.T) {
+
+	var (
+		posts       int64
+		unsupported int64
+	)
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&posts, 1)
+		body, _ := ioutil.ReadAll(r.Body)
+		request := gjson.ParseBytes(body)
+		handle := func(item gjson.Result) map[string]interface{} {
+			param := item.Get("params.0").Int()
+			if param < 0 {
+				return map[string]interface{}{"id": item.Get("id").Value(), "error": map[string]interface{}{"code": -8, "message": "negative"}}
+			}
+			return map[string]interface{}{"id": item.Get("id").Value(), "result": param * 10}
+		}
+		if request.IsArray() {
+			if atomic.LoadInt64(&unsupported) > 0 {
+				json.NewEncoder(w).Encode(map[string]interface{}{"id": nil, "error": map[string]interface{}{"code": -32600, "message": "invalid request"}})
+				return
+			}
+			resps := make([]map[string]interface{}, 0)
+			//倒序返回，按id匹配结果
+			items := request.Array()
+			for i := len(items) - 1; i >= 0; i-- {
+				resps = append(resps, handle(items[i]))
+			}
+			json.NewEncoder(w).Encode(resps)
+			return
+		}
+		json.NewEncoder(w).Encode(handle(request))
+	}))
+	defer node.Close()
+
+	requests := make([]*batchRequest, 0)
+	for _, n := range []int{1, 2, -3, 4, 5} {
+		requests = append(requests, &batchRequest{Method: "echo", Params: []interface{}{n}})
+	}
+
+	check := func(name string, results []*batchResult) {
+		if len(results) != len(requests) {
+			t.Fatalf("%s: results = %d, want = %d", name, len(results), len(requests))
+		}
+		for i, r := range results {
+			n := requests[i].Params.([]interface{})[0].(int)
+			if n < 0 {
+				if r.Err == nil {
+					t.Errorf("%s: request %d should be failed", name, i)
+				}
+				continue
+			}
+			if r.Err != nil || r.Result.Int() != int64(n*10) {
+				t.Errorf("%s: request %d result = %v, err = %v", name, i, r.Result, r.Err)
+			}
+		}
+	}
+
+	c := NewClient(node.URL, false)
+	c.BatchSize = 2
+	check("batch", c.callBatch(requests))
+	if n := atomic.LoadInt64(&posts); n != 3 {
+		t.Errorf("batch posts = %d, want = 3", n)
+	}
+
+	//节点不支持批量请求时逐个调用
+	atomic.StoreInt64(&posts, 0)
+	atomic.StoreInt64(&unsupported, 1)
+	check("unsupported", c.callBatch(requests))
+	if n := atomic.LoadInt64(&posts); n != 6 || atomic.LoadInt32(&c.batchUnsupported) != 1 {
+		t.Errorf("unsupported posts = %d, want = 6", n)
+	}
+	atomic.StoreInt64(&posts, 0)
+	check("unsupported", c.callBatch(requests))
+	if n := atomic.LoadInt64(&posts); n != 5 {
+		t.Errorf("posts after unsupported = %d, want = 5", n)
+	}
+}
+
+func TestWalletManager_LoadAssetsConfigAuthTLS(t *testing.T) {
+
+	node := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Basic "+BasicAuth("user", "pass") {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": "1", "result": 101})
+	}))
+	node.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	node.StartTLS()
+	defer node.Close()
+
+	certsDir, err := ioutil.TempDir(testDataDir, "certs")
+	if err != nil {
+		t.Fatalf("create certs dir failed unexpected error: %v", err)
+	}
+
+	//节点证书作为CA，客户端使用自签名证书
+	writePEM := func(name, blockType string, der []byte) {
+		data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+		if err := ioutil.WriteFile(filepath.Join(certsDir, name), data, 0600); err != nil {
+			t.Fatalf("write %s failed unexpected error: %v", name, err)
+		}
+	}
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour)}
+	clientCert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create client certificate failed unexpected error: %v", err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	writePEM("rpc.cert", "CERTIFICATE", node.Certificate().Raw)
+	writePEM("client.cert", "CERTIFICATE", clientCert)
+	writePEM("client.key", "EC PRIVATE KEY", keyDER)
+	writePEM("invalid.cert", "CERTIFICATE", []byte("invalid"))
+
+	load := func(settings string) (*WalletManager, error) {
+		c, err := config.NewConfigData("ini", []byte(fmt.Sprintf("serverAPI = %s\ncertsDir = %s\ndataDir = %s\nrpcMaxRetries = 0\n%s",
+			node.URL, certsDir, filepath.Join(certsDir, "data"), settings)))
+		if err != nil {
+			t.Fatalf("NewConfigData failed unexpected error: %v", err)
+		}
+		wm := NewWalletManager()
+		return wm, wm.LoadAssetsConfig(c)
+	}
+
+	tests := []struct {
+		name     string
+		settings string
+		loadErr  bool
+		callErr  bool
+	}{
+		{name: "auth and tls", settings: "rpcUser = user\nrpcPassword = pass\nclientCertFileName = client.cert\nclientKeyFileName = client.key"},
+		{name: "wrong password", settings: "rpcUser = user\nrpcPassword = wrong\nclientCertFileName = client.cert\nclientKeyFileName = client.key", callErr: true},
+		{name: "no client certificate", settings: "rpcUser = user\nrpcPassword = pass", callErr: true},
+		{name: "no CA certificate", settings: "rpcUser = user\nrpcPassword = pass\ncertFileName = missing.cert\nclientCertFileName = client.cert\nclientKeyFileName = client.key", callErr: true},
+		{name: "invalid CA certificate", settings: "certFileName = invalid.cert", loadErr: true},
+		{name: "missing client key", settings: "clientCertFileName = client.cert", loadErr: true},
+	}
+
+	for _, test := range tests {
+		wm, err := load(test.settings)
+		if (err != nil) != test.loadErr {
+			t.Errorf("%s: LoadAssetsConfig err = %v, wantErr = %v", test.name, err, test.loadErr)
+			continue
+		}
+		if test.loadErr {
+			continue
+		}
+		height, err := wm.GetBlockHeight()
+		if (err != nil) != test.callErr {
+			t.Errorf("%s: GetBlockHeight err = %v, wantErr = %v", test.name, err, test.callErr)
+		}
+		if err == nil && height != 100 {
+			t.Errorf("%s: GetBlockHeight = %d, want = 100", test.name, height)
+		}
+	}
+}
@@ -20,23 +20,45 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/blocktree/go-owcdrivers/elastosTransaction"
+	"github.com/blocktree/go-owcdrivers/owkeychain"
+	"github.com/blocktree/go-owcrypt"
 	"github.com/blocktree/openwallet/openwallet"
 	"github.com/shopspring/decimal"
 )
 
+//SendMaxAmount 接收金额为此值时，发送账户的全部余额
+const SendMaxAmount = "max"
+
 type TransactionDecoder struct {
 	openwallet.TransactionDecoderBase
-	wm *WalletManager //钱包管理者
+	wm            *WalletManager          //钱包管理者
+	CoinSelectors map[string]CoinSelector //可用的选币策略
+	//读取utxo锁定到写入锁定期间持有，避免并发创建的交易单选中相同的utxo
+	selectionMu sync.Mutex
+}
+
+//builtTransaction 已构建的交易单及其使用的utxo，创建成功后锁定这些utxo
+type builtTransaction struct {
+	rawTx    *openwallet.RawTransaction
+	usedUTXO []*Unspent
 }
 
 //NewTransactionDecoder 交易单解析器
 func NewTransactionDecoder(wm *WalletManager) *TransactionDecoder {
 	decoder := TransactionDecoder{}
 	decoder.wm = wm
+	decoder.CoinSelectors = make(map[string]CoinSelector)
+	decoder.RegisterCoinSelector(NewSmallestFirstSelector())
+	decoder.RegisterCoinSelector(NewLargestFirstSelector())
+	decoder.RegisterCoinSelector(NewBranchAndBoundSelector())
+	decoder.RegisterCoinSelector(NewRandomImproveSelector())
+	decoder.RegisterCoinSelector(NewSingleAddressSelector())
 	return &decoder
 }
 
@@ -96,6 +118,13 @@ func (decoder *TransactionDecoder) SubmitRawTransaction(wrapper openwallet.Walle
 
 	txid, err := decoder.wm.SendRawTransaction(rawTx.RawHex)
 	if err != nil {
+		//节点拒绝或请求未发送时才解除交易单锁定的utxo，超时等情况节点可能已接受交易单，保留锁定直到过期或扫描到花费
+		if !isRequestRejected(err) {
+			return nil, err
+		}
+		if unlockErr := decoder.UnlockRawTransaction(rawTx); unlockErr != nil {
+			decoder.wm.Log.Errorf("unlock utxo of transaction failed, unexpected error: %v", unlockErr)
+		}
 		return nil, err
 	}
 
@@ -134,179 +163,1023 @@ func (decoder *TransactionDecoder) SubmitRawTransaction(wrapper openwallet.Walle
 
 //CreateRawTransaction 创建交易单
 func (decoder *TransactionDecoder) CreateELARawTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
+	_, err := decoder.createELAPayment(wrapper, rawTx, false)
+	return err
+}
+
+//CreateRawTransactionSequence 创建交易单序列
+//所需utxo超过MaxTxInputs时，先创建归集交易，把最小的utxo合并到账户地址，最后一笔是原交易单。
+//归集交易的txid在签名前已确定，后续交易直接引用其输出，因此要按顺序广播，前一笔确认后再广播下一笔。
+//每笔交易单按自己的utxoLockID锁定输入，最后一笔的ExtParam sequenceLockIDs记录归集交易的锁定id，
+//对最后一笔调用UnlockRawTransaction会解除整个序列的锁定。
+func (decoder *TransactionDecoder) CreateRawTransactionSequence(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) ([]*openwallet.RawTransaction, error) {
+	consolidations, err := decoder.createELAPayment(wrapper, rawTx, true)
+	if err != nil {
+		return nil, err
+	}
+	return append(consolidations, rawTx), nil
+}
+
+//createELAPayment 创建支付交易单，consolidate为true时，超过输入限制会先创建归集交易
+func (decoder *TransactionDecoder) createELAPayment(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, consolidate bool) ([]*openwallet.RawTransaction, error) {
 
 	var (
-		usedUTXO     []*Unspent
-		outputAddrs  = make(map[string]decimal.Decimal)
-		balance      = decimal.New(0, 0)
-		totalSend    = decimal.New(0, 0)
-		actualFees   = decimal.New(0, 0)
-		feesRate     = decimal.New(0, 0)
-		accountID    = rawTx.Account.AccountID
-		destinations = make([]string, 0)
+		usedUTXO       []*Unspent
+		outputAddrs    = make(map[string]decimal.Decimal)
+		balance        = decimal.New(0, 0)
+		totalSend      = decimal.New(0, 0)
+		actualFees     = decimal.New(0, 0)
+		feesRate       = decimal.New(0, 0)
+		accountID      = rawTx.Account.AccountID
+		destinations   = make([]string, 0)
+		consolidations = make([]*builtTransaction, 0)
 		//accountTotalSent = decimal.Zero
 		limit = 2000
 	)
 
+	crossChain, err := decoder.getCrossChain(rawTx)
+	if err != nil {
+		return nil, err
+	}
+
+	vote, err := decoder.getVote(rawTx)
+	if err != nil {
+		return nil, err
+	}
+	if vote != nil {
+		if crossChain != nil {
+			return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "vote of cross chain transfer is not supported")
+		}
+		if len(rawTx.To) != 1 {
+			return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "vote transaction must have only one receiver address")
+		}
+	}
+
+	outputLock, err := decoder.getOutputLock(rawTx)
+	if err != nil {
+		return nil, err
+	}
+	if outputLock > 0 && (crossChain != nil || vote != nil) {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "output lock of cross chain transfer or vote is not supported")
+	}
+
+	//先检查接收地址，避免转到无效地址
+	for addr := range rawTx.To {
+		if crossChain != nil {
+			if addrErr := decoder.checkSideChainAddress(addr); addrErr != nil {
+				return nil, addrErr
+			}
+			continue
+		}
+		if addrErr := decoder.checkReceiverAddress(addr); addrErr != nil {
+			return nil, addrErr
+		}
+	}
+
 	address, err := wrapper.GetAddressList(0, limit, "AccountID", rawTx.Account.AccountID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if len(address) == 0 {
-		return openwallet.Errorf(openwallet.ErrAccountNotAddress, "[%s] have not addresses", rawTx.Account.AccountID)
+		return nil, openwallet.Errorf(openwallet.ErrAccountNotAddress, "[%s] have not addresses", rawTx.Account.AccountID)
 	}
 
 	searchAddrs := make([]string, 0)
 	for _, address := range address {
 		searchAddrs = append(searchAddrs, address.Address)
 	}
+
+	//投票的ELA仍在账户自己的地址
+	if vote != nil {
+		for to := range rawTx.To {
+			owned := false
+			for _, addr := range searchAddrs {
+				if addr == to {
+					owned = true
+					break
+				}
+			}
+			if !owned {
+				return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "vote address: %s is not belong to account: %s", to, accountID)
+			}
+		}
+	}
+
+	//代币转账
+	if rawTx.Coin.IsContract {
+		if crossChain != nil {
+			return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "cross chain transfer of token is not supported")
+		}
+		if vote != nil {
+			return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "vote of token is not supported")
+		}
+		return nil, decoder.createTokenPayment(wrapper, rawTx, searchAddrs)
+	}
+
 	//查找账户的utxo
 	unspents, err := decoder.wm.ListUnspent(0, searchAddrs...)
 	if err != nil {
-		return err
-	}
-
-	if len(unspents) == 0 {
-		return fmt.Errorf("[%s] balance is not enough", accountID)
+		return nil, err
 	}
 
 	if len(rawTx.To) == 0 {
-		return errors.New("Receiver addresses is empty!")
+		return nil, errors.New("Receiver addresses is empty!")
 	}
 
-	//计算总发送金额
+	//计算总发送金额，跨链转账发送到锁定地址，并支付跨链手续费
 	for addr, amount := range rawTx.To {
 		deamount, _ := decimal.NewFromString(amount)
+		if crossChain != nil {
+			totalSend = totalSend.Add(deamount).Add(crossChain.Fee)
+			destinations = append(destinations, crossChain.LockAddress)
+			continue
+		}
 		totalSend = totalSend.Add(deamount)
 		destinations = append(destinations, addr)
 	}
 
-	//获取utxo，按小到大排序
-	sort.Sort(UnspentSort{unspents, func(a, b *Unspent) int {
-		a_amount, _ := decimal.NewFromString(a.Amount)
-		b_amount, _ := decimal.NewFromString(b.Amount)
-		if a_amount.GreaterThan(b_amount) {
-			return 1
-		} else {
-			return -1
+	selector, err := decoder.getCoinSelector(rawTx)
+	if err != nil {
+		return nil, err
+	}
+
+	feesRate, err = decoder.getFeeRate(rawTx)
+	if err != nil {
+		return nil, err
+	}
+
+	//不依赖输入的找零地址在选币前确定，创建地址不占用选币锁
+	if !decoder.isSendMax(rawTx) {
+		if err := decoder.prepareChangeAddress(wrapper, rawTx); err != nil {
+			return nil, err
 		}
-	}})
+	}
+
+	decoder.selectionMu.Lock()
+	defer decoder.selectionMu.Unlock()
+
+	//跳过不可花费及已被未广播交易单锁定的utxo
+	unspents, err = decoder.wm.availableUnspents(unspents)
+	if err != nil {
+		return nil, err
+	}
 
-	if len(rawTx.FeeRate) == 0 {
-		feesRate, err = decoder.wm.EstimateFeeRate()
+	if len(unspents) == 0 {
+		return nil, fmt.Errorf("[%s] balance is not enough", accountID)
+	}
+
+	//获取utxo，按小到大排序
+	sortUnspentsByAmount(unspents)
+
+	if decoder.isSendMax(rawTx) {
+		if crossChain != nil {
+			return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "send max is not supported by cross chain transfer")
+		}
+		if vote != nil {
+			return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "send max is not supported by vote")
+		}
+		if outputLock > 0 {
+			return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "send max is not supported by output lock")
+		}
+		usedUTXO, err := decoder.createELASendMax(wrapper, rawTx, unspents, feesRate)
 		if err != nil {
-			return err
+			return nil, err
 		}
-	} else {
-		feesRate, _ = decimal.NewFromString(rawTx.FeeRate)
+		return nil, decoder.lockRawTransactions(&builtTransaction{rawTx: rawTx, usedUTXO: usedUTXO})
 	}
 
 	decoder.wm.Log.Info("Calculating wallet unspent record to build transaction...")
-	computeTotalSend := totalSend
-	//循环的计算余额是否足够支付发送数额+手续费
-	for {
 
-		usedUTXO = make([]*Unspent, 0)
-		balance = decimal.New(0, 0)
+	//构建后按交易单实际长度重新计算手续费，不足时以此为下限重新选币，直到手续费收敛
+	err = decoder.convergeFees(rawTx, feesRate, func(minFees decimal.Decimal) (decimal.Decimal, []*Unspent, error) {
 
-		//计算一个可用于支付的余额
-		for _, u := range unspents {
+		consolidations, usedUTXO, balance, actualFees, err = decoder.selectPaymentUTXO(wrapper, rawTx, unspents, totalSend, destinations, feesRate, minFees, selector, consolidate)
+		if err != nil {
+			return decimal.Zero, nil, err
+		}
 
-			if u.Spendable {
-				ua, _ := decimal.NewFromString(u.Amount)
-				balance = balance.Add(ua)
-				usedUTXO = append(usedUTXO, u)
-				if balance.GreaterThanOrEqual(computeTotalSend) {
-					break
-				}
+		computeTotalSend := totalSend
+
+		changeAddress := ""
+		changeAmount := balance.Sub(computeTotalSend).Sub(actualFees)
+		if changeAmount.GreaterThan(decimal.Zero) {
+			changeAddress, err = decoder.getChangeAddress(wrapper, rawTx, usedUTXO)
+			if err != nil {
+				return decimal.Zero, nil, err
 			}
 		}
+		rawTx.FeeRate = feesRate.StringFixed(decoder.wm.Decimal())
+		rawTx.Fees = actualFees.StringFixed(decoder.wm.Decimal())
+
+		decoder.wm.Log.Std.Notice("-----------------------------------------------")
+		decoder.wm.Log.Std.Notice("From Account: %s", accountID)
+		decoder.wm.Log.Std.Notice("To Address: %s", strings.Join(destinations, ", "))
+		decoder.wm.Log.Std.Notice("Use: %v", balance.StringFixed(decoder.wm.Decimal()))
+		decoder.wm.Log.Std.Notice("Fees: %v", actualFees.StringFixed(decoder.wm.Decimal()))
+		decoder.wm.Log.Std.Notice("Receive: %v", computeTotalSend.StringFixed(decoder.wm.Decimal()))
+		decoder.wm.Log.Std.Notice("Change: %v", changeAmount.StringFixed(decoder.wm.Decimal()))
+		decoder.wm.Log.Std.Notice("Change Address: %v", changeAddress)
+		decoder.wm.Log.Std.Notice("-----------------------------------------------")
+
+		//装配输出
+		outputs := make([]*assetOutput, 0)
+		outputAddrs = make(map[string]decimal.Decimal)
+		for to, amount := range rawTx.To {
+			decamount, _ := decimal.NewFromString(amount)
+			if crossChain != nil {
+				outputs = append(outputs, &assetOutput{
+					AssetID:           elastosTransaction.AssetID_ELA,
+					Address:           crossChain.LockAddress,
+					Amount:            decamount.Add(crossChain.Fee),
+					CrossChainAddress: to,
+					CrossChainAmount:  decamount,
+				})
+				continue
+			}
+			//投票输出及锁定的输出不与找零合并
+			if vote != nil || outputLock > 0 {
+				outputs = append(outputs, &assetOutput{AssetID: elastosTransaction.AssetID_ELA, Address: to, Amount: decamount, Vote: vote, OutputLock: outputLock})
+				continue
+			}
+			outputAddrs = appendOutput(outputAddrs, to, decamount)
+			//outputAddrs[to] = amount
+		}
 
-		if balance.LessThan(computeTotalSend) {
-			return openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAccount, "the balance: %s is not enough", balance.StringFixed(decoder.wm.Decimal()))
+		//changeAmount := balance.Sub(totalSend).Sub(actualFees)
+		if changeAmount.GreaterThan(decimal.New(0, 0)) {
+			outputAddrs = appendOutput(outputAddrs, changeAddress, changeAmount)
+			//outputAddrs[changeAddress] = changeAmount.StringFixed(decoder.wm.Decimal())
+		}
+		for to, amount := range outputAddrs {
+			outputs = append(outputs, &assetOutput{AssetID: elastosTransaction.AssetID_ELA, Address: to, Amount: amount})
 		}
 
-		sigCount := int64(0)
-		fromAddrs := []string{}
-	sigCountLabel:
-		for _, utxo := range usedUTXO {
-			for _, addr := range fromAddrs {
-				if addr == utxo.Address {
-					continue sigCountLabel
-				}
-			}
-			sigCount++
+		err = decoder.createAssetRawTransaction(wrapper, rawTx, usedUTXO, outputs, elastosTransaction.AssetID_ELA)
+		if err != nil {
+			return decimal.Zero, nil, err
+		}
+
+		return actualFees, usedUTXO, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if crossChain != nil {
+		rawTx.SetExtParam("crossChainFee", crossChain.Fee.StringFixed(decoder.wm.Decimal()))
+	}
+
+	//锁定交易单序列使用的utxo
+	if err := decoder.lockRawTransactions(append(consolidations, &builtTransaction{rawTx: rawTx, usedUTXO: usedUTXO})...); err != nil {
+		return nil, err
+	}
+
+	sequence := make([]*openwallet.RawTransaction, 0, len(consolidations))
+	sequenceLockIDs := make([]string, 0, len(consolidations))
+	for _, consolidation := range consolidations {
+		sequence = append(sequence, consolidation.rawTx)
+		sequenceLockIDs = append(sequenceLockIDs, consolidation.rawTx.GetExtParam().Get("utxoLockID").String())
+	}
+	if len(sequenceLockIDs) > 0 {
+		rawTx.SetExtParam("sequenceLockIDs", sequenceLockIDs)
+	}
+	return sequence, nil
+}
+
+//getOutputLock 接收输出的锁定高度，由ExtParam的outputLock指定，区块高度达到前接收方不能花费，找零不锁定
+func (decoder *TransactionDecoder) getOutputLock(rawTx *openwallet.RawTransaction) (uint32, error) {
+	lock := rawTx.GetExtParam().Get("outputLock")
+	if !lock.Exists() {
+		return 0, nil
+	}
+	height, err := strconv.ParseUint(lock.String(), 10, 32)
+	if err != nil {
+		return 0, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "output lock: %s is invalid", lock.String())
+	}
+	return uint32(height), nil
+}
+
+//getFeeRate 交易单的手续费率，没有指定时按配置的来源估算，并在ExtParam的feeRateSource记录来源
+func (decoder *TransactionDecoder) getFeeRate(rawTx *openwallet.RawTransaction) (decimal.Decimal, error) {
+	if len(rawTx.FeeRate) > 0 {
+		feesRate, _ := decimal.NewFromString(rawTx.FeeRate)
+		return feesRate, nil
+	}
+	estimate, err := decoder.wm.EstimateFeeRateWithSource()
+	if err != nil {
+		return decimal.Zero, err
+	}
+	//记录费率来源，以及是否提高到了最低转发费率
+	rawTx.SetExtParam("feeRateSource", estimate.Source)
+	if estimate.MinRelayApplied {
+		rawTx.SetExtParam("feeRateMinRelayApplied", true)
+	}
+	return estimate.FeeRate, nil
+}
+
+//isSendMax 是否发送全部余额，ExtParam的sendMax为true或接收金额为SendMaxAmount
+func (decoder *TransactionDecoder) isSendMax(rawTx *openwallet.RawTransaction) bool {
+	if rawTx.GetExtParam().Get("sendMax").Bool() {
+		return true
+	}
+	for _, amount := range rawTx.To {
+		if strings.EqualFold(amount, SendMaxAmount) {
+			return true
+		}
+	}
+	return false
+}
+
+//createELASendMax 发送全部余额，使用所有可用的utxo，超过MaxTxInputs时只使用金额最大的部分，
+//手续费从唯一的接收金额中扣除，不产生找零，返回使用的utxo
+func (decoder *TransactionDecoder) createELASendMax(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, unspents []*Unspent, feesRate decimal.Decimal) ([]*Unspent, error) {
+
+	if len(rawTx.To) != 1 {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "send max transaction should have only one receiver, but got: %d", len(rawTx.To))
+	}
+
+	to := ""
+	for addr := range rawTx.To {
+		to = addr
+	}
+
+	usedUTXO := spendableUnspents(unspents)
+	if len(usedUTXO) == 0 {
+		return nil, openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAccount, "[%s] have not spendable unspent", rawTx.Account.AccountID)
+	}
+
+	sortUnspentsByAmountDesc(usedUTXO)
+	if len(usedUTXO) > decoder.wm.Config.MaxTxInputs {
+		decoder.wm.Log.Warningf("send max transaction use the largest %d of %d unspents", decoder.wm.Config.MaxTxInputs, len(usedUTXO))
+		usedUTXO = usedUTXO[:decoder.wm.Config.MaxTxInputs]
+	}
+	balance := sumUnspents(usedUTXO)
+
+	fees, err := decoder.estimateTxFees(rawTx.Account, usedUTXO, []string{to}, false, feesRate)
+	if err != nil {
+		return nil, err
+	}
+
+	//输出金额是定长的，交易单长度不随扣除的手续费变化，按实际长度重新计算一次即可收敛
+	for iteration := 1; ; iteration++ {
+
+		amount := balance.Sub(fees)
+		if !amount.IsPositive() {
+			return nil, openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAccount, "the balance: %s is not enough to pay fees: %s",
+				balance.StringFixed(decoder.wm.Decimal()), fees.StringFixed(decoder.wm.Decimal()))
+		}
+
+		rawTx.To = map[string]string{to: amount.StringFixed(decoder.wm.Decimal())}
+		rawTx.FeeRate = feesRate.StringFixed(decoder.wm.Decimal())
+		rawTx.Fees = fees.StringFixed(decoder.wm.Decimal())
+
+		decoder.wm.Log.Std.Notice("-----------------------------------------------")
+		decoder.wm.Log.Std.Notice("From Account: %s", rawTx.Account.AccountID)
+		decoder.wm.Log.Std.Notice("To Address: %s", to)
+		decoder.wm.Log.Std.Notice("Use: %v", balance.StringFixed(decoder.wm.Decimal()))
+		decoder.wm.Log.Std.Notice("Fees: %v", fees.StringFixed(decoder.wm.Decimal()))
+		decoder.wm.Log.Std.Notice("Receive: %v", amount.StringFixed(decoder.wm.Decimal()))
+		decoder.wm.Log.Std.Notice("-----------------------------------------------")
+
+		err = decoder.createELARawTransaction(wrapper, rawTx, usedUTXO, map[string]decimal.Decimal{to: amount})
+		if err != nil {
+			return nil, err
 		}
-		fees := decimal.Zero
 
 		if decoder.wm.Config.UseFixedFee {
-			//使用固定手续费
-			fees, _ = decimal.NewFromString(decoder.wm.Config.FixedFee)
-		} else {
-			//计算手续费，找零地址有2个，一个是发送，一个是新创建的
-			fees, err = decoder.wm.EstimateFee(int64(len(usedUTXO)), int64(len(destinations)+1), sigCount, feesRate)
+			break
+		}
+
+		requiredFees := decoder.wm.CalculateFee(signedTransactionSize(rawTx.RawHex, countInputAddresses(usedUTXO), rawTx.Account), feesRate)
+		if requiredFees.Equal(fees) {
+			break
+		}
+
+		if iteration >= MaxFeeIterations {
+			return nil, openwallet.Errorf(openwallet.ErrInsufficientFees, "fees: %s is not converged, required: %s",
+				fees.StringFixed(decoder.wm.Decimal()), requiredFees.StringFixed(decoder.wm.Decimal()))
+		}
+
+		fees = requiredFees
+	}
+
+	rawTx.SetExtParam("sendMax", true)
+
+	return usedUTXO, nil
+}
+
+//createTokenPayment 创建代币转账交易单，代币找零与ELA找零都发送到找零地址，手续费使用ELA支付
+func (decoder *TransactionDecoder) createTokenPayment(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, searchAddrs []string) error {
+
+	var (
+		accountID    = rawTx.Account.AccountID
+		precision    = int32(rawTx.Coin.Contract.Decimals)
+		totalSend    = decimal.Zero
+		tokenOutputs = make([]*assetOutput, 0)
+		destinations = make([]string, 0)
+	)
+
+	assetID, err := contractAssetID(rawTx.Coin.Contract)
+	if err != nil {
+		return err
+	}
+
+	if decoder.isSendMax(rawTx) {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "send max is not supported by token transfer")
+	}
+
+	if len(rawTx.To) == 0 {
+		return errors.New("Receiver addresses is empty!")
+	}
+
+	outputLock, err := decoder.getOutputLock(rawTx)
+	if err != nil {
+		return err
+	}
+
+	for addr, amount := range rawTx.To {
+		deamount, err := decimal.NewFromString(amount)
+		if err != nil {
+			return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "amount: %s is invalid", amount)
+		}
+		if err := checkAssetAmount(deamount, precision); err != nil {
+			return err
+		}
+		totalSend = totalSend.Add(deamount)
+		destinations = append(destinations, addr)
+		tokenOutputs = append(tokenOutputs, &assetOutput{AssetID: assetID, Address: addr, Amount: deamount, OutputLock: outputLock})
+	}
+
+	//查找账户的代币utxo及支付手续费的ELA utxo
+	tokenUnspents, err := decoder.wm.ListAssetUnspent(assetID, 0, searchAddrs...)
+	if err != nil {
+		return err
+	}
+
+	elaUnspents, err := decoder.wm.ListUnspent(0, searchAddrs...)
+	if err != nil {
+		return err
+	}
+
+	selector, err := decoder.getCoinSelector(rawTx)
+	if err != nil {
+		return err
+	}
+
+	feesRate, err := decoder.getFeeRate(rawTx)
+	if err != nil {
+		return err
+	}
+
+	//不依赖输入的找零地址在选币前确定，创建地址不占用选币锁
+	if err := decoder.prepareChangeAddress(wrapper, rawTx); err != nil {
+		return err
+	}
+
+	decoder.selectionMu.Lock()
+	defer decoder.selectionMu.Unlock()
+
+	tokenUnspents, err = decoder.wm.availableUnspents(tokenUnspents)
+	if err != nil {
+		return err
+	}
+	if len(tokenUnspents) == 0 {
+		return openwallet.Errorf(openwallet.ErrInsufficientTokenBalanceOfAddress, "[%s] token: %s balance is not enough", accountID, rawTx.Coin.Contract.Token)
+	}
+
+	elaUnspents, err = decoder.wm.availableUnspents(elaUnspents)
+	if err != nil {
+		return err
+	}
+	if len(elaUnspents) == 0 {
+		return openwallet.Errorf(openwallet.ErrInsufficientFees, "[%s] have not ELA to pay fees", accountID)
+	}
+
+	sortUnspentsByAmount(tokenUnspents)
+	sortUnspentsByAmount(elaUnspents)
+
+	decoder.wm.Log.Info("Calculating wallet unspent record to build token transaction...")
+
+	//代币输入不影响代币金额，选币时手续费为0
+	tokenUTXO, err := selector.Select(tokenUnspents, &CoinSelectionTarget{
+		Amount:    totalSend,
+		MaxInputs: decoder.wm.Config.MaxTxInputs,
+	})
+	if err != nil {
+		return openwallet.Errorf(openwallet.ErrInsufficientTokenBalanceOfAddress, "[%s] token: %s balance is not enough, %v", accountID, rawTx.Coin.Contract.Token, err)
+	}
+	if len(tokenUTXO) >= decoder.wm.Config.MaxTxInputs {
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "token transaction use inputs: %d, there is no input left for fees, max inputs: %d",
+			len(tokenUTXO), decoder.wm.Config.MaxTxInputs)
+	}
+
+	tokenChange := sumUnspents(tokenUTXO).Sub(totalSend)
+	if tokenChange.GreaterThan(decimal.Zero) {
+		changeAddress, err := decoder.getChangeAddress(wrapper, rawTx, tokenUTXO)
+		if err != nil {
+			return err
+		}
+		tokenOutputs = append(tokenOutputs, &assetOutput{AssetID: assetID, Address: changeAddress, Amount: tokenChange})
+		destinations = append(destinations, changeAddress)
+	}
+
+	//构建后按交易单实际长度重新计算手续费，不足时以此为下限重新选择ELA，直到手续费收敛
+	var usedUTXO []*Unspent
+	err = decoder.convergeFees(rawTx, feesRate, func(minFees decimal.Decimal) (decimal.Decimal, []*Unspent, error) {
+
+		elaUTXO, balance, fees, err := decoder.selectUTXO(rawTx.Account, elaUnspents, tokenUTXO, decimal.Zero, destinations, feesRate, minFees, selector)
+		if err != nil {
+			return decimal.Zero, nil, err
+		}
+
+		outputs := append([]*assetOutput{}, tokenOutputs...)
+		changeAddress := ""
+		changeAmount := balance.Sub(fees)
+		if changeAmount.GreaterThan(decimal.Zero) {
+			changeAddress, err = decoder.getChangeAddress(wrapper, rawTx, elaUTXO)
 			if err != nil {
-				return err
+				return decimal.Zero, nil, err
 			}
+			outputs = append(outputs, &assetOutput{AssetID: elastosTransaction.AssetID_ELA, Address: changeAddress, Amount: changeAmount})
+		}
+		rawTx.FeeRate = feesRate.StringFixed(decoder.wm.Decimal())
+		rawTx.Fees = fees.StringFixed(decoder.wm.Decimal())
+
+		decoder.wm.Log.Std.Notice("-----------------------------------------------")
+		decoder.wm.Log.Std.Notice("From Account: %s", accountID)
+		decoder.wm.Log.Std.Notice("Token: %s, Asset ID: %s", rawTx.Coin.Contract.Token, assetID)
+		decoder.wm.Log.Std.Notice("To Address: %s", strings.Join(destinations, ", "))
+		decoder.wm.Log.Std.Notice("Receive: %v", totalSend.StringFixed(precision))
+		decoder.wm.Log.Std.Notice("Token Change: %v", tokenChange.StringFixed(precision))
+		decoder.wm.Log.Std.Notice("Fees: %v", fees.StringFixed(decoder.wm.Decimal()))
+		decoder.wm.Log.Std.Notice("Change: %v", changeAmount.StringFixed(decoder.wm.Decimal()))
+		decoder.wm.Log.Std.Notice("Change Address: %v", changeAddress)
+		decoder.wm.Log.Std.Notice("-----------------------------------------------")
+
+		usedUTXO = append(append([]*Unspent{}, tokenUTXO...), elaUTXO...)
+		err = decoder.createAssetRawTransaction(wrapper, rawTx, usedUTXO, outputs, assetID)
+		if err != nil {
+			return decimal.Zero, nil, err
 		}
 
-		//如果要手续费有发送支付，得计算加入手续费后，计算余额是否足够
-		//总共要发送的
-		computeTotalSend = totalSend.Add(fees)
-		if computeTotalSend.GreaterThan(balance) {
-			continue
+		return fees, usedUTXO, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return decoder.lockRawTransactions(&builtTransaction{rawTx: rawTx, usedUTXO: usedUTXO})
+}
+
+//selectPaymentUTXO 为支付选择utxo，consolidate为true时，超过输入限制会先创建归集交易
+func (decoder *TransactionDecoder) selectPaymentUTXO(
+	wrapper openwallet.WalletDAI,
+	rawTx *openwallet.RawTransaction,
+	unspents []*Unspent,
+	totalSend decimal.Decimal,
+	destinations []string,
+	feesRate, minFees decimal.Decimal,
+	selector CoinSelector,
+	consolidate bool,
+) ([]*builtTransaction, []*Unspent, decimal.Decimal, decimal.Decimal, error) {
+
+	consolidations := make([]*builtTransaction, 0)
+	unspents = append([]*Unspent{}, unspents...)
+
+	for {
+		usedUTXO, balance, fees, selectErr := decoder.selectUTXO(rawTx.Account, unspents, nil, totalSend, destinations, feesRate, minFees, selector)
+		if selectErr == nil && len(usedUTXO) <= decoder.wm.Config.MaxTxInputs {
+			return consolidations, usedUTXO, balance, fees, nil
+		}
+
+		//输入限制内选不到足够的utxo，只有全部可用utxo足够支付且超过输入限制时才需要归集，否则是余额不足
+		spendable := spendableUnspents(unspents)
+		if len(spendable) <= decoder.wm.Config.MaxTxInputs {
+			return nil, nil, decimal.Zero, decimal.Zero, selectErr
+		}
+		if selectErr != nil {
+			target, err := decoder.selectionTarget(rawTx.Account, nil, totalSend, destinations, feesRate, minFees)
+			if err != nil {
+				return nil, nil, decimal.Zero, decimal.Zero, err
+			}
+			if !target.isCovered(spendable) {
+				return nil, nil, decimal.Zero, decimal.Zero, selectErr
+			}
+		}
+
+		//UTXO如果大于设定限制，则分拆成多笔交易单发送
+		if !consolidate {
+			return nil, nil, decimal.Zero, decimal.Zero, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed,
+				"The transaction is use max inputs over: %d, please create transaction sequence to consolidate utxo first", decoder.wm.Config.MaxTxInputs)
+		}
+
+		//至少合并2个utxo，才能减少输入数量
+		if decoder.wm.Config.MaxTxInputs < 2 {
+			return nil, nil, decimal.Zero, decimal.Zero, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed,
+				"max inputs: %d is too small to consolidate utxo", decoder.wm.Config.MaxTxInputs)
+		}
+
+		//归集最小的utxo
+		sortUnspentsByAmount(spendable)
+		merged := spendable[:decoder.wm.Config.MaxTxInputs]
+
+		consolidation, output, err := decoder.createConsolidationTransaction(wrapper, rawTx, merged, feesRate)
+		if err != nil {
+			return nil, nil, decimal.Zero, decimal.Zero, err
+		}
+		consolidations = append(consolidations, &builtTransaction{rawTx: consolidation, usedUTXO: merged})
+
+		//已归集的utxo替换为归集交易的输出
+		unspents = removeUTXOs(spendable, merged)
+		unspents = append(unspents, output)
+		sortUnspentsByAmount(unspents)
+	}
+}
+
+//selectUTXO 使用选币策略选择utxo，返回使用的utxo，总额及手续费。
+//找零不足以支付找零输出的手续费时，不创建找零，多出部分作为手续费。
+//minFees是手续费的下限，用于多轮计算直到手续费收敛。
+//fixedInputs是交易单必须包含的其他输入，只计入手续费，不计入余额。
+func (decoder *TransactionDecoder) selectUTXO(account *openwallet.AssetsAccount, unspents []*Unspent, fixedInputs []*Unspent, totalSend decimal.Decimal, destinations []string, feesRate, minFees decimal.Decimal, selector CoinSelector) ([]*Unspent, decimal.Decimal, decimal.Decimal, error) {
+
+	target, err := decoder.selectionTarget(account, fixedInputs, totalSend, destinations, feesRate, minFees)
+	if err != nil {
+		return nil, decimal.Zero, decimal.Zero, err
+	}
+
+	usedUTXO, err := selector.Select(unspents, target)
+	if err != nil {
+		return nil, decimal.Zero, decimal.Zero, err
+	}
+
+	balance := sumUnspents(usedUTXO)
+
+	fees := target.Fees(usedUTXO, true)
+	if balance.Sub(totalSend).Sub(fees).GreaterThan(decimal.Zero) {
+		return usedUTXO, balance, fees, nil
+	}
+
+	//没有找零
+	fees = target.Fees(usedUTXO, false)
+	if balance.LessThan(totalSend.Add(fees)) {
+		return nil, balance, decimal.Zero, openwallet.Errorf(openwallet.ErrInsufficientBalanceOfAccount, "the balance: %s is not enough", balance.StringFixed(decoder.wm.Decimal()))
+	}
+
+	return usedUTXO, balance, balance.Sub(totalSend), nil
+}
+
+//selectionTarget 选币目标，手续费按交易单长度估算，不低于minFees。
+//基础长度由只有一个输入的交易单减去该输入及其解锁脚本得到，只序列化一次
+func (decoder *TransactionDecoder) selectionTarget(account *openwallet.AssetsAccount, fixedInputs []*Unspent, totalSend decimal.Decimal, destinations []string, feesRate, minFees decimal.Decimal) (*CoinSelectionTarget, error) {
+
+	target := &CoinSelectionTarget{
+		Amount:    totalSend,
+		MaxInputs: decoder.wm.Config.MaxTxInputs - len(fixedInputs),
+		FeeRate:   feesRate,
+		MinFees:   minFees,
+		Decimals:  decoder.wm.Decimal(),
+		Fixed:     fixedInputs,
+	}
+
+	if decoder.wm.Config.UseFixedFee {
+		//使用固定手续费
+		fixedFee, _ := decimal.NewFromString(decoder.wm.Config.FixedFee)
+		target.FeeRate = decimal.Zero
+		target.MinFees = decimal.Max(fixedFee, minFees)
+		return target, nil
+	}
+
+	program := programSize(1, 1)
+	if len(account.OwnerKeys) > 1 {
+		program = programSize(int(account.Required), len(account.OwnerKeys))
+	}
+
+	sample := &Unspent{TxID: fmt.Sprintf("%064x", 0), Address: "sample"}
+	size, err := decoder.estimateTxSize(account, []*Unspent{sample}, destinations)
+	if err != nil {
+		return nil, err
+	}
+
+	target.InputSize = TxInputSize
+	target.ProgramSize = int64(program)
+	target.BaseSize = size - target.InputSize - target.ProgramSize
+	target.ChangeSize = int64(TxOutputSize + len(writeVarUint(uint64(len(destinations)+1))) - len(writeVarUint(uint64(len(destinations)))))
+	return target, nil
+}
+
+//addressCreator 可以创建地址的WalletDAI，openw.WalletWrapper实现了该接口
+type addressCreator interface {
+	CreateAddress(accountID string, count uint64, decoder openwallet.AddressDecoder, isChange bool, isTestNet bool) ([]*openwallet.Address, error)
+}
+
+//prepareChangeAddress 在选币前确定不依赖输入的找零地址，优先使用交易单指定的Change，其次按ExtParam的changePolicy或配置的策略选择。
+//找零回到输入地址及每次新建找零地址的策略在选币后由getChangeAddress确定，单地址选币时总是回到输入地址。
+func (decoder *TransactionDecoder) prepareChangeAddress(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction) error {
+
+	if decoder.isSingleAddress(rawTx) {
+		rawTx.Change = nil
+		return nil
+	}
+
+	if rawTx.Change != nil && len(rawTx.Change.Address) > 0 {
+		if addrErr := decoder.checkReceiverAddress(rawTx.Change.Address); addrErr != nil {
+			return addrErr
+		}
+		return nil
+	}
+
+	var (
+		change *openwallet.Address
+		err    error
+	)
+
+	switch policy := decoder.getChangePolicy(rawTx); policy {
+	case "", ChangePolicyInput:
+		//选币后确定
+		return nil
+	case ChangePolicyDedicated:
+		//账户固定的找零地址，没有时创建
+		changes, _ := wrapper.GetAddressList(0, 1, "AccountID", rawTx.Account.AccountID, "IsChange", true)
+		if len(changes) > 0 {
+			change = changes[0]
+		} else {
+			change, err = decoder.createChangeAddress(wrapper, rawTx.Account)
+		}
+	case ChangePolicyFresh:
+		//选币后有找零时才创建，这里只检查WalletDAI能否创建地址
+		if _, ok := wrapper.(addressCreator); !ok {
+			return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "wallet can not create change address")
+		}
+		return nil
+	default:
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "change policy: %s is not supported", policy)
+	}
+	if err != nil {
+		return err
+	}
+
+	rawTx.Change = change
+
+	return nil
+}
+
+//getChangeAddress 找零地址，只在有找零时调用。使用prepareChangeAddress确定的Change，
+//fresh策略时创建新的找零地址并保存到Change供后续找零复用，其他情况找零回到第一个输入地址
+func (decoder *TransactionDecoder) getChangeAddress(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, usedUTXO []*Unspent) (string, error) {
+
+	singleAddress := decoder.isSingleAddress(rawTx)
+	if !singleAddress && rawTx.Change != nil && len(rawTx.Change.Address) > 0 {
+		return rawTx.Change.Address, nil
+	}
+
+	if !singleAddress && decoder.getChangePolicy(rawTx) == ChangePolicyFresh {
+		change, err := decoder.createChangeAddress(wrapper, rawTx.Account)
+		if err != nil {
+			return "", err
+		}
+		rawTx.Change = change
+		return change.Address, nil
+	}
+
+	change, err := wrapper.GetAddress(usedUTXO[0].Address)
+	if err != nil {
+		change = &openwallet.Address{AccountID: rawTx.Account.AccountID, Address: usedUTXO[0].Address}
+	}
+
+	rawTx.Change = change
+
+	return change.Address, nil
+}
+
+//getChangePolicy 找零策略，优先使用交易单ExtParam的changePolicy，其次是配置
+func (decoder *TransactionDecoder) getChangePolicy(rawTx *openwallet.RawTransaction) string {
+	policy := decoder.wm.Config.ChangePolicy
+	if custom := rawTx.GetExtParam().Get("changePolicy").String(); len(custom) > 0 {
+		policy = custom
+	}
+	return policy
+}
+
+//createChangeAddress 通过WalletDAI为账户创建找零地址
+func (decoder *TransactionDecoder) createChangeAddress(wrapper openwallet.WalletDAI, account *openwallet.AssetsAccount) (*openwallet.Address, error) {
+	creator, ok := wrapper.(addressCreator)
+	if !ok {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "wallet can not create change address")
+	}
+	addrs, err := creator.CreateAddress(account.AccountID, 1, decoder.wm.Decoder, true, false)
+	if err != nil {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "create change address failed, %v", err)
+	}
+	if len(addrs) == 0 {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "create change address failed")
+	}
+	return addrs[0], nil
+}
+
+//getCoinSelector 选币策略，优先使用交易单ExtParam的coinSelection，其次是配置
+func (decoder *TransactionDecoder) getCoinSelector(rawTx *openwallet.RawTransaction) (CoinSelector, error) {
+
+	name := decoder.wm.Config.CoinSelection
+	if custom := rawTx.GetExtParam().Get("coinSelection").String(); len(custom) > 0 {
+		name = custom
+	}
+	if len(name) == 0 {
+		name = CoinSelectionSmallestFirst
+	}
+
+	selector, ok := decoder.CoinSelectors[name]
+	if !ok {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "coin selection: %s is not supported", name)
+	}
+	return selector, nil
+}
+
+//isSingleAddress 交易单是否使用单地址选币
+func (decoder *TransactionDecoder) isSingleAddress(rawTx *openwallet.RawTransaction) bool {
+	selector, err := decoder.getCoinSelector(rawTx)
+	if err != nil {
+		return false
+	}
+	return selector.Name() == CoinSelectionSingleAddress
+}
+
+//RegisterCoinSelector 注册选币策略，同名策略会被替换
+func (decoder *TransactionDecoder) RegisterCoinSelector(selector CoinSelector) {
+	decoder.CoinSelectors[selector.Name()] = selector
+}
+
+//estimateTxFees 按交易单的实际长度计算手续费，交易单包含这些utxo，发送到to的输出，以及可能的找零输出。
+//每个不同的输入地址需要一个解锁脚本，长度由账户的公钥数量及必要签名数决定。
+func (decoder *TransactionDecoder) estimateTxFees(account *openwallet.AssetsAccount, usedUTXO []*Unspent, to []string, hasChange bool, feesRate decimal.Decimal) (decimal.Decimal, error) {
+
+	if decoder.wm.Config.UseFixedFee {
+		//使用固定手续费
+		fees, _ := decimal.NewFromString(decoder.wm.Config.FixedFee)
+		return fees, nil
+	}
+
+	if len(usedUTXO) == 0 {
+		return decimal.Zero, fmt.Errorf("utxo is empty")
+	}
+
+	//输出的长度与金额无关，找零按第一个输入地址计算
+	outputs := append([]string{}, to...)
+	if hasChange {
+		outputs = append(outputs, usedUTXO[0].Address)
+	}
+
+	size, err := decoder.estimateTxSize(account, usedUTXO, outputs)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	return decoder.wm.CalculateFee(size, feesRate), nil
+}
+
+//estimateTxSize 选币时估算签名完成后的交易单长度，只包含输入及普通转账输出，
+//备注、投票及跨链的payload由构建后的convergeFees按实际长度补足
+func (decoder *TransactionDecoder) estimateTxSize(account *openwallet.AssetsAccount, usedUTXO []*Unspent, outputs []string) (int64, error) {
+
+	vins := make([]*txInput, 0, len(usedUTXO))
+	for _, utxo := range usedUTXO {
+		vins = append(vins, &txInput{TxID: utxo.TxID, Vout: uint16(utxo.Vout), Sequence: 0xFFFFFFFF, Address: utxo.Address})
+	}
+	vouts := make([]*txOutput, 0, len(outputs))
+	for _, to := range outputs {
+		vouts = append(vouts, &txOutput{AssetID: elastosTransaction.AssetID_ELA, Address: to})
+	}
+
+	tx, err := newTransferTransaction(vins, vouts)
+	if err != nil {
+		return 0, err
+	}
+
+	emptyTrans, txHashes, err := tx.CreateEmptyRawTransactionAndHash()
+	if err != nil {
+		return 0, err
+	}
+
+	return signedTransactionSize(emptyTrans, len(txHashes), account), nil
+}
+
+//countInputAddresses 不同输入地址的数量，即解锁脚本的数量
+func countInputAddresses(usedUTXO []*Unspent) int {
+	addrs := make(map[string]bool)
+	for _, utxo := range usedUTXO {
+		addrs[utxo.Address] = true
+	}
+	return len(addrs)
+}
+
+//signedTransactionSize 空交易单加上每个输入地址的解锁脚本后的长度
+func signedTransactionSize(emptyTrans string, programs int, account *openwallet.AssetsAccount) int64 {
+	size := len(emptyTrans)/2 + len(writeVarUint(uint64(programs)))
+	if len(account.OwnerKeys) > 1 {
+		size += programs * programSize(int(account.Required), len(account.OwnerKeys))
+	} else {
+		size += programs * programSize(1, 1)
+	}
+	return int64(size)
+}
+
+//createConsolidationTransaction 创建归集交易，把utxo合并到第一个utxo的地址，返回交易单及其输出
+func (decoder *TransactionDecoder) createConsolidationTransaction(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, usedUTXO []*Unspent, feesRate decimal.Decimal) (*openwallet.RawTransaction, *Unspent, error) {
+
+	balance := decimal.Zero
+	for _, u := range usedUTXO {
+		ua, _ := decimal.NewFromString(u.Amount)
+		balance = balance.Add(ua)
+	}
+
+	consolidateAddress := usedUTXO[0].Address
+
+	estimated, err := decoder.estimateTxFees(rawTx.Account, usedUTXO, []string{consolidateAddress}, false, feesRate)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	consolidation := &openwallet.RawTransaction{
+		Coin:     rawTx.Coin,
+		Account:  rawTx.Account,
+		FeeRate:  feesRate.StringFixed(decoder.wm.Decimal()),
+		Required: rawTx.Account.Required,
+	}
+	consolidation.SetExtParam("consolidation", true)
+
+	//与支付交易相同，按构建后的实际长度重新计算手续费，直到收敛
+	amount := decimal.Zero
+	err = decoder.convergeFees(consolidation, feesRate, func(minFees decimal.Decimal) (decimal.Decimal, []*Unspent, error) {
+
+		fees := decimal.Max(estimated, minFees)
+		amount = balance.Sub(fees)
+		if amount.LessThanOrEqual(decimal.Zero) {
+			return decimal.Zero, nil, openwallet.Errorf(openwallet.ErrInsufficientFees, "the utxo balance: %s is not enough to pay consolidation fees: %s",
+				balance.StringFixed(decoder.wm.Decimal()), fees.StringFixed(decoder.wm.Decimal()))
 		}
-		computeTotalSend = totalSend
 
-		actualFees = fees
+		consolidation.To = map[string]string{consolidateAddress: amount.StringFixed(decoder.wm.Decimal())}
+		consolidation.Fees = fees.StringFixed(decoder.wm.Decimal())
 
-		break
+		if err := decoder.createELARawTransaction(wrapper, consolidation, usedUTXO, map[string]decimal.Decimal{consolidateAddress: amount}); err != nil {
+			return decimal.Zero, nil, err
+		}
+		return fees, usedUTXO, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
 
+	txid, err := unsignedTransactionID(consolidation.RawHex)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	//UTXO如果大于设定限制，则分拆成多笔交易单发送
-	if len(usedUTXO) > decoder.wm.Config.MaxTxInputs {
-		errStr := fmt.Sprintf("The transaction is use max inputs over: %d", decoder.wm.Config.MaxTxInputs)
-		return errors.New(errStr)
+	decoder.wm.Log.Std.Notice("Consolidate %d utxo to address: %s, amount: %s, txid: %s",
+		len(usedUTXO), consolidateAddress, amount.StringFixed(decoder.wm.Decimal()), txid)
+
+	output := &Unspent{
+		TxID:      txid,
+		Vout:      0,
+		Address:   consolidateAddress,
+		Amount:    amount.StringFixed(decoder.wm.Decimal()),
+		AssetID:   elastosTransaction.AssetID_ELA,
+		Spendable: true,
+		HDAddress: usedUTXO[0].HDAddress,
 	}
 
-	//取账户最后一个地址
-	changeAddress := usedUTXO[0].Address
+	return consolidation, output, nil
+}
 
-	changeAmount := balance.Sub(computeTotalSend).Sub(actualFees)
-	rawTx.FeeRate = feesRate.StringFixed(decoder.wm.Decimal())
-	rawTx.Fees = actualFees.StringFixed(decoder.wm.Decimal())
+//convergeFees 构建交易单后按签名完成的实际长度重新计算手续费，不足时以此为下限重新构建，直到手续费收敛。
+//build按手续费下限构建rawTx，返回实际使用的手续费及utxo
+func (decoder *TransactionDecoder) convergeFees(rawTx *openwallet.RawTransaction, feesRate decimal.Decimal, build func(minFees decimal.Decimal) (decimal.Decimal, []*Unspent, error)) error {
 
-	decoder.wm.Log.Std.Notice("-----------------------------------------------")
-	decoder.wm.Log.Std.Notice("From Account: %s", accountID)
-	decoder.wm.Log.Std.Notice("To Address: %s", strings.Join(destinations, ", "))
-	decoder.wm.Log.Std.Notice("Use: %v", balance.StringFixed(decoder.wm.Decimal()))
-	decoder.wm.Log.Std.Notice("Fees: %v", actualFees.StringFixed(decoder.wm.Decimal()))
-	decoder.wm.Log.Std.Notice("Receive: %v", computeTotalSend.StringFixed(decoder.wm.Decimal()))
-	decoder.wm.Log.Std.Notice("Change: %v", changeAmount.StringFixed(decoder.wm.Decimal()))
-	decoder.wm.Log.Std.Notice("Change Address: %v", changeAddress)
-	decoder.wm.Log.Std.Notice("-----------------------------------------------")
+	minFees := decimal.Zero
+	for iteration := 1; ; iteration++ {
 
-	//装配输出
-	for to, amount := range rawTx.To {
-		decamount, _ := decimal.NewFromString(amount)
-		outputAddrs = appendOutput(outputAddrs, to, decamount)
-		//outputAddrs[to] = amount
-	}
+		fees, usedUTXO, err := build(minFees)
+		if err != nil {
+			return err
+		}
 
-	//changeAmount := balance.Sub(totalSend).Sub(actualFees)
-	if changeAmount.GreaterThan(decimal.New(0, 0)) {
-		outputAddrs = appendOutput(outputAddrs, changeAddress, changeAmount)
-		//outputAddrs[changeAddress] = changeAmount.StringFixed(decoder.wm.Decimal())
-	}
+		if decoder.wm.Config.UseFixedFee {
+			return nil
+		}
 
-	err = decoder.createELARawTransaction(wrapper, rawTx, usedUTXO, outputAddrs)
-	if err != nil {
-		return err
-	}
+		requiredFees := decoder.wm.CalculateFee(signedTransactionSize(rawTx.RawHex, countInputAddresses(usedUTXO), rawTx.Account), feesRate)
+		if requiredFees.LessThanOrEqual(fees) {
+			return nil
+		}
 
-	return nil
+		if iteration >= MaxFeeIterations {
+			return openwallet.Errorf(openwallet.ErrInsufficientFees, "fees: %s is not converged, required: %s",
+				fees.StringFixed(decoder.wm.Decimal()), requiredFees.StringFixed(decoder.wm.Decimal()))
+		}
+
+		decoder.wm.Log.Debugf("fees: %s is less than required: %s, recalculate", fees.StringFixed(decoder.wm.Decimal()), requiredFees.StringFixed(decoder.wm.Decimal()))
+		minFees = requiredFees
+	}
 }
 
 //SignRawTransaction 签名交易单
@@ -322,11 +1195,32 @@ func (decoder *TransactionDecoder) SignELARawTransaction(wrapper openwallet.Wall
 		return err
 	}
 
-	keySignatures := rawTx.Signatures[rawTx.Account.AccountID]
-	if keySignatures != nil {
+	signed := false
+
+	//多重签名的交易单，每个拥有者只签自己钱包中的账户
+	for accountID, keySignatures := range rawTx.Signatures {
+
+		account := decoder.getSignerAccount(wrapper, rawTx, accountID)
+		if account == nil {
+			continue
+		}
+
 		for _, keySignature := range keySignatures {
 
-			childKey, err := key.DerivedKeyWithPath(keySignature.Address.HDPath, keySignature.EccType)
+			hdPath, err := ownerHDPath(account, keySignature.Address.HDPath)
+			if err != nil {
+				return err
+			}
+
+			childKey, err := key.DerivedKeyWithPath(hdPath, keySignature.EccType)
+			if err != nil {
+				return err
+			}
+
+			if len(keySignature.Address.PublicKey) > 0 && hex.EncodeToString(childKey.GetPublicKeyBytes()) != keySignature.Address.PublicKey {
+				return fmt.Errorf("address: %s public key is not match the account: %s", keySignature.Address.Address, accountID)
+			}
+
 			keyBytes, err := childKey.GetPrivateKeyBytes()
 			if err != nil {
 				return err
@@ -341,11 +1235,16 @@ func (decoder *TransactionDecoder) SignELARawTransaction(wrapper openwallet.Wall
 
 			keySignature.Signature = hex.EncodeToString(signature)
 		}
+
+		rawTx.Signatures[accountID] = keySignatures
+		signed = true
 	}
 
-	decoder.wm.Log.Info("transaction hash sign success")
+	if !signed {
+		return fmt.Errorf("wallet has not any owner account of the transaction")
+	}
 
-	rawTx.Signatures[rawTx.Account.AccountID] = keySignatures
+	decoder.wm.Log.Info("transaction hash sign success")
 
 	return nil
 }
@@ -355,54 +1254,107 @@ func (decoder *TransactionDecoder) VerifyELARawTransaction(wrapper openwallet.Wa
 
 	var (
 		emptyTrans = rawTx.RawHex
-		sigPubs    = make([]elastosTransaction.SigPub, 0)
+		unlocks    = make(map[string]*addressUnlock)
+		unlockAddr = make([]string, 0)
+		programs   = make([]*txProgram, 0)
+		completed  = true
 	)
 
 	if rawTx.Signatures == nil || len(rawTx.Signatures) == 0 {
 		return fmt.Errorf("transaction signature is empty")
 	}
 
-	//TODO:待支持多重签名
+	txBytes, err := hex.DecodeString(emptyTrans)
+	if err != nil {
+		return fmt.Errorf("transaction hex is invalid")
+	}
 
+	hash := owcrypt.Hash(txBytes, 0, owcrypt.HASH_ALG_SHA256)
+
+	//按输入地址归集公钥和有效签名
 	for accountID, keySignatures := range rawTx.Signatures {
 		decoder.wm.Log.Debug("accountID Signatures:", accountID)
 		for _, keySignature := range keySignatures {
 
-			signature, _ := hex.DecodeString(keySignature.Signature)
-			pubkey, _ := hex.DecodeString(keySignature.Address.PublicKey)
+			unlock, exist := unlocks[keySignature.Address.Address]
+			if !exist {
+				unlock = &addressUnlock{}
+				unlocks[keySignature.Address.Address] = unlock
+				unlockAddr = append(unlockAddr, keySignature.Address.Address)
+			}
+
+			pubkey, err := hex.DecodeString(keySignature.Address.PublicKey)
+			if err != nil {
+				return fmt.Errorf("address: %s public key is invalid", keySignature.Address.Address)
+			}
+			unlock.PublicKeys = append(unlock.PublicKeys, pubkey)
 
-			signaturePubkey := elastosTransaction.SigPub{
-				Signature: signature,
-				PublicKey: pubkey,
+			//未签名的拥有者
+			if len(keySignature.Signature) == 0 {
+				continue
 			}
 
-			sigPubs = append(sigPubs, signaturePubkey)
+			signature, _ := hex.DecodeString(keySignature.Signature)
+			if !verifySignature(pubkey, hash, signature) {
+				decoder.wm.Log.Debugf("address: %s signature of account: %s is invalid", keySignature.Address.Address, accountID)
+				continue
+			}
+
+			unlock.Signatures = append(unlock.Signatures, signature)
 		}
 	}
 
-	////////填充签名结果到空交易单
-	//  传入TxUnlock结构体的原因是： 解锁向脚本支付的UTXO时需要对应地址的赎回脚本， 当前案例的对应字段置为 "" 即可
-	pass, signedTrans := elastosTransaction.VerifyAndCombineRawTransaction(emptyTrans, sigPubs)
-	if pass {
-		decoder.wm.Log.Debug("transaction verify passed")
-		rawTx.IsCompleted = true
-		rawTx.RawHex = signedTrans
-	} else {
+	//每个输入地址生成一个解锁脚本
+	for _, address := range unlockAddr {
+		program, isComplete, err := decoder.createProgram(address, unlocks[address], rawTx.Required)
+		if err != nil {
+			return err
+		}
+		if !isComplete {
+			decoder.wm.Log.Debugf("address: %s signatures is not enough", address)
+			completed = false
+			continue
+		}
+		programs = append(programs, program)
+	}
+
+	if !completed {
 		decoder.wm.Log.Debug("transaction verify failed")
 		rawTx.IsCompleted = false
+		return nil
+	}
+
+	////////填充签名结果到空交易单
+	signedTrans, err := combineRawTransaction(emptyTrans, programs)
+	if err != nil {
+		return err
 	}
 
+	decoder.wm.Log.Debug("transaction verify passed")
+	rawTx.IsCompleted = true
+	rawTx.RawHex = signedTrans
+
 	return nil
 }
 
 //GetRawTransactionFeeRate 获取交易单的费率
 func (decoder *TransactionDecoder) GetRawTransactionFeeRate() (feeRate string, unit string, err error) {
-	rate, err := decoder.wm.EstimateFeeRate()
+	feeRate, unit, source, err := decoder.GetRawTransactionFeeRateWithSource()
 	if err != nil {
 		return "", "", err
 	}
+	decoder.wm.Log.Infof("fee rate: %s/%s, source: %s", feeRate, unit, source)
+	return feeRate, unit, nil
+}
+
+//GetRawTransactionFeeRateWithSource 获取交易单的费率及其来源
+func (decoder *TransactionDecoder) GetRawTransactionFeeRateWithSource() (feeRate string, unit string, source string, err error) {
+	estimate, err := decoder.wm.EstimateFeeRateWithSource()
+	if err != nil {
+		return "", "", "", err
+	}
 
-	return rate.StringFixed(decoder.wm.Decimal()), "K", nil
+	return estimate.FeeRate.StringFixed(decoder.wm.Decimal()), "K", estimate.Source, nil
 }
 
 //CreateELASummaryRawTransaction 创建ELA汇总交易
@@ -418,12 +1370,21 @@ func (decoder *TransactionDecoder) CreateELASummaryRawTransaction(wrapper openwa
 		sumUnspents        []*Unspent
 		outputAddrs        map[string]decimal.Decimal
 		totalInputAmount   decimal.Decimal
+		addrUnspents       = make(map[string][]*Unspent)
 	)
 
+	if sumRawTx.Coin.IsContract {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "token summary is not supported")
+	}
+
 	if minTransfer.LessThan(retainedBalance) {
 		return nil, fmt.Errorf("mini transfer amount must be greater than address retained balance")
 	}
 
+	if addrErr := decoder.checkReceiverAddress(sumRawTx.SummaryAddress); addrErr != nil {
+		return nil, addrErr
+	}
+
 	address, err := wrapper.GetAddressList(sumRawTx.AddressStartIndex, sumRawTx.AddressLimit, "AccountID", sumRawTx.Account.AccountID)
 	if err != nil {
 		return nil, err
@@ -459,27 +1420,42 @@ func (decoder *TransactionDecoder) CreateELASummaryRawTransaction(wrapper openwa
 
 	//取得费率
 	if len(sumRawTx.FeeRate) == 0 {
-		feesRate, err = decoder.wm.EstimateFeeRate()
+		estimate, err := decoder.wm.EstimateFeeRateWithSource()
 		if err != nil {
 			return nil, err
 		}
+		feesRate = estimate.FeeRate
+		decoder.wm.Log.Debugf("summary fee rate: %s, source: %s, min relay applied: %v", feesRate.String(), estimate.Source, estimate.MinRelayApplied)
 	} else {
 		feesRate, _ = decimal.NewFromString(sumRawTx.FeeRate)
 	}
 
+	//查询节点不占用选币锁
+	for _, addr := range sumAddresses {
+		unspents, err := decoder.wm.ListUnspent(sumRawTx.Confirms, addr)
+		if err != nil {
+			return nil, err
+		}
+		addrUnspents[addr] = unspents
+	}
+
+	decoder.selectionMu.Lock()
+	defer decoder.selectionMu.Unlock()
+
 	sumUnspents = make([]*Unspent, 0)
 	outputAddrs = make(map[string]decimal.Decimal, 0)
 	totalInputAmount = decimal.Zero
 
 	for i, addr := range sumAddresses {
 
-		unspents, err := decoder.wm.ListUnspent(sumRawTx.Confirms, addr)
+		unspents, err := decoder.wm.availableUnspents(addrUnspents[addr])
 		if err != nil {
+			decoder.unlockRawTransactions(rawTxArray)
 			return nil, err
 		}
 
-		//尽可能筹够最大input数
-		if len(unspents)+len(sumUnspents) < decoder.wm.Config.MaxTxInputs {
+		//尽可能筹够最大input数，没有可用utxo的地址不汇总，也不输出保留余额
+		if len(unspents) > 0 && len(unspents)+len(sumUnspents) < decoder.wm.Config.MaxTxInputs {
 			sumUnspents = append(sumUnspents, unspents...)
 			if retainedBalance.GreaterThan(decimal.Zero) {
 				outputAddrs = appendOutput(outputAddrs, addr, retainedBalance)
@@ -489,31 +1465,20 @@ func (decoder *TransactionDecoder) CreateELASummaryRawTransaction(wrapper openwa
 		}
 
 		//如果utxo已经超过最大输入，或遍历地址完结，就可以进行构建交易单
-		if i == len(sumAddresses)-1 || len(sumUnspents) >= decoder.wm.Config.MaxTxInputs {
+		if len(sumUnspents) > 0 && (i == len(sumAddresses)-1 || len(sumUnspents) >= decoder.wm.Config.MaxTxInputs) {
 			//执行构建交易单工作
 			//decoder.wm.Log.Debugf("sumUnspents: %+v", sumUnspents)
-			//计算手续费，构建交易单inputs，地址保留余额>0，地址需要加入输出，最后+1是汇总地址
-			sigCount := int64(0)
-			fromAddrs := []string{}
-		summarySigCountLabel:
-			for _, utxo := range sumUnspents {
-				for _, addr := range fromAddrs {
-					if addr == utxo.Address {
-						continue summarySigCountLabel
-					}
-				}
-				sigCount++
+			//计算手续费，构建交易单inputs，地址保留余额>0，地址需要加入输出，最后是汇总地址
+			summaryOutputs := make([]string, 0, len(outputAddrs)+1)
+			for addr := range outputAddrs {
+				summaryOutputs = append(summaryOutputs, addr)
 			}
+			summaryOutputs = append(summaryOutputs, sumRawTx.SummaryAddress)
 
-			fees := decimal.Zero
-			var createErr error
-			if decoder.wm.Config.UseFixedFee {
-				fees, _ = decimal.NewFromString(decoder.wm.Config.FixedFee)
-			} else {
-				fees, createErr = decoder.wm.EstimateFee(int64(len(sumUnspents)), int64(len(outputAddrs)+1), sigCount, feesRate)
-				if createErr != nil {
-					return nil, createErr
-				}
+			estimated, createErr := decoder.estimateTxFees(sumRawTx.Account, sumUnspents, summaryOutputs, false, feesRate)
+			if createErr != nil {
+				decoder.unlockRawTransactions(rawTxArray)
+				return nil, createErr
 			}
 
 			//计算这笔交易单的汇总数量
@@ -525,42 +1490,58 @@ func (decoder *TransactionDecoder) CreateELASummaryRawTransaction(wrapper openwa
 				}
 			}
 
-			/*
-
-					汇总数量计算：
-
-					1. 输入总数量 = 合计账户地址的所有utxo
-					2. 账户地址输出总数量 = 账户地址保留余额 * 地址数
-				    3. 汇总数量 = 输入总数量 - 账户地址输出总数量 - 手续费
-			*/
-			retainedBalanceTotal := retainedBalance.Mul(decimal.New(int64(len(outputAddrs)), 0))
-			sumAmount := totalInputAmount.Sub(retainedBalanceTotal).Sub(fees)
-
-			decoder.wm.Log.Debugf("totalInputAmount: %v", totalInputAmount)
-			decoder.wm.Log.Debugf("retainedBalanceTotal: %v", retainedBalanceTotal)
-			decoder.wm.Log.Debugf("fees: %v", fees)
-			decoder.wm.Log.Debugf("sumAmount: %v", sumAmount)
-
-			//最后填充汇总地址及汇总数量
-			outputAddrs = appendOutput(outputAddrs, sumRawTx.SummaryAddress, sumAmount)
-			//outputAddrs[sumRawTx.SummaryAddress] = sumAmount.StringFixed(decoder.wm.Decimal())
-
-			raxTxTo := make(map[string]string, 0)
-			for a, m := range outputAddrs {
-				raxTxTo[a] = m.StringFixed(decoder.wm.Decimal())
-			}
-
 			//创建一笔交易单
 			rawTx := &openwallet.RawTransaction{
 				Coin:     sumRawTx.Coin,
 				Account:  sumRawTx.Account,
 				FeeRate:  sumRawTx.FeeRate,
-				To:       raxTxTo,
-				Fees:     fees.StringFixed(decoder.wm.Decimal()),
 				Required: 1,
 			}
 
-			createErr = decoder.createELARawTransaction(wrapper, rawTx, sumUnspents, outputAddrs)
+			//按构建后的实际长度重新计算手续费，直到收敛
+			retainedOutputs := outputAddrs
+			createErr = decoder.convergeFees(rawTx, feesRate, func(minFees decimal.Decimal) (decimal.Decimal, []*Unspent, error) {
+
+				fees := decimal.Max(estimated, minFees)
+
+				/*
+
+						汇总数量计算：
+
+						1. 输入总数量 = 合计账户地址的所有utxo
+						2. 账户地址输出总数量 = 账户地址保留余额 * 地址数
+					    3. 汇总数量 = 输入总数量 - 账户地址输出总数量 - 手续费
+				*/
+				retainedBalanceTotal := retainedBalance.Mul(decimal.New(int64(len(retainedOutputs)), 0))
+				sumAmount := totalInputAmount.Sub(retainedBalanceTotal).Sub(fees)
+
+				decoder.wm.Log.Debugf("totalInputAmount: %v", totalInputAmount)
+				decoder.wm.Log.Debugf("retainedBalanceTotal: %v", retainedBalanceTotal)
+				decoder.wm.Log.Debugf("fees: %v", fees)
+				decoder.wm.Log.Debugf("sumAmount: %v", sumAmount)
+
+				//最后填充汇总地址及汇总数量
+				outputAddrs = make(map[string]decimal.Decimal, len(retainedOutputs)+1)
+				for a, m := range retainedOutputs {
+					outputAddrs[a] = m
+				}
+				outputAddrs = appendOutput(outputAddrs, sumRawTx.SummaryAddress, sumAmount)
+
+				raxTxTo := make(map[string]string, 0)
+				for a, m := range outputAddrs {
+					raxTxTo[a] = m.StringFixed(decoder.wm.Decimal())
+				}
+				rawTx.To = raxTxTo
+				rawTx.Fees = fees.StringFixed(decoder.wm.Decimal())
+
+				if err := decoder.createELARawTransaction(wrapper, rawTx, sumUnspents, outputAddrs); err != nil {
+					return decimal.Zero, nil, err
+				}
+				return fees, sumUnspents, nil
+			})
+			if createErr == nil {
+				createErr = decoder.lockRawTransactions(&builtTransaction{rawTx: rawTx, usedUTXO: sumUnspents})
+			}
 			rawTxWithErr := &openwallet.RawTransactionWithError{
 				RawTx: rawTx,
 				Error: openwallet.ConvertError(createErr),
@@ -580,6 +1561,20 @@ func (decoder *TransactionDecoder) CreateELASummaryRawTransaction(wrapper openwa
 	return rawTxArray, nil
 }
 
+//assetOutput 交易单的一个输出
+type assetOutput struct {
+	AssetID string
+	Address string
+	Amount  decimal.Decimal
+	//跨链输出的侧链地址及侧链到账金额，Address为侧链的锁定地址
+	CrossChainAddress string
+	CrossChainAmount  decimal.Decimal
+	//投票输出的候选人，输出金额为票数
+	Vote *voteParam
+	//输出锁定的区块高度
+	OutputLock uint32
+}
+
 //createELARawTransaction 创建ELA原始交易单
 func (decoder *TransactionDecoder) createELARawTransaction(
 	wrapper openwallet.WalletDAI,
@@ -588,12 +1583,28 @@ func (decoder *TransactionDecoder) createELARawTransaction(
 	to map[string]decimal.Decimal,
 ) error {
 
+	outputs := make([]*assetOutput, 0, len(to))
+	for addr, amount := range to {
+		outputs = append(outputs, &assetOutput{AssetID: elastosTransaction.AssetID_ELA, Address: addr, Amount: amount})
+	}
+
+	return decoder.createAssetRawTransaction(wrapper, rawTx, usedUTXO, outputs, elastosTransaction.AssetID_ELA)
+}
+
+//createAssetRawTransaction 创建原始交易单，输出可以是不同的资产。
+//交易单记录的发送方、接收方及金额只统计mainAssetID的资产，手续费只在ELA转账时计入。
+func (decoder *TransactionDecoder) createAssetRawTransaction(
+	wrapper openwallet.WalletDAI,
+	rawTx *openwallet.RawTransaction,
+	usedUTXO []*Unspent,
+	outputs []*assetOutput,
+	mainAssetID string,
+) error {
+
 	var (
 		err              error
-		vins             = make([]elastosTransaction.Vin, 0)
-		vouts            = make([]elastosTransaction.Vout, 0)
-		totalSend        = decimal.New(0, 0)
-		destinations     = make([]string, 0)
+		vins             = make([]*txInput, 0)
+		vouts            = make([]*txOutput, 0)
 		accountTotalSent = decimal.Zero
 		txFrom           = make([]string, 0)
 		txTo             = make([]string, 0)
@@ -604,48 +1615,120 @@ func (decoder *TransactionDecoder) createELARawTransaction(
 		return fmt.Errorf("utxo is empty")
 	}
 
-	if len(to) == 0 {
+	if len(outputs) == 0 {
 		return fmt.Errorf("Receiver addresses is empty! ")
 	}
 
 	//计算总发送金额
-	for addr, amount := range to {
-		//deamount, _ := decimal.NewFromString(amount)
-		totalSend = totalSend.Add(amount)
-		destinations = append(destinations, addr)
+	for _, output := range outputs {
+		if len(output.CrossChainAddress) > 0 {
+			if addrErr := decoder.checkSideChainAddress(output.CrossChainAddress); addrErr != nil {
+				return addrErr
+			}
+			if addressType, _ := decoder.wm.Decoder.GetAddressType(output.Address); addressType != AddressTypeCrossChain {
+				return openwallet.Errorf(openwallet.ErrAdressDecodeFailed, "cross chain lock address: %s is invalid", output.Address)
+			}
+		} else if addrErr := decoder.checkReceiverAddress(output.Address); addrErr != nil {
+			return addrErr
+		}
+		if output.AssetID != mainAssetID {
+			continue
+		}
 		//计算账户的实际转账amount
-		addresses, findErr := wrapper.GetAddressList(0, -1, "AccountID", accountID, "Address", addr)
+		addresses, findErr := wrapper.GetAddressList(0, -1, "AccountID", accountID, "Address", output.Address)
 		if findErr != nil || len(addresses) == 0 {
-			//amountDec, _ := decimal.NewFromString(amount)
-			accountTotalSent = accountTotalSent.Add(amount)
+			accountTotalSent = accountTotalSent.Add(output.Amount)
 		}
 	}
 
 	//UTXO如果大于设定限制，则分拆成多笔交易单发送
 	if len(usedUTXO) > decoder.wm.Config.MaxTxInputs {
-		errStr := fmt.Sprintf("The transaction is use max inputs over: %d", decoder.wm.Config.MaxTxInputs)
-		return errors.New(errStr)
+		return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "The transaction is use max inputs over: %d", decoder.wm.Config.MaxTxInputs)
 	}
 
-	//装配输入
+	//装配输入，花费有输出锁定的utxo时，输入序号为0xFFFFFFFE，交易单的LockTime不小于输出锁定高度
+	lockTime := uint32(0)
 	for _, utxo := range usedUTXO {
-		in := elastosTransaction.Vin{TxID: utxo.TxID, Vout: uint16(utxo.Vout), Address: utxo.Address}
+		in := &txInput{TxID: utxo.TxID, Vout: uint16(utxo.Vout), Sequence: 0xFFFFFFFF, Address: utxo.Address}
+		if utxo.OutputLock > 0 {
+			in.Sequence = 0xFFFFFFFE
+			if uint32(utxo.OutputLock) > lockTime {
+				lockTime = uint32(utxo.OutputLock)
+			}
+		}
 		//in := btcTransaction.Vin{utxo.TxID, uint32(utxo.Vout)}
 		vins = append(vins, in)
 
-		txFrom = append(txFrom, fmt.Sprintf("%s:%s", utxo.Address, utxo.Amount))
+		if utxoAssetID(utxo) == mainAssetID {
+			txFrom = append(txFrom, fmt.Sprintf("%s:%s", utxo.Address, utxo.Amount))
+		}
 	}
 
-	//装配输入
-	for to, amount := range to {
-		txTo = append(txTo, fmt.Sprintf("%s:%s", to, amount.String()))
-		amount = amount.Shift(decoder.wm.Decimal())
-		out := elastosTransaction.Vout{AssetID: elastosTransaction.AssetID_ELA, Amount: uint64(amount.IntPart()), Address: to}
+	//装配输出，ELA金额为8位小数的定点数，代币金额按资产精度放大为整数
+	crossChain := &crossChainPayload{}
+	hasVote := false
+	for i, output := range outputs {
+		if output.AssetID == mainAssetID {
+			txTo = append(txTo, fmt.Sprintf("%s:%s", output.Address, output.Amount.String()))
+		}
+		out := &txOutput{AssetID: output.AssetID, OutputLock: output.OutputLock, Address: output.Address}
+		if output.AssetID == elastosTransaction.AssetID_ELA {
+			out.Amount, err = decoder.elaValue(output.Amount)
+		} else {
+			out.TokenValue, err = assetValue(output.Amount, decoder.assetDecimals(rawTx, output.AssetID))
+		}
+		if err != nil {
+			return err
+		}
 		vouts = append(vouts, out)
+
+		if output.Vote != nil {
+			if output.AssetID != elastosTransaction.AssetID_ELA {
+				return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "vote output must be ELA")
+			}
+			payload, err := output.Vote.payload(out.Amount)
+			if err != nil {
+				return err
+			}
+			out.Type = OutputTypeVote
+			out.Payload = payload.Serialize()
+			hasVote = true
+		}
+
+		if len(output.CrossChainAddress) > 0 {
+			crossChain.Addresses = append(crossChain.Addresses, output.CrossChainAddress)
+			crossChain.OutputIndexes = append(crossChain.OutputIndexes, uint64(i))
+			crossChainAmount, err := decoder.elaValue(output.CrossChainAmount)
+			if err != nil {
+				return err
+			}
+			crossChain.Amounts = append(crossChain.Amounts, crossChainAmount)
+		}
 	}
+
 	/////////构建空交易单
-	emptyTrans, transHashes, err := elastosTransaction.CreateEmptyRawTransactionAndHash(vins, vouts)
+	var emptyTx *elaTransaction
+	if len(crossChain.Addresses) > 0 {
+		emptyTx, err = newCrossChainTransaction(vins, vouts, crossChain)
+	} else {
+		emptyTx, err = newTransferTransaction(vins, vouts)
+	}
+	if err != nil {
+		return fmt.Errorf("create transaction failed, unexpected error: %v", err)
+	}
+
+	//投票输出需要0x09版本的交易单
+	if hasVote {
+		emptyTx.Version = TxVersion09
+	}
+	emptyTx.LockTime = lockTime
+
+	//备注记录在交易属性中
+	if memo := rawTx.GetExtParam().Get("memo").String(); len(memo) > 0 {
+		emptyTx.Attributes = append(emptyTx.Attributes, &txAttribute{Usage: AttributeUsageMemo, Data: []byte(memo)})
+	}
 
+	emptyTrans, transHashes, err := emptyTx.CreateEmptyRawTransactionAndHash()
 	if err != nil {
 		return fmt.Errorf("create transaction failed, unexpected error: %v", err)
 	}
@@ -656,6 +1739,15 @@ func (decoder *TransactionDecoder) createELARawTransaction(
 		rawTx.Signatures = make(map[string][]*openwallet.KeySignature)
 	}
 
+	//多重签名账户，每个拥有者都需要对输入地址签名
+	isMultiSig := len(rawTx.Account.OwnerKeys) > 1
+	if isMultiSig {
+		rawTx.Required = rawTx.Account.Required
+		for _, ownerKey := range rawTx.Account.OwnerKeys {
+			delete(rawTx.Signatures, openwallet.GenAccountID(ownerKey))
+		}
+	}
+
 	//装配签名
 	keySigs := make([]*openwallet.KeySignature, 0)
 
@@ -674,6 +1766,31 @@ func (decoder *TransactionDecoder) createELARawTransaction(
 			return err
 		}
 
+		if isMultiSig {
+			//多重签名要使用owner的公钥填充
+			for _, ownerKey := range rawTx.Account.OwnerKeys {
+				ownerPub, err := deriveOwnerPublicKey(ownerKey, addr.HDPath)
+				if err != nil {
+					return err
+				}
+
+				ownerAccountID := openwallet.GenAccountID(ownerKey)
+				ownerAddr := *addr
+				ownerAddr.AccountID = ownerAccountID
+				ownerAddr.PublicKey = hex.EncodeToString(ownerPub)
+
+				signature := openwallet.KeySignature{
+					EccType: decoder.wm.Config.CurveType,
+					Nonce:   "",
+					Address: &ownerAddr,
+					Message: beSignHex,
+				}
+
+				rawTx.Signatures[ownerAccountID] = append(rawTx.Signatures[ownerAccountID], &signature)
+			}
+			continue
+		}
+
 		signature := openwallet.KeySignature{
 			EccType: decoder.wm.Config.CurveType,
 			Nonce:   "",
@@ -685,15 +1802,17 @@ func (decoder *TransactionDecoder) createELARawTransaction(
 
 	}
 
-	feesDec, _ := decimal.NewFromString(rawTx.Fees)
-	accountTotalSent = accountTotalSent.Add(feesDec)
+	if mainAssetID == elastosTransaction.AssetID_ELA {
+		feesDec, _ := decimal.NewFromString(rawTx.Fees)
+		accountTotalSent = accountTotalSent.Add(feesDec)
+	}
 	accountTotalSent = decimal.Zero.Sub(accountTotalSent)
 
-	//TODO:多重签名要使用owner的公钥填充
-
-	rawTx.Signatures[rawTx.Account.AccountID] = keySigs
+	if !isMultiSig {
+		rawTx.Signatures[rawTx.Account.AccountID] = keySigs
+	}
 	rawTx.IsBuilt = true
-	rawTx.TxAmount = accountTotalSent.StringFixed(decoder.wm.Decimal())
+	rawTx.TxAmount = accountTotalSent.StringFixed(decoder.assetDecimals(rawTx, mainAssetID))
 	rawTx.TxFrom = txFrom
 	rawTx.TxTo = txTo
 
@@ -772,6 +1891,34 @@ func removeUTXO(slice []*Unspent, elem *Unspent) []*Unspent {
 	return slice
 }
 
+//removeUTXOs 移除已使用的utxo
+func removeUTXOs(slice []*Unspent, used []*Unspent) []*Unspent {
+	remain := make([]*Unspent, 0, len(slice))
+loop:
+	for _, u := range slice {
+		for _, e := range used {
+			if u == e {
+				continue loop
+			}
+		}
+		remain = append(remain, u)
+	}
+	return remain
+}
+
+//sortUnspentsByAmount utxo按金额从小到大排序
+func sortUnspentsByAmount(unspents []*Unspent) {
+	sort.Sort(UnspentSort{unspents, func(a, b *Unspent) int {
+		a_amount, _ := decimal.NewFromString(a.Amount)
+		b_amount, _ := decimal.NewFromString(b.Amount)
+		if a_amount.GreaterThan(b_amount) {
+			return 1
+		} else {
+			return -1
+		}
+	}})
+}
+
 func appendOutput(output map[string]decimal.Decimal, address string, amount decimal.Decimal) map[string]decimal.Decimal {
 	if origin, ok := output[address]; ok {
 		origin = origin.Add(amount)
@@ -781,3 +1928,145 @@ func appendOutput(output map[string]decimal.Decimal, address string, amount deci
 	}
 	return output
 }
+
+//checkReceiverAddress 检查接收地址，普通转账只能发送到标准地址和多重签名地址
+func (decoder *TransactionDecoder) checkReceiverAddress(address string) *openwallet.Error {
+	addressType, err := decoder.wm.Decoder.GetAddressType(address)
+	if err != nil {
+		return openwallet.Errorf(openwallet.ErrAdressDecodeFailed, "receiver address is invalid, %v", err)
+	}
+	if !addressType.IsTransferable() {
+		return openwallet.Errorf(openwallet.ErrAdressDecodeFailed, "receiver address: %s type: %s is not supported", address, addressType)
+	}
+	return nil
+}
+
+//addressUnlock 输入地址的公钥及有效签名
+type addressUnlock struct {
+	PublicKeys [][]byte
+	Signatures [][]byte
+}
+
+//createProgram 创建输入地址的解锁脚本，返回签名是否足够
+func (decoder *TransactionDecoder) createProgram(address string, unlock *addressUnlock, required uint64) (*txProgram, bool, error) {
+
+	var (
+		code      []byte
+		parameter = make([]byte, 0)
+		needSigs  = 1
+	)
+
+	programHash, err := addressToProgramHash(address)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if programHash[0] == PrefixMultiSig {
+		if required == 0 {
+			return nil, false, fmt.Errorf("multisig address: %s required signatures is zero", address)
+		}
+
+		code, err = CreateMultiSigRedeemScript(unlock.PublicKeys, required)
+		if err != nil {
+			return nil, false, err
+		}
+
+		//校验拥有者公钥能否生成该地址
+		multiSigAddr, err := decoder.wm.Decoder.RedeemScriptToAddress(unlock.PublicKeys, required, false)
+		if err != nil {
+			return nil, false, err
+		}
+		if multiSigAddr != address {
+			return nil, false, fmt.Errorf("owner public keys can not unlock multisig address: %s", address)
+		}
+
+		needSigs = int(required)
+	} else {
+		if len(unlock.PublicKeys) != 1 {
+			return nil, false, fmt.Errorf("address: %s has more than one public key", address)
+		}
+		code = standardProgramCode(unlock.PublicKeys[0])
+	}
+
+	if len(unlock.Signatures) < needSigs {
+		return nil, false, nil
+	}
+
+	for _, signature := range unlock.Signatures[:needSigs] {
+		parameter = append(parameter, byte(len(signature)))
+		parameter = append(parameter, signature...)
+	}
+
+	return &txProgram{Code: code, Parameter: parameter}, true, nil
+}
+
+//getSignerAccount 获取当前钱包中可签名的拥有者账户
+func (decoder *TransactionDecoder) getSignerAccount(wrapper openwallet.WalletDAI, rawTx *openwallet.RawTransaction, accountID string) *openwallet.AssetsAccount {
+
+	if rawTx.Account != nil && rawTx.Account.AccountID == accountID {
+		return rawTx.Account
+	}
+
+	account, err := wrapper.GetAssetsAccountInfo(accountID)
+	if err != nil || account == nil {
+		return nil
+	}
+
+	wallet := wrapper.GetWallet()
+	if wallet == nil || wallet.WalletID != account.WalletID {
+		return nil
+	}
+
+	return account
+}
+
+//ownerHDPath 拥有者账户路径+地址的change/index，得到拥有者的子密钥路径
+func ownerHDPath(account *openwallet.AssetsAccount, addressPath string) (string, error) {
+
+	if len(account.HDPath) == 0 || strings.HasPrefix(addressPath, account.HDPath+"/") {
+		return addressPath, nil
+	}
+
+	paths := strings.Split(addressPath, "/")
+	if len(paths) < 2 {
+		return "", fmt.Errorf("address hdPath: %s is invalid", addressPath)
+	}
+
+	return strings.Join(append([]string{account.HDPath}, paths[len(paths)-2:]...), "/"), nil
+}
+
+//deriveOwnerPublicKey 拥有者的账户公钥按地址路径的change/index衍生子公钥
+func deriveOwnerPublicKey(ownerKey string, addressPath string) ([]byte, error) {
+
+	paths := strings.Split(addressPath, "/")
+	if len(paths) < 2 {
+		return nil, fmt.Errorf("address hdPath: %s is invalid", addressPath)
+	}
+
+	change, err := strconv.ParseUint(paths[len(paths)-2], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("address hdPath: %s is invalid", addressPath)
+	}
+
+	index, err := strconv.ParseUint(paths[len(paths)-1], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("address hdPath: %s is invalid", addressPath)
+	}
+
+	pubkey, err := owkeychain.OWDecode(ownerKey)
+	if err != nil {
+		return nil, err
+	}
+
+	start, err := pubkey.GenPublicChild(uint32(change))
+	if err != nil {
+		return nil, err
+	}
+
+	child, err := start.GenPublicChild(uint32(index))
+	if err != nil {
+		return nil, err
+	}
+
+	return child.GetPublicKeyBytes(), nil
+}
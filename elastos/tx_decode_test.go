@@ -16,12 +16,1554 @@
 package elastos
 
 import (
-	"github.com/shopspring/decimal"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/blocktree/go-owcdrivers/elastosTransaction"
+	"github.com/blocktree/openwallet/hdkeystore"
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/shopspring/decimal"
+	"github.com/tidwall/gjson"
 )
 
 func TestDecimalShit(t *testing.T) {
 	num, _ := decimal.NewFromString("0.00005")
 	num2 := num.Shift(-1)
 	t.Logf("balance: %v\n", num2)
-}
\ No newline at end of file
+}
+
+//testWalletDAI 测试用的钱包数据接口
+type testWalletDAI struct {
+	openwallet.WalletDAIBase
+	wallet    *openwallet.Wallet
+	key       *hdkeystore.HDKey
+	accounts  map[string]*openwallet.AssetsAccount
+	addresses map[string]*openwallet.Address
+}
+
+func newTestWalletDAI(t *testing.T, walletID string, seed byte) *testWalletDAI {
+	seedBytes := make([]byte, 32)
+	for i := range seedBytes {
+		seedBytes[i] = seed
+	}
+	key, err := hdkeystore.NewHDKey(seedBytes, walletID, "m/44'/88'")
+	if err != nil {
+		t.Fatalf("NewHDKey failed unexpected error: %v", err)
+	}
+	return &testWalletDAI{
+		wallet:    &openwallet.Wallet{WalletID: walletID},
+		key:       key,
+		accounts:  make(map[string]*openwallet.AssetsAccount),
+		addresses: make(map[string]*openwallet.Address),
+	}
+}
+
+//newAccount 创建账户，otherKeys不为空时为多重签名账户
+func (w *testWalletDAI) newAccount(t *testing.T, required uint64, otherKeys ...string) *openwallet.AssetsAccount {
+	hdPath := "m/44'/88'/1'"
+	childKey, err := w.key.DerivedKeyWithPath(hdPath, CurveType)
+	if err != nil {
+		t.Fatalf("DerivedKeyWithPath failed unexpected error: %v", err)
+	}
+	account := &openwallet.AssetsAccount{
+		WalletID:  w.wallet.WalletID,
+		HDPath:    hdPath,
+		PublicKey: childKey.GetPublicKey().OWEncode(),
+		Required:  required,
+		Symbol:    Symbol,
+	}
+	account.AccountID = account.GetAccountID()
+	account.OwnerKeys = append([]string{account.PublicKey}, otherKeys...)
+	w.accounts[account.AccountID] = account
+	return account
+}
+
+//newAddress 创建账户的第一个地址
+func (w *testWalletDAI) newAddress(t *testing.T, account *openwallet.AssetsAccount) *openwallet.Address {
+	addr, err := w.deriveAddress(account, false, 0)
+	if err != nil {
+		t.Fatalf("create address failed unexpected error: %v", err)
+	}
+	return addr
+}
+
+//deriveAddress 派生并保存账户地址
+func (w *testWalletDAI) deriveAddress(account *openwallet.AssetsAccount, isChange bool, index uint64) (*openwallet.Address, error) {
+	changeIndex := 0
+	if isChange {
+		changeIndex = 1
+	}
+	hdPath := fmt.Sprintf("%s/%d/%d", account.HDPath, changeIndex, index)
+	pubs := make([][]byte, 0)
+	for _, ownerKey := range account.OwnerKeys {
+		pub, err := deriveOwnerPublicKey(ownerKey, hdPath)
+		if err != nil {
+			return nil, err
+		}
+		pubs = append(pubs, pub)
+	}
+	addr := &openwallet.Address{AccountID: account.AccountID, HDPath: hdPath, Index: index, IsChange: isChange, Symbol: Symbol}
+	var err error
+	if len(pubs) > 1 {
+		addr.Address, err = tw.Decoder.RedeemScriptToAddress(pubs, account.Required, false)
+	} else {
+		addr.Address, err = tw.Decoder.PublicKeyToAddress(pubs[0], false)
+		addr.PublicKey = hex.EncodeToString(pubs[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+	w.addresses[addr.Address] = addr
+	return addr, nil
+}
+
+//CreateAddress 模拟openw.WalletWrapper创建地址
+func (w *testWalletDAI) CreateAddress(accountID string, count uint64, decoder openwallet.AddressDecoder, isChange bool, isTestNet bool) ([]*openwallet.Address, error) {
+	account, ok := w.accounts[accountID]
+	if !ok {
+		return nil, fmt.Errorf("account not found")
+	}
+	addrs := make([]*openwallet.Address, 0)
+	for i := uint64(0); i < count; i++ {
+		account.AddressIndex++
+		addr, err := w.deriveAddress(account, isChange, uint64(account.AddressIndex))
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+func (w *testWalletDAI) GetWallet() *openwallet.Wallet {
+	return w.wallet
+}
+
+func (w *testWalletDAI) HDKey(password ...string) (*hdkeystore.HDKey, error) {
+	return w.key, nil
+}
+
+func (w *testWalletDAI) GetAssetsAccountInfo(accountID string) (*openwallet.AssetsAccount, error) {
+	account, ok := w.accounts[accountID]
+	if !ok {
+		return nil, fmt.Errorf("account not found")
+	}
+	return account, nil
+}
+
+func (w *testWalletDAI) GetAddress(address string) (*openwallet.Address, error) {
+	addr, ok := w.addresses[address]
+	if !ok {
+		return nil, fmt.Errorf("address not found")
+	}
+	return addr, nil
+}
+
+func (w *testWalletDAI) GetAddressList(offset, limit int, cols ...interface{}) ([]*openwallet.Address, error) {
+	list := make([]*openwallet.Address, 0)
+	for _, addr := range w.addresses {
+		match := true
+		for i := 0; i+1 < len(cols); i += 2 {
+			switch cols[i] {
+			case "AccountID":
+				match = match && addr.AccountID == cols[i+1]
+			case "Address":
+				match = match && addr.Address == cols[i+1]
+			case "IsChange":
+				match = match && addr.IsChange == cols[i+1]
+			}
+		}
+		if match {
+			list = append(list, addr)
+		}
+	}
+	return list, nil
+}
+
+func TestElaTransaction_TokenOutput(t *testing.T) {
+
+	//代币侧链的输出：ELA金额为8字节定点数，代币金额为大端整数的变长字节，40.5按精度18放大为0x02320ce76bfb520000
+	expected := "020000013a1d4ec68ade01ef50eb1aa1ec891cd0f75cd158a32f9b7a50664d3100a5c54e0100ffffffff02" +
+		"e8d7c6b5a4938271605f4e3d2c1b0af9e8d7c6b5a4938271604f2e3d9c5b1a8f" + "0902320ce76bfb520000" + "00000000" + "21159b0cc4b8519a5f74f6d7f0e0841770342c0d81" +
+		"b037db964a231458d2d6ffd5ea18944c4f90e63d547c5d3b9874df66a4ead0a3" + "1027000000000000" + "00000000" + "2166390a342e73b750424b4c41c2108cdb40153aa1" +
+		"00000000"
+
+	tokenID := "8f1a5b9c3d2e4f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8"
+	tokenValue, err := assetValue(decimal.RequireFromString("40.5"), MaxAssetPrecision)
+	if err != nil {
+		t.Fatalf("assetValue failed unexpected error: %v", err)
+	}
+
+	inputs := []*txInput{
+		{TxID: "4ec5a500314d66507a9b2fa358d15cf7d01c89eca11aeb50ef01de8ac64e1d3a", Vout: 1, Sequence: 0xFFFFFFFF, Address: "ESUQkMEsfUdbmrounnCrNdVHLXrvSzvy7A"},
+	}
+	outputs := []*txOutput{
+		{AssetID: tokenID, TokenValue: tokenValue, Address: "EK89RfdqPUr82EUHQy5KNVH3LSmNsQLPau"},
+		{AssetID: elastosTransaction.AssetID_ELA, Amount: 10000, Address: "ESUQkMEsfUdbmrounnCrNdVHLXrvSzvy7A"},
+	}
+	tx, err := newTransferTransaction(inputs, outputs)
+	if err != nil {
+		t.Fatalf("newTransferTransaction failed unexpected error: %v", err)
+	}
+	emptyTrans, _, err := tx.CreateEmptyRawTransactionAndHash()
+	if err != nil {
+		t.Fatalf("CreateEmptyRawTransactionAndHash failed unexpected error: %v", err)
+	}
+	if emptyTrans != expected {
+		t.Errorf("emptyTrans = %s, expected = %s", emptyTrans, expected)
+	}
+
+	//代币输出缺少金额
+	outputs[0].TokenValue = nil
+	if _, err := tx.SerializeUnsigned(); err == nil {
+		t.Errorf("SerializeUnsigned token output without value should be failed")
+	}
+
+	invalid := []struct {
+		amount    string
+		precision int32
+	}{
+		{"1.00001", 4},
+		{"0.0000000000000000001", MaxAssetPrecision},
+		{"1", MaxAssetPrecision + 1},
+		{"-1", 8},
+	}
+	for _, test := range invalid {
+		if _, err := assetValue(decimal.RequireFromString(test.amount), test.precision); err == nil {
+			t.Errorf("assetValue amount: %s precision: %d should be failed", test.amount, test.precision)
+		}
+	}
+}
+
+func TestElaTransaction_CreateEmptyRawTransactionAndHash(t *testing.T) {
+	vins := []elastosTransaction.Vin{
+		{TxID: "4ec5a500314d66507a9b2fa358d15cf7d01c89eca11aeb50ef01de8ac64e1d3a", Vout: 1, Address: "ESUQkMEsfUdbmrounnCrNdVHLXrvSzvy7A"},
+		{TxID: "db7a07895b31bef6e55c0e4aa1a88688b5ce8642f1d9fd56be868961dcbf5c15", Vout: 0, Address: "EQZFJqni8nGrbU4gkmP4V9Qmi1BHbnWuEe"},
+	}
+	vouts := []elastosTransaction.Vout{
+		{AssetID: elastosTransaction.AssetID_ELA, Amount: 100000000, Address: "EK89RfdqPUr82EUHQy5KNVH3LSmNsQLPau"},
+		{AssetID: elastosTransaction.AssetID_ELA, Amount: 2345, Address: "ESUQkMEsfUdbmrounnCrNdVHLXrvSzvy7A"},
+	}
+
+	expected, expectedHashes, err := elastosTransaction.CreateEmptyRawTransactionAndHash(vins, vouts)
+	if err != nil {
+		t.Fatalf("elastosTransaction.CreateEmptyRawTransactionAndHash failed unexpected error: %v", err)
+	}
+
+	inputs := make([]*txInput, 0)
+	for _, in := range vins {
+		inputs = append(inputs, &txInput{TxID: in.TxID, Vout: in.Vout, Sequence: 0xFFFFFFFF, Address: in.Address})
+	}
+	outputs := make([]*txOutput, 0)
+	for _, out := range vouts {
+		outputs = append(outputs, &txOutput{AssetID: out.AssetID, Amount: out.Amount, Address: out.Address})
+	}
+
+	tx, err := newTransferTransaction(inputs, outputs)
+	if err != nil {
+		t.Fatalf("newTransferTransaction failed unexpected error: %v", err)
+	}
+	emptyTrans, hashes, err := tx.CreateEmptyRawTransactionAndHash()
+	if err != nil {
+		t.Fatalf("CreateEmptyRawTransactionAndHash failed unexpected error: %v", err)
+	}
+
+	if emptyTrans != expected {
+		t.Errorf("emptyTrans = %s, expected = %s", emptyTrans, expected)
+	}
+	if len(hashes) != len(expectedHashes) || hashes[0] != expectedHashes[0] || hashes[1] != expectedHashes[1] {
+		t.Errorf("hashes = %v, expected = %v", hashes, expectedHashes)
+	}
+}
+
+func TestTransactionDecoder_MultiSigTransaction(t *testing.T) {
+
+	walletA := newTestWalletDAI(t, "walletA", 0x01)
+	walletB := newTestWalletDAI(t, "walletB", 0x02)
+	walletC := newTestWalletDAI(t, "walletC", 0x03)
+
+	keyA := walletA.newAccount(t, 1).PublicKey
+	keyB := walletB.newAccount(t, 1).PublicKey
+	keyC := walletC.newAccount(t, 1).PublicKey
+
+	//每个拥有者在自己的钱包创建2-of-3的多重签名账户
+	accountA := walletA.newAccount(t, 2, keyB, keyC)
+	accountB := walletB.newAccount(t, 2, keyA, keyC)
+	addrA := walletA.newAddress(t, accountA)
+	addrB := walletB.newAddress(t, accountB)
+	if addrA.Address != addrB.Address || !strings.HasPrefix(addrA.Address, "8") {
+		t.Fatalf("multisig address: %s, %s is not match", addrA.Address, addrB.Address)
+	}
+
+	utxos := []*Unspent{
+		{TxID: "4ec5a500314d66507a9b2fa358d15cf7d01c89eca11aeb50ef01de8ac64e1d3a", Vout: 1, Address: addrA.Address, Amount: "1.5", Spendable: true},
+		{TxID: "db7a07895b31bef6e55c0e4aa1a88688b5ce8642f1d9fd56be868961dcbf5c15", Vout: 0, Address: addrA.Address, Amount: "0.5", Spendable: true},
+	}
+	to := map[string]decimal.Decimal{
+		"EK89RfdqPUr82EUHQy5KNVH3LSmNsQLPau": decimal.RequireFromString("1"),
+		addrA.Address:                        decimal.RequireFromString("0.9999"),
+	}
+
+	rawTx := &openwallet.RawTransaction{
+		Coin:    openwallet.Coin{Symbol: Symbol},
+		Account: accountA,
+		Fees:    "0.0001",
+	}
+
+	decoder := tw.TxDecoder.(*TransactionDecoder)
+	err := decoder.createELARawTransaction(walletA, rawTx, utxos, to)
+	if err != nil {
+		t.Fatalf("createELARawTransaction failed unexpected error: %v", err)
+	}
+
+	if len(rawTx.Signatures) != 3 || rawTx.Required != 2 {
+		t.Fatalf("signatures owners = %d, required = %d", len(rawTx.Signatures), rawTx.Required)
+	}
+	emptyTrans := rawTx.RawHex
+
+	//第一轮：拥有者A签名，签名不足
+	if err = decoder.SignRawTransaction(walletA, rawTx); err != nil {
+		t.Fatalf("walletA SignRawTransaction failed unexpected error: %v", err)
+	}
+	if err = decoder.VerifyRawTransaction(walletA, rawTx); err != nil {
+		t.Fatalf("VerifyRawTransaction failed unexpected error: %v", err)
+	}
+	if rawTx.IsCompleted || rawTx.RawHex != emptyTrans {
+		t.Fatalf("transaction should not be completed with one signature")
+	}
+
+	//第二轮：拥有者B签名，达到必要签名数
+	rawTx.Account = accountB
+	if err = decoder.SignRawTransaction(walletB, rawTx); err != nil {
+		t.Fatalf("walletB SignRawTransaction failed unexpected error: %v", err)
+	}
+	if err = decoder.VerifyRawTransaction(walletB, rawTx); err != nil {
+		t.Fatalf("VerifyRawTransaction failed unexpected error: %v", err)
+	}
+	if !rawTx.IsCompleted {
+		t.Fatalf("transaction should be completed with two signatures")
+	}
+
+	//1个解锁脚本：2个签名参数 + 2-of-3赎回脚本
+	program := strings.TrimPrefix(rawTx.RawHex, emptyTrans)
+	if len(program) != 2*(1+1+2*SignatureScriptLength+1+(3+3*34)) {
+		t.Errorf("program = %s length is invalid", program)
+	}
+
+	//不持有任何拥有者账户的钱包，无法签名
+	if err = decoder.SignRawTransaction(newTestWalletDAI(t, "walletD", 0x04), rawTx); err == nil {
+		t.Errorf("wallet without owner account should not sign")
+	}
+}
+
+func TestTransactionDecoder_CheckReceiverAddress(t *testing.T) {
+
+	wallet := newTestWalletDAI(t, "walletA", 0x01)
+	account := wallet.newAccount(t, 1)
+	wallet.newAddress(t, account)
+
+	decoder := NewTransactionDecoder(tw)
+
+	tests := []struct {
+		address string
+		valid   bool
+	}{
+		{"ESUQkMEsfUdbmrounnCrNdVHLXrvSzvy7A", true},
+		{"8P4qN1dTdm3Eq1tzSpqsVhzTmkSbiWiwrd", true},
+		{"XLfk6ukyV46Q84fYpQCEjtvKmigYP2pLfx", false},
+		{"DdoCn8eJF7hr8zXjjwYDQNwi5XM368iYQp", false},
+		{"ic8dfx73N74w2CZyW9XAKQYMPqtxDXVTag", false},
+		{"ESUQkMEsfUdbmrounnCrNdVHLXrvSzvy7B", false},
+	}
+
+	for _, test := range tests {
+		owErr := decoder.checkReceiverAddress(test.address)
+		if test.valid {
+			if owErr != nil {
+				t.Errorf("checkReceiverAddress address: %s failed unexpected error: %v", test.address, owErr)
+			}
+			continue
+		}
+		if owErr == nil {
+			t.Errorf("checkReceiverAddress address: %s should be failed", test.address)
+			continue
+		}
+		if owErr.Code() != openwallet.ErrAdressDecodeFailed {
+			t.Errorf("checkReceiverAddress address: %s error code = %d, expected = %d", test.address, owErr.Code(), openwallet.ErrAdressDecodeFailed)
+		}
+
+		//创建交易单时，在查询节点之前拒绝
+		rawTx := &openwallet.RawTransaction{
+			Account: account,
+			To:      map[string]string{test.address: "1"},
+		}
+		err := decoder.CreateRawTransaction(wallet, rawTx)
+		if owErr := openwallet.ConvertError(err); owErr == nil || owErr.Code() != openwallet.ErrAdressDecodeFailed {
+			t.Errorf("CreateRawTransaction address: %s error = %v, expected code = %d", test.address, err, openwallet.ErrAdressDecodeFailed)
+		}
+	}
+}
+
+func TestTransactionDecoder_CreateRawTransactionSequence(t *testing.T) {
+
+	wallet := newTestWalletDAI(t, "walletA", 0x01)
+	account := wallet.newAccount(t, 1)
+	addr := wallet.newAddress(t, account)
+
+	//7个0.1的utxo
+	utxos := make([]map[string]interface{}, 0)
+	for i := 0; i < 7; i++ {
+		utxos = append(utxos, map[string]interface{}{
+			"assetid":       elastosTransaction.AssetID_ELA,
+			"txid":          fmt.Sprintf("%064x", i+1),
+			"vout":          0,
+			"address":       addr.Address,
+			"amount":        "0.1",
+			"confirmations": 10,
+		})
+	}
+	node := newTestNode(t, map[string]testNodeHandler{
+		"listunspent": func(params gjson.Result) (interface{}, error) {
+			return utxos, nil
+		},
+	})
+	defer node.Close()
+
+	wm := newTestWalletManager(t, node.URL)
+	wm.Config.MaxTxInputs = 3
+	wm.Config.UseFixedFee = true
+	wm.Config.FixedFee = "0.0001"
+	decoder := NewTransactionDecoder(wm)
+
+	newRawTx := func() *openwallet.RawTransaction {
+		return &openwallet.RawTransaction{
+			Account: account,
+			FeeRate: "0.0001",
+			To:      map[string]string{"EK89RfdqPUr82EUHQy5KNVH3LSmNsQLPau": "0.5"},
+		}
+	}
+
+	//超过输入限制，普通创建失败
+	err := decoder.CreateRawTransaction(wallet, newRawTx())
+	if owErr := openwallet.ConvertError(err); owErr == nil || owErr.Code() != openwallet.ErrCreateRawTransactionFailed {
+		t.Fatalf("CreateRawTransaction error = %v, expected code = %d", err, openwallet.ErrCreateRawTransactionFailed)
+	}
+
+	rawTx := newRawTx()
+	rawTxs, err := decoder.CreateRawTransactionSequence(wallet, rawTx)
+	if err != nil {
+		t.Fatalf("CreateRawTransactionSequence failed unexpected error: %v", err)
+	}
+	if len(rawTxs) < 2 || rawTxs[len(rawTxs)-1] != rawTx {
+		t.Fatalf("CreateRawTransactionSequence returns %d transactions, the last one should be payment", len(rawTxs))
+	}
+
+	txids := make(map[string]bool)
+	for i, tx := range rawTxs {
+		txBytes, _ := hex.DecodeString(tx.RawHex)
+		inputs := int(txBytes[3])
+		if inputs > wm.Config.MaxTxInputs {
+			t.Errorf("transaction %d inputs: %d is over max: %d", i, inputs, wm.Config.MaxTxInputs)
+		}
+
+		isConsolidation := tx.GetExtParam().Get("consolidation").Bool()
+		if isConsolidation != (i < len(rawTxs)-1) {
+			t.Errorf("transaction %d consolidation flag = %v", i, isConsolidation)
+		}
+
+		//后续交易引用的归集交易输出，必须是前面交易的txid
+		for j := 0; j < inputs; j++ {
+			in := txBytes[4+j*38 : 4+j*38+38]
+			txid, _ := reverseHexToBytes(hex.EncodeToString(in[:32]))
+			id := hex.EncodeToString(txid)
+			if strings.HasPrefix(id, "000000") {
+				continue
+			}
+			if !txids[id] {
+				t.Errorf("transaction %d input: %s is not created in sequence", i, id)
+			}
+		}
+
+		txid, err := unsignedTransactionID(tx.RawHex)
+		if err != nil {
+			t.Fatalf("unsignedTransactionID failed unexpected error: %v", err)
+		}
+		txids[txid] = true
+
+		if len(tx.Signatures[account.AccountID]) == 0 {
+			t.Errorf("transaction %d has not signatures", i)
+		}
+		t.Logf("transaction %d: fees: %s, to: %v", i, tx.Fees, tx.To)
+	}
+}
+
+func TestTransactionDecoder_ConsolidationFees(t *testing.T) {
+
+	feeRate := decimal.RequireFromString("0.01")
+
+	wallet := newTestWalletDAI(t, "walletA", 0x01)
+	account := wallet.newAccount(t, 1)
+	addr := wallet.newAddress(t, account)
+
+	wm, node := newTestUnspentNode(t, []string{addr.Address}, "0.1", "0.1", "0.1", "0.1", "0.1", "0.1", "0.1")
+	defer node.Close()
+	wm.Config.MaxTxInputs = 3
+	decoder := NewTransactionDecoder(wm)
+
+	//所有选币策略在输入限制内都选不到足够的utxo，都要先归集
+	for _, name := range []string{CoinSelectionSmallestFirst, CoinSelectionBranchAndBound, CoinSelectionRandomImprove} {
+		rawTx := &openwallet.RawTransaction{
+			Account: account,
+			FeeRate: feeRate.String(),
+			To:      map[string]string{"EK89RfdqPUr82EUHQy5KNVH3LSmNsQLPau": "0.5"},
+		}
+		rawTx.SetExtParam("coinSelection", name)
+		rawTxs, err := decoder.CreateRawTransactionSequence(wallet, rawTx)
+		if err != nil {
+			t.Fatalf("%s CreateRawTransactionSequence failed unexpected error: %v", name, err)
+		}
+		if len(rawTxs) < 2 {
+			t.Errorf("%s CreateRawTransactionSequence returns %d transactions, expected consolidation", name, len(rawTxs))
+		}
+
+		//每笔交易单的输入都被锁定，包括引用归集交易输出的输入
+		inputs := 0
+		for _, tx := range rawTxs {
+			txBytes, _ := hex.DecodeString(tx.RawHex)
+			inputs += int(txBytes[3])
+		}
+		if locks, _ := wm.GetUnspentLocks(); len(locks) != inputs {
+			t.Errorf("%s locked utxo = %d, expected = %d", name, len(locks), inputs)
+		}
+
+		for i, tx := range rawTxs {
+			txBytes, _ := hex.DecodeString(tx.RawHex)
+			required := wm.CalculateFee(signedTransactionSize(tx.RawHex, 1, account), feeRate)
+			fees := decimal.RequireFromString(tx.Fees)
+			if fees.LessThan(required) {
+				t.Errorf("%s transaction %d fees: %s is less than required: %s, inputs: %d", name, i, tx.Fees, required.String(), txBytes[3])
+			}
+			if i < len(rawTxs)-1 && tx.Required != account.Required {
+				t.Errorf("%s transaction %d required = %d, expected = %d", name, i, tx.Required, account.Required)
+			}
+		}
+
+		//解除最后一笔交易单的锁定，同时解除归集交易的锁定
+		if err := decoder.UnlockRawTransaction(rawTxs[len(rawTxs)-1]); err != nil {
+			t.Fatalf("UnlockRawTransaction failed unexpected error: %v", err)
+		}
+		if locks, _ := wm.GetUnspentLocks(); len(locks) != 0 {
+			t.Errorf("%s locked utxo = %d, expected = 0 after unlock the sequence", name, len(locks))
+		}
+	}
+
+	//余额不足时不归集
+	rawTx := &openwallet.RawTransaction{
+		Account: account,
+		FeeRate: feeRate.String(),
+		To:      map[string]string{"EK89RfdqPUr82EUHQy5KNVH3LSmNsQLPau": "0.7"},
+	}
+	if _, err := decoder.CreateRawTransactionSequence(wallet, rawTx); err == nil {
+		t.Errorf("CreateRawTransactionSequence with insufficient balance should be failed")
+	}
+}
+
+func TestTransactionDecoder_SummaryFees(t *testing.T) {
+
+	feeRate := decimal.RequireFromString("0.01")
+	summaryAddress := "EK89RfdqPUr82EUHQy5KNVH3LSmNsQLPau"
+
+	wallet := newTestWalletDAI(t, "walletA", 0x01)
+	account := wallet.newAccount(t, 1)
+	addr := wallet.newAddress(t, account)
+
+	wm, node := newTestUnspentNode(t, []string{addr.Address}, "0.3", "0.3", "0.3", "0.3")
+	defer node.Close()
+	decoder := NewTransactionDecoder(wm)
+
+	rawTxs, err := decoder.CreateSummaryRawTransactionWithError(wallet, &openwallet.SummaryRawTransaction{
+		Account:         account,
+		FeeRate:         feeRate.String(),
+		SummaryAddress:  summaryAddress,
+		MinTransfer:     "0.5",
+		RetainedBalance: "0.1",
+		AddressLimit:    10,
+	})
+	if err != nil {
+		t.Fatalf("CreateSummaryRawTransactionWithError failed unexpected error: %v", err)
+	}
+	if len(rawTxs) != 1 || rawTxs[0].Error != nil {
+		t.Fatalf("CreateSummaryRawTransactionWithError returns: %v", rawTxs)
+	}
+
+	rawTx := rawTxs[0].RawTx
+	fees := decimal.RequireFromString(rawTx.Fees)
+	required := wm.CalculateFee(signedTransactionSize(rawTx.RawHex, 1, account), feeRate)
+	if fees.LessThan(required) {
+		t.Errorf("summary fees: %s is less than required: %s", rawTx.Fees, required.String())
+	}
+	if expected := decimal.RequireFromString("1.1").Sub(fees).StringFixed(Decimals); rawTx.To[summaryAddress] != expected {
+		t.Errorf("summary amount = %s, expected = %s", rawTx.To[summaryAddress], expected)
+	}
+	if rawTx.To[addr.Address] != "0.10000000" {
+		t.Errorf("retained balance = %s, expected = 0.10000000", rawTx.To[addr.Address])
+	}
+}
+
+func TestTransactionDecoder_SummaryLockedUnspents(t *testing.T) {
+
+	summaryAddress := "EK89RfdqPUr82EUHQy5KNVH3LSmNsQLPau"
+
+	wallet := newTestWalletDAI(t, "walletA", 0x01)
+	account := wallet.newAccount(t, 1)
+	second, err := wallet.deriveAddress(account, false, 1)
+	if err != nil {
+		t.Fatalf("deriveAddress failed unexpected error: %v", err)
+	}
+	addrs := []*openwallet.Address{wallet.newAddress(t, account), second}
+
+	wm, node := newTestUnspentNode(t, []string{addrs[0].Address, addrs[1].Address}, "0.3", "0.3", "0.3", "0.3")
+	defer node.Close()
+	decoder := NewTransactionDecoder(wm)
+
+	summary := func() []*openwallet.RawTransactionWithError {
+		rawTxs, err := decoder.CreateSummaryRawTransactionWithError(wallet, &openwallet.SummaryRawTransaction{
+			Account:         account,
+			FeeRate:         "0.0001",
+			SummaryAddress:  summaryAddress,
+			MinTransfer:     "0.5",
+			RetainedBalance: "0.1",
+			AddressLimit:    10,
+		})
+		if err != nil {
+			t.Fatalf("CreateSummaryRawTransactionWithError failed unexpected error: %v", err)
+		}
+		return rawTxs
+	}
+
+	//第二个地址的utxo已被其他交易单锁定，余额仍达到最低转账，但不汇总也不输出保留余额
+	locked, _ := wm.ListUnspent(0, addrs[1].Address)
+	if err := wm.LockUnspents("pending", locked); err != nil {
+		t.Fatalf("LockUnspents failed unexpected error: %v", err)
+	}
+	rawTxs := summary()
+	if len(rawTxs) != 1 || rawTxs[0].Error != nil {
+		t.Fatalf("CreateSummaryRawTransactionWithError returns: %v", rawTxs)
+	}
+	rawTx := rawTxs[0].RawTx
+	if txBytes, _ := hex.DecodeString(rawTx.RawHex); txBytes[3] != 4 {
+		t.Errorf("summary inputs = %d, expected = 4", txBytes[3])
+	}
+	if _, ok := rawTx.To[addrs[1].Address]; ok || len(rawTx.To) != 2 {
+		t.Errorf("summary outputs = %v, expected no retained balance of locked address", rawTx.To)
+	}
+
+	//所有utxo都已锁定时不创建交易单
+	if err := decoder.UnlockRawTransaction(rawTx); err != nil {
+		t.Fatalf("UnlockRawTransaction failed unexpected error: %v", err)
+	}
+	locked, _ = wm.ListUnspent(0, addrs[0].Address)
+	if err := wm.LockUnspents("pending", locked); err != nil {
+		t.Fatalf("LockUnspents failed unexpected error: %v", err)
+	}
+	if rawTxs := summary(); len(rawTxs) != 0 {
+		t.Errorf("CreateSummaryRawTransactionWithError returns: %v, expected no transaction", rawTxs)
+	}
+}
+
+func TestTransactionDecoder_ChangeAddress(t *testing.T) {
+
+	wallet := newTestWalletDAI(t, "walletA", 0x01)
+	account := wallet.newAccount(t, 1)
+	addr := wallet.newAddress(t, account)
+
+	node := newTestNode(t, map[string]testNodeHandler{
+		"listunspent": func(params gjson.Result) (interface{}, error) {
+			return []map[string]interface{}{{
+				"assetid":       elastosTransaction.AssetID_ELA,
+				"txid":          fmt.Sprintf("%064x", 1),
+				"vout":          0,
+				"address":       addr.Address,
+				"amount":        "1",
+				"confirmations": 10,
+			}}, nil
+		},
+	})
+	defer node.Close()
+
+	wm := newTestWalletManager(t, node.URL)
+	decoder := NewTransactionDecoder(wm)
+
+	createChange := func(wrapper openwallet.WalletDAI, policy string, change *openwallet.Address) (*openwallet.Address, error) {
+		rawTx := &openwallet.RawTransaction{
+			Account: account,
+			FeeRate: "0.0001",
+			To:      map[string]string{"EK89RfdqPUr82EUHQy5KNVH3LSmNsQLPau": "0.5"},
+			Change:  change,
+		}
+		if len(policy) > 0 {
+			rawTx.SetExtParam("changePolicy", policy)
+		}
+		if err := decoder.CreateRawTransaction(wrapper, rawTx); err != nil {
+			return nil, err
+		}
+		//放弃交易单，解除utxo锁定
+		if err := decoder.UnlockRawTransaction(rawTx); err != nil {
+			t.Fatalf("UnlockRawTransaction failed unexpected error: %v", err)
+		}
+		//找零输出必须是返回的找零地址
+		found := false
+		for _, to := range rawTx.TxTo {
+			if strings.HasPrefix(to, rawTx.Change.Address+":") {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("change address: %s is not in outputs: %v", rawTx.Change.Address, rawTx.TxTo)
+		}
+		return rawTx.Change, nil
+	}
+
+	//默认找零到输入地址
+	change, err := createChange(wallet, "", nil)
+	if err != nil || change.Address != addr.Address {
+		t.Errorf("input policy change = %v, error = %v", change, err)
+	}
+
+	//固定的找零地址只创建一次
+	dedicated, err := createChange(wallet, ChangePolicyDedicated, nil)
+	if err != nil || !dedicated.IsChange || dedicated.Address == addr.Address {
+		t.Fatalf("dedicated policy change = %v, error = %v", dedicated, err)
+	}
+	change, err = createChange(wallet, ChangePolicyDedicated, nil)
+	if err != nil || change.Address != dedicated.Address {
+		t.Errorf("dedicated policy change = %v, expected = %s, error = %v", change, dedicated.Address, err)
+	}
+
+	//每次创建新的找零地址
+	fresh, err := createChange(wallet, ChangePolicyFresh, nil)
+	if err != nil || !fresh.IsChange || fresh.Address == dedicated.Address {
+		t.Errorf("fresh policy change = %v, error = %v", fresh, err)
+	}
+
+	//指定找零地址
+	explicit := &openwallet.Address{Address: "EQZFJqni8nGrbU4gkmP4V9Qmi1BHbnWuEe"}
+	change, err = createChange(wallet, ChangePolicyFresh, explicit)
+	if err != nil || change.Address != explicit.Address {
+		t.Errorf("explicit change = %v, error = %v", change, err)
+	}
+
+	//无效的指定找零地址
+	if _, err = createChange(wallet, "", &openwallet.Address{Address: "XLfk6ukyV46Q84fYpQCEjtvKmigYP2pLfx"}); err == nil {
+		t.Errorf("invalid explicit change address should be failed")
+	}
+
+	//不支持的策略
+	if _, err = createChange(wallet, "unknown", nil); err == nil {
+		t.Errorf("unknown change policy should be failed")
+	}
+
+	//WalletDAI不能创建地址
+	readonly := struct{ openwallet.WalletDAI }{wallet}
+	if _, err = createChange(readonly, ChangePolicyFresh, nil); err == nil {
+		t.Errorf("fresh policy without address creator should be failed")
+	}
+
+	//选币失败或没有找零时不创建找零地址
+	countChanges := func() int {
+		changes, _ := wallet.GetAddressList(0, -1, "AccountID", account.AccountID, "IsChange", true)
+		return len(changes)
+	}
+	wm.Config.UseFixedFee = true
+	wm.Config.FixedFee = "0.001"
+	before := countChanges()
+	for amount, success := range map[string]bool{"2": false, "0.999": true} {
+		rawTx := &openwallet.RawTransaction{
+			Account: account,
+			FeeRate: "0.0001",
+			To:      map[string]string{"EK89RfdqPUr82EUHQy5KNVH3LSmNsQLPau": amount},
+		}
+		rawTx.SetExtParam("changePolicy", ChangePolicyFresh)
+		err := decoder.CreateRawTransaction(wallet, rawTx)
+		if (err == nil) != success {
+			t.Errorf("amount: %s CreateRawTransaction error = %v, expected success: %v", amount, err, success)
+		}
+		if err == nil {
+			if len(rawTx.TxTo) != 1 || rawTx.Change != nil {
+				t.Errorf("amount: %s outputs: %v, change: %v, expected no change", amount, rawTx.TxTo, rawTx.Change)
+			}
+			if err := decoder.UnlockRawTransaction(rawTx); err != nil {
+				t.Fatalf("UnlockRawTransaction failed unexpected error: %v", err)
+			}
+		}
+		if after := countChanges(); after != before {
+			t.Errorf("amount: %s created change addresses: %d, expected none", amount, after-before)
+		}
+	}
+	wm.Config.UseFixedFee = false
+
+	//单地址选币时找零必须回到输入地址，忽略找零策略及指定的找零地址
+	for _, explicit := range []*openwallet.Address{nil, {Address: "EQZFJqni8nGrbU4gkmP4V9Qmi1BHbnWuEe"}} {
+		rawTx := &openwallet.RawTransaction{
+			Account: account,
+			FeeRate: "0.0001",
+			To:      map[string]string{"EK89RfdqPUr82EUHQy5KNVH3LSmNsQLPau": "0.5"},
+			Change:  explicit,
+		}
+		rawTx.SetExtParam("coinSelection", CoinSelectionSingleAddress)
+		rawTx.SetExtParam("changePolicy", ChangePolicyFresh)
+		if err := decoder.CreateRawTransaction(wallet, rawTx); err != nil {
+			t.Fatalf("singleAddress CreateRawTransaction failed unexpected error: %v", err)
+		}
+		if err := decoder.UnlockRawTransaction(rawTx); err != nil {
+			t.Fatalf("UnlockRawTransaction failed unexpected error: %v", err)
+		}
+		if rawTx.Change == nil || rawTx.Change.Address != addr.Address {
+			t.Errorf("singleAddress change = %v, expected = %s", rawTx.Change, addr.Address)
+		}
+	}
+}
+
+//newTestUnspentNode 模拟只提供listunspent的节点，每个地址的utxo金额为amounts，只返回查询地址的utxo
+func newTestUnspentNode(t *testing.T, addresses []string, amounts ...string) (*WalletManager, *httptest.Server) {
+	utxos := make([]map[string]interface{}, 0)
+	for _, address := range addresses {
+		for _, amount := range amounts {
+			utxos = append(utxos, map[string]interface{}{
+				"assetid":       elastosTransaction.AssetID_ELA,
+				"txid":          fmt.Sprintf("%064x", len(utxos)+1),
+				"vout":          0,
+				"address":       address,
+				"amount":        amount,
+				"confirmations": 10,
+			})
+		}
+	}
+	node := newTestNode(t, map[string]testNodeHandler{
+		"listunspent": func(params gjson.Result) (interface{}, error) {
+			result := make([]map[string]interface{}, 0)
+			for _, u := range utxos {
+				for _, address := range params.Get("0").Array() {
+					if u["address"] == address.String() {
+						result = append(result, u)
+						break
+					}
+				}
+			}
+			return result, nil
+		},
+	})
+	return newTestWalletManager(t, node.URL), node
+}
+
+func TestProgramSize(t *testing.T) {
+	//标准地址：0x40 + 签名，0x21 + 公钥 + CHECKSIG
+	if size := programSize(1, 1); size != 1+65+1+35 {
+		t.Errorf("standard program size = %d", size)
+	}
+	//2-of-3：2个签名，OP_2 + 3个公钥 + OP_3 + CHECKMULTISIG
+	if size := programSize(2, 3); size != 1+130+1+105 {
+		t.Errorf("multisig program size = %d", size)
+	}
+}
+
+func TestTransactionDecoder_FeesFromTransactionSize(t *testing.T) {
+
+	feeRate := decimal.RequireFromString("0.01")
+
+	//标准地址：2个输入地址，每个地址2个utxo
+	wallet := newTestWalletDAI(t, "walletA", 0x01)
+	account := wallet.newAccount(t, 1)
+	addr0 := wallet.newAddress(t, account)
+	addr1, _ := wallet.deriveAddress(account, false, 1)
+
+	wm, node := newTestUnspentNode(t, []string{addr0.Address, addr1.Address}, "0.3", "0.3")
+	defer node.Close()
+	decoder := NewTransactionDecoder(wm)
+
+	rawTx := &openwallet.RawTransaction{
+		Account: account,
+		FeeRate: feeRate.String(),
+		To:      map[string]string{"EK89RfdqPUr82EUHQy5KNVH3LSmNsQLPau": "1"},
+	}
+	if err := decoder.CreateRawTransaction(wallet, rawTx); err != nil {
+		t.Fatalf("CreateRawTransaction failed unexpected error: %v", err)
+	}
+	if err := decoder.SignRawTransaction(wallet, rawTx); err != nil {
+		t.Fatalf("SignRawTransaction failed unexpected error: %v", err)
+	}
+	if err := decoder.VerifyRawTransaction(wallet, rawTx); err != nil || !rawTx.IsCompleted {
+		t.Fatalf("VerifyRawTransaction failed unexpected error: %v", err)
+	}
+
+	size := int64(len(rawTx.RawHex) / 2)
+	if expected := wm.CalculateFee(size, feeRate).StringFixed(Decimals); rawTx.Fees != expected {
+		t.Errorf("standard fees = %s, expected = %s, size = %d", rawTx.Fees, expected, size)
+	}
+
+	//2-of-3多重签名
+	walletB := newTestWalletDAI(t, "walletB", 0x02)
+	walletC := newTestWalletDAI(t, "walletC", 0x03)
+	keyA := wallet.newAccount(t, 1).PublicKey
+	keyB := walletB.newAccount(t, 1).PublicKey
+	keyC := walletC.newAccount(t, 1).PublicKey
+	accountA := wallet.newAccount(t, 2, keyB, keyC)
+	accountB := walletB.newAccount(t, 2, keyA, keyC)
+	multiSigAddr := wallet.newAddress(t, accountA)
+	walletB.newAddress(t, accountB)
+
+	wm, multiSigNode := newTestUnspentNode(t, []string{multiSigAddr.Address}, "0.3", "0.5", "0.4")
+	defer multiSigNode.Close()
+	decoder = NewTransactionDecoder(wm)
+
+	rawTx = &openwallet.RawTransaction{
+		Account: accountA,
+		FeeRate: feeRate.String(),
+		To:      map[string]string{"EK89RfdqPUr82EUHQy5KNVH3LSmNsQLPau": "1"},
+	}
+	if err := decoder.CreateRawTransaction(wallet, rawTx); err != nil {
+		t.Fatalf("CreateRawTransaction failed unexpected error: %v", err)
+	}
+	if err := decoder.SignRawTransaction(wallet, rawTx); err != nil {
+		t.Fatalf("walletA SignRawTransaction failed unexpected error: %v", err)
+	}
+	rawTx.Account = accountB
+	if err := decoder.SignRawTransaction(walletB, rawTx); err != nil {
+		t.Fatalf("walletB SignRawTransaction failed unexpected error: %v", err)
+	}
+	if err := decoder.VerifyRawTransaction(walletB, rawTx); err != nil || !rawTx.IsCompleted {
+		t.Fatalf("VerifyRawTransaction failed unexpected error: %v", err)
+	}
+
+	size = int64(len(rawTx.RawHex) / 2)
+	if expected := wm.CalculateFee(size, feeRate).StringFixed(Decimals); rawTx.Fees != expected {
+		t.Errorf("multisig fees = %s, expected = %s, size = %d", rawTx.Fees, expected, size)
+	}
+
+	//选币目标按长度增量计算的手续费与序列化估算的手续费相同
+	to := []string{"EK89RfdqPUr82EUHQy5KNVH3LSmNsQLPau"}
+	for _, acc := range []*openwallet.AssetsAccount{account, accountA} {
+		unspents := append(testUnspents(addr0.Address, "0.1", "0.2"), testUnspents(addr1.Address, "0.3")...)
+		target, err := decoder.selectionTarget(acc, unspents[2:], decimal.Zero, to, feeRate, decimal.Zero)
+		if err != nil {
+			t.Fatalf("selectionTarget failed unexpected error: %v", err)
+		}
+		for n := 1; n <= 2; n++ {
+			for _, hasChange := range []bool{false, true} {
+				used := append(append([]*Unspent{}, unspents[:n]...), unspents[2:]...)
+				expected, _ := decoder.estimateTxFees(acc, used, to, hasChange, feeRate)
+				if fees := target.Fees(unspents[:n], hasChange); !fees.Equal(expected) {
+					t.Errorf("target fees of %d inputs, change: %v = %s, expected = %s", n+1, hasChange, fees.String(), expected.String())
+				}
+			}
+		}
+	}
+}
+
+func TestTransactionDecoder_SendMax(t *testing.T) {
+
+	feeRate := decimal.RequireFromString("0.01")
+	receiver := "EK89RfdqPUr82EUHQy5KNVH3LSmNsQLPau"
+
+	wallet := newTestWalletDAI(t, "walletA", 0x01)
+	account := wallet.newAccount(t, 1)
+	addr0 := wallet.newAddress(t, account)
+	addr1, _ := wallet.deriveAddress(account, false, 1)
+
+	wm, node := newTestUnspentNode(t, []string{addr0.Address, addr1.Address}, "0.3", "0.2")
+	defer node.Close()
+	decoder := NewTransactionDecoder(wm)
+
+	//接收金额为max，使用全部utxo，手续费从接收金额中扣除
+	rawTx := &openwallet.RawTransaction{
+		Account: account,
+		FeeRate: feeRate.String(),
+		To:      map[string]string{receiver: SendMaxAmount},
+	}
+	if err := decoder.CreateRawTransaction(wallet, rawTx); err != nil {
+		t.Fatalf("CreateRawTransaction failed unexpected error: %v", err)
+	}
+	if err := decoder.SignRawTransaction(wallet, rawTx); err != nil {
+		t.Fatalf("SignRawTransaction failed unexpected error: %v", err)
+	}
+	if err := decoder.VerifyRawTransaction(wallet, rawTx); err != nil || !rawTx.IsCompleted {
+		t.Fatalf("VerifyRawTransaction failed unexpected error: %v", err)
+	}
+
+	size := int64(len(rawTx.RawHex) / 2)
+	if expected := wm.CalculateFee(size, feeRate).StringFixed(Decimals); rawTx.Fees != expected {
+		t.Errorf("send max fees = %s, expected = %s, size = %d", rawTx.Fees, expected, size)
+	}
+	amount := decimal.RequireFromString(rawTx.To[receiver])
+	if total := amount.Add(decimal.RequireFromString(rawTx.Fees)); !total.Equal(decimal.RequireFromString("1")) {
+		t.Errorf("send max amount = %s, fees = %s, total = %s, expected = 1", amount, rawTx.Fees, total)
+	}
+	if len(rawTx.TxTo) != 1 || len(rawTx.TxFrom) != 4 {
+		t.Errorf("send max tx from = %v, to = %v, expected 4 inputs and 1 output", rawTx.TxFrom, rawTx.TxTo)
+	}
+	if err := decoder.UnlockRawTransaction(rawTx); err != nil {
+		t.Fatalf("UnlockRawTransaction failed unexpected error: %v", err)
+	}
+
+	//ExtParam指定sendMax，超过输入限制时只使用金额最大的utxo
+	wm.Config.MaxTxInputs = 3
+	rawTx = &openwallet.RawTransaction{
+		Account: account,
+		FeeRate: feeRate.String(),
+		To:      map[string]string{receiver: "0"},
+	}
+	rawTx.SetExtParam("sendMax", true)
+	if err := decoder.CreateRawTransaction(wallet, rawTx); err != nil {
+		t.Fatalf("CreateRawTransaction failed unexpected error: %v", err)
+	}
+	amount = decimal.RequireFromString(rawTx.To[receiver])
+	if total := amount.Add(decimal.RequireFromString(rawTx.Fees)); !total.Equal(decimal.RequireFromString("0.8")) {
+		t.Errorf("send max amount = %s, fees = %s, total = %s, expected = 0.8", amount, rawTx.Fees, total)
+	}
+	if len(rawTx.TxFrom) != 3 {
+		t.Errorf("send max tx from = %v, expected 3 inputs", rawTx.TxFrom)
+	}
+	if err := decoder.UnlockRawTransaction(rawTx); err != nil {
+		t.Fatalf("UnlockRawTransaction failed unexpected error: %v", err)
+	}
+
+	invalid := []*openwallet.RawTransaction{
+		//多个接收地址
+		{Account: account, FeeRate: feeRate.String(), To: map[string]string{receiver: SendMaxAmount, addr0.Address: "0.1"}},
+		//余额不足以支付手续费
+		{Account: account, FeeRate: "10000", To: map[string]string{receiver: SendMaxAmount}},
+	}
+	for _, rawTx := range invalid {
+		if err := decoder.CreateRawTransaction(wallet, rawTx); err == nil {
+			t.Errorf("CreateRawTransaction to: %v fee rate: %s should be failed", rawTx.To, rawTx.FeeRate)
+		} else {
+			t.Logf("CreateRawTransaction error: %v", err)
+		}
+	}
+}
+
+func TestTransactionDecoder_TokenTransfer(t *testing.T) {
+
+	assetID := "8f1a5b9c3d2e4f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8"
+	receiver := "EK89RfdqPUr82EUHQy5KNVH3LSmNsQLPau"
+
+	wallet := newTestWalletDAI(t, "walletA", 0x01)
+	account := wallet.newAccount(t, 1)
+	addr := wallet.newAddress(t, account)
+
+	utxos := []map[string]interface{}{
+		{"assetid": assetID, "txid": fmt.Sprintf("%064x", 1), "vout": 0, "address": addr.Address, "amount": "30", "confirmations": 10},
+		{"assetid": assetID, "txid": fmt.Sprintf("%064x", 2), "vout": 0, "address": addr.Address, "amount": "50", "confirmations": 10},
+		{"assetid": elastosTransaction.AssetID_ELA, "txid": fmt.Sprintf("%064x", 3), "vout": 0, "address": addr.Address, "amount": "0.5", "confirmations": 10},
+	}
+	node := newTestNode(t, map[string]testNodeHandler{
+		"listunspent": func(params gjson.Result) (interface{}, error) {
+			return utxos, nil
+		},
+	})
+	defer node.Close()
+
+	wm := newTestWalletManager(t, node.URL)
+	decoder := NewTransactionDecoder(wm)
+
+	//按资产查询未花及余额
+	tokenUTXO, err := wm.ListAssetUnspent(assetID, 0, addr.Address)
+	if err != nil || len(tokenUTXO) != 2 {
+		t.Fatalf("ListAssetUnspent = %d, err = %v, expected 2 token utxo", len(tokenUTXO), err)
+	}
+	elaUTXO, err := wm.ListUnspent(0, addr.Address)
+	if err != nil || len(elaUTXO) != 1 {
+		t.Fatalf("ListUnspent = %d, err = %v, expected 1 ELA utxo", len(elaUTXO), err)
+	}
+	balances, err := wm.getAssetBalanceCalUnspent(assetID, addr.Address)
+	if err != nil || len(balances) != 1 || balances[0].Balance != "80" {
+		t.Fatalf("getAssetBalanceCalUnspent = %+v, err = %v, expected 80", balances, err)
+	}
+
+	coin := openwallet.Coin{
+		Symbol:     Symbol,
+		IsContract: true,
+		Contract: openwallet.SmartContract{
+			Address:  "0x" + strings.ToUpper(assetID),
+			Token:    "TKN",
+			Decimals: 4,
+		},
+	}
+
+	rawTx := &openwallet.RawTransaction{
+		Coin:    coin,
+		Account: account,
+		FeeRate: "0.0001",
+		To:      map[string]string{receiver: "40.5"},
+	}
+	if err := decoder.CreateRawTransaction(wallet, rawTx); err != nil {
+		t.Fatalf("CreateRawTransaction failed unexpected error: %v", err)
+	}
+	if err := decoder.SignRawTransaction(wallet, rawTx); err != nil {
+		t.Fatalf("SignRawTransaction failed unexpected error: %v", err)
+	}
+	if err := decoder.VerifyRawTransaction(wallet, rawTx); err != nil || !rawTx.IsCompleted {
+		t.Fatalf("VerifyRawTransaction failed unexpected error: %v", err)
+	}
+
+	//代币输出：接收及代币找零，ELA输出：手续费找零
+	reversed, _ := reverseHexToBytes(assetID)
+	if n := strings.Count(rawTx.RawHex, hex.EncodeToString(reversed)); n != 2 {
+		t.Errorf("token outputs = %d, expected = 2", n)
+	}
+	//代币金额按精度4放大，40.5 = 0x062e08
+	if !strings.Contains(rawTx.RawHex, hex.EncodeToString(reversed)+"03062e08") {
+		t.Errorf("token output value of 40.5 is not serialized as sidechain token value")
+	}
+	reversed, _ = reverseHexToBytes(elastosTransaction.AssetID_ELA)
+	if n := strings.Count(rawTx.RawHex, hex.EncodeToString(reversed)); n != 1 {
+		t.Errorf("ELA outputs = %d, expected = 1", n)
+	}
+	if rawTx.TxAmount != "-40.5000" {
+		t.Errorf("token tx amount = %s, expected = -40.5000", rawTx.TxAmount)
+	}
+	if len(rawTx.TxFrom) != 2 || len(rawTx.TxTo) != 2 {
+		t.Errorf("token tx from = %v, to = %v, expected 2 token inputs and 2 token outputs", rawTx.TxFrom, rawTx.TxTo)
+	}
+	if fees := decimal.RequireFromString(rawTx.Fees); !fees.IsPositive() {
+		t.Errorf("token tx fees = %s, expected to be paid by ELA", rawTx.Fees)
+	}
+	if locks, _ := wm.GetUnspentLocks(); len(locks) != 3 {
+		t.Errorf("locked utxo = %d, expected = 3", len(locks))
+	}
+	if err := decoder.UnlockRawTransaction(rawTx); err != nil {
+		t.Fatalf("UnlockRawTransaction failed unexpected error: %v", err)
+	}
+
+	invalid := []struct {
+		name string
+		coin openwallet.Coin
+		to   map[string]string
+		code uint64
+	}{
+		{"precision", coin, map[string]string{receiver: "1.00001"}, openwallet.ErrCreateRawTransactionFailed},
+		{"balance", coin, map[string]string{receiver: "81"}, openwallet.ErrInsufficientTokenBalanceOfAddress},
+		{"send max", coin, map[string]string{receiver: SendMaxAmount}, openwallet.ErrCreateRawTransactionFailed},
+		{"asset id", openwallet.Coin{Symbol: Symbol, IsContract: true, Contract: openwallet.SmartContract{Address: "TKN", Decimals: 4}}, map[string]string{receiver: "1"}, openwallet.ErrCreateRawTransactionFailed},
+	}
+	for _, test := range invalid {
+		rawTx := &openwallet.RawTransaction{Coin: test.coin, Account: account, FeeRate: "0.0001", To: test.to}
+		err := decoder.CreateRawTransaction(wallet, rawTx)
+		if owErr := openwallet.ConvertError(err); owErr == nil || owErr.Code() != test.code {
+			t.Errorf("%s: CreateRawTransaction error = %v, expected code = %d", test.name, err, test.code)
+		}
+	}
+}
+
+func TestTransactionDecoder_CrossChain(t *testing.T) {
+
+	lockAddress := "XVbCTM7vqM1qHKsABSFH4xKN1qbp7ijpWf"
+	sideChainAddress := "0x" + strings.Repeat("ab", 20)
+
+	wallet := newTestWalletDAI(t, "walletA", 0x01)
+	account := wallet.newAccount(t, 1)
+	addr := wallet.newAddress(t, account)
+
+	wm, node := newTestUnspentNode(t, []string{addr.Address}, "1")
+	defer node.Close()
+	wm.Config.SideChainLockAddresses = map[string]string{"ETH": lockAddress}
+	decoder := NewTransactionDecoder(wm)
+
+	rawTx := &openwallet.RawTransaction{
+		Account: account,
+		FeeRate: "0.0001",
+		To:      map[string]string{sideChainAddress: "0.3"},
+	}
+	rawTx.SetExtParam("crossChain", "ETH")
+	if err := decoder.CreateRawTransaction(wallet, rawTx); err != nil {
+		t.Fatalf("CreateRawTransaction failed unexpected error: %v", err)
+	}
+	emptyTrans := rawTx.RawHex
+	if err := decoder.SignRawTransaction(wallet, rawTx); err != nil {
+		t.Fatalf("SignRawTransaction failed unexpected error: %v", err)
+	}
+	if err := decoder.VerifyRawTransaction(wallet, rawTx); err != nil || !rawTx.IsCompleted {
+		t.Fatalf("VerifyRawTransaction failed unexpected error: %v", err)
+	}
+	if fee := rawTx.GetExtParam().Get("crossChainFee").String(); fee != "0.00010000" {
+		t.Errorf("crossChainFee = %s, expected = 0.00010000", fee)
+	}
+
+	//类型及payload：侧链地址，输出序号，到账金额
+	txBytes, _ := hex.DecodeString(emptyTrans)
+	if txBytes[0] != TxTypeTransferCrossChainAsset || txBytes[1] != 0 {
+		t.Fatalf("transaction type = %d, payload version = %d", txBytes[0], txBytes[1])
+	}
+	if txBytes[2] != 1 || int(txBytes[3]) != len(sideChainAddress) || string(txBytes[4:4+len(sideChainAddress)]) != sideChainAddress {
+		t.Fatalf("cross chain payload address is invalid: %x", txBytes[2:4+len(sideChainAddress)])
+	}
+	pos := 4 + len(sideChainAddress)
+	outputIndex := int(txBytes[pos])
+	if amount := binary.LittleEndian.Uint64(txBytes[pos+1 : pos+9]); amount != 30000000 {
+		t.Errorf("cross chain amount = %d, expected = 30000000", amount)
+	}
+	pos += 9
+
+	//属性，输入，输出
+	pos++
+	pos += 1 + int(txBytes[pos])*TxInputSize
+	outputs := int(txBytes[pos])
+	if outputIndex >= outputs {
+		t.Fatalf("cross chain output index: %d is over outputs: %d", outputIndex, outputs)
+	}
+	out := txBytes[pos+1+outputIndex*TxOutputSize : pos+1+(outputIndex+1)*TxOutputSize]
+	lockProgramHash, _ := addressToProgramHash(lockAddress)
+	if !bytes.Equal(out[44:], lockProgramHash) {
+		t.Errorf("cross chain output is not sent to lock address")
+	}
+	//到账金额加上跨链手续费
+	if amount := binary.LittleEndian.Uint64(out[32:40]); amount != 30010000 {
+		t.Errorf("lock address output amount = %d, expected = 30010000", amount)
+	}
+	if err := decoder.UnlockRawTransaction(rawTx); err != nil {
+		t.Fatalf("UnlockRawTransaction failed unexpected error: %v", err)
+	}
+
+	invalid := []struct {
+		name      string
+		sideChain string
+		to        map[string]string
+	}{
+		{"not configured", "ID", map[string]string{sideChainAddress: "0.1"}},
+		{"side chain address", "ETH", map[string]string{"0x1234": "0.1"}},
+		{"send max", "ETH", map[string]string{sideChainAddress: SendMaxAmount}},
+		{"lock address without cross chain", "", map[string]string{lockAddress: "0.1"}},
+	}
+	for _, test := range invalid {
+		rawTx := &openwallet.RawTransaction{Account: account, FeeRate: "0.0001", To: test.to}
+		if len(test.sideChain) > 0 {
+			rawTx.SetExtParam("crossChain", test.sideChain)
+		}
+		if err := decoder.CreateRawTransaction(wallet, rawTx); err == nil {
+			t.Errorf("%s: CreateRawTransaction should be failed", test.name)
+		}
+	}
+}
+
+func TestTransactionDecoder_Vote(t *testing.T) {
+
+	producers := []string{"02" + strings.Repeat("1a", 32), "03" + strings.Repeat("2b", 32)}
+
+	wallet := newTestWalletDAI(t, "walletA", 0x01)
+	account := wallet.newAccount(t, 1)
+	addr := wallet.newAddress(t, account)
+
+	wm, node := newTestUnspentNode(t, []string{addr.Address}, "1")
+	defer node.Close()
+	decoder := NewTransactionDecoder(wm)
+
+	rawTx := &openwallet.RawTransaction{
+		Account: account,
+		FeeRate: "0.0001",
+		To:      map[string]string{addr.Address: "0.5"},
+	}
+	rawTx.SetExtParam("voteCandidates", producers)
+	if err := decoder.CreateRawTransaction(wallet, rawTx); err != nil {
+		t.Fatalf("CreateRawTransaction failed unexpected error: %v", err)
+	}
+	emptyTrans := rawTx.RawHex
+	if err := decoder.SignRawTransaction(wallet, rawTx); err != nil {
+		t.Fatalf("SignRawTransaction failed unexpected error: %v", err)
+	}
+	if err := decoder.VerifyRawTransaction(wallet, rawTx); err != nil || !rawTx.IsCompleted {
+		t.Fatalf("VerifyRawTransaction failed unexpected error: %v", err)
+	}
+	//投票到自己的地址，只支出手续费
+	if rawTx.TxAmount != "-"+rawTx.Fees {
+		t.Errorf("TxAmount = %s, expected = -%s", rawTx.TxAmount, rawTx.Fees)
+	}
+
+	//版本，类型，payload版本，属性，输入
+	txBytes, _ := hex.DecodeString(emptyTrans)
+	if txBytes[0] != TxVersion09 || txBytes[1] != TxTypeTransferAsset {
+		t.Fatalf("transaction version = %d, type = %d", txBytes[0], txBytes[1])
+	}
+	pos := 4
+	pos += 1 + int(txBytes[pos])*TxInputSize
+
+	//每个输出带类型，投票输出的payload记录候选人
+	expected := []byte{VoteOutputVersion0, 1, VoteTypeDelegate, byte(len(producers))}
+	for _, producer := range producers {
+		pub, _ := hex.DecodeString(producer)
+		expected = append(expected, writeVarBytes(pub)...)
+	}
+	votes := 0
+	outputs := int(txBytes[pos])
+	pos++
+	for i := 0; i < outputs; i++ {
+		out := txBytes[pos : pos+TxOutputSize]
+		pos += TxOutputSize
+		outputType := txBytes[pos]
+		pos++
+		if outputType == OutputTypeNone {
+			continue
+		}
+		votes++
+		if outputType != OutputTypeVote || !bytes.Equal(txBytes[pos:pos+len(expected)], expected) {
+			t.Fatalf("vote output type = %d, payload = %x, expected = %x", outputType, txBytes[pos:], expected)
+		}
+		pos += len(expected)
+		programHash, _ := addressToProgramHash(addr.Address)
+		if amount := binary.LittleEndian.Uint64(out[32:40]); amount != 50000000 || !bytes.Equal(out[44:], programHash) {
+			t.Errorf("vote output amount = %d, program hash = %x", amount, out[44:])
+		}
+	}
+	if votes != 1 || len(txBytes) != pos+4 {
+		t.Errorf("vote outputs = %d, remain bytes = %d", votes, len(txBytes)-pos)
+	}
+	if err := decoder.UnlockRawTransaction(rawTx); err != nil {
+		t.Fatalf("UnlockRawTransaction failed unexpected error: %v", err)
+	}
+
+	other := newTestWalletDAI(t, "walletB", 0x02)
+	otherAddr := other.newAddress(t, other.newAccount(t, 1))
+	invalid := []struct {
+		name       string
+		voteType   string
+		candidates []string
+		to         map[string]string
+	}{
+		{"public key", "", []string{"04" + strings.Repeat("1a", 32)}, map[string]string{addr.Address: "0.1"}},
+		{"duplicated", "", []string{producers[0], producers[0]}, map[string]string{addr.Address: "0.1"}},
+		{"vote type", "unknown", producers, map[string]string{addr.Address: "0.1"}},
+		{"crc candidate", "crc", producers[:1], map[string]string{addr.Address: "0.1"}},
+		{"other address", "", producers, map[string]string{otherAddr.Address: "0.1"}},
+		{"receivers", "", producers, map[string]string{addr.Address: "0.1", otherAddr.Address: "0.1"}},
+		{"send max", "", producers, map[string]string{addr.Address: SendMaxAmount}},
+	}
+	for _, test := range invalid {
+		rawTx := &openwallet.RawTransaction{Account: account, FeeRate: "0.0001", To: test.to}
+		rawTx.SetExtParam("voteCandidates", test.candidates)
+		if len(test.voteType) > 0 {
+			rawTx.SetExtParam("voteType", test.voteType)
+		}
+		if err := decoder.CreateRawTransaction(wallet, rawTx); err == nil {
+			t.Errorf("%s: CreateRawTransaction should be failed", test.name)
+		}
+	}
+
+	//CR委员投票使用版本1，按voteAmounts记录每个候选人的票数
+	cids := [][]byte{
+		append([]byte{0x67}, bytes.Repeat([]byte{0x3c}, 20)...),
+		append([]byte{0x67}, bytes.Repeat([]byte{0x4d}, 20)...),
+	}
+	crcCandidates := []string{elastosTransaction.EncodeCheck(cids[0][:1], cids[0][1:]), elastosTransaction.EncodeCheck(cids[1][:1], cids[1][1:])}
+	rawTx = &openwallet.RawTransaction{
+		Account: account,
+		FeeRate: "0.0001",
+		To:      map[string]string{addr.Address: "0.5"},
+	}
+	rawTx.SetExtParam("voteType", "crc")
+	rawTx.SetExtParam("voteCandidates", crcCandidates)
+	rawTx.SetExtParam("voteAmounts", []string{"0.3", "0.2"})
+	if err := decoder.CreateRawTransaction(wallet, rawTx); err != nil {
+		t.Fatalf("crc vote CreateRawTransaction failed unexpected error: %v", err)
+	}
+	expected = []byte{OutputTypeVote, VoteOutputVersion1, 1, VoteTypeCRC, 2}
+	expected = append(append(expected, writeVarBytes(cids[0])...), uint64ToLittleEndianBytes(30000000)...)
+	expected = append(append(expected, writeVarBytes(cids[1])...), uint64ToLittleEndianBytes(20000000)...)
+	if !strings.Contains(rawTx.RawHex, hex.EncodeToString(expected)) {
+		t.Errorf("crc vote payload %x is not found in transaction: %s", expected, rawTx.RawHex)
+	}
+	if err := decoder.UnlockRawTransaction(rawTx); err != nil {
+		t.Fatalf("UnlockRawTransaction failed unexpected error: %v", err)
+	}
+
+	crcInvalid := []struct {
+		name       string
+		candidates []string
+		amounts    []string
+	}{
+		{"amounts missing", crcCandidates, nil},
+		{"amounts count", crcCandidates, []string{"0.3"}},
+		{"amounts over", crcCandidates, []string{"0.3", "0.3"}},
+		{"amount precision", crcCandidates, []string{"0.3", "0.000000001"}},
+		{"amount zero", crcCandidates, []string{"0.3", "0"}},
+	}
+	for _, test := range crcInvalid {
+		rawTx := &openwallet.RawTransaction{Account: account, FeeRate: "0.0001", To: map[string]string{addr.Address: "0.5"}}
+		rawTx.SetExtParam("voteType", "crc")
+		rawTx.SetExtParam("voteCandidates", test.candidates)
+		if test.amounts != nil {
+			rawTx.SetExtParam("voteAmounts", test.amounts)
+		}
+		if err := decoder.CreateRawTransaction(wallet, rawTx); err == nil {
+			t.Errorf("%s: crc vote CreateRawTransaction should be failed", test.name)
+		}
+	}
+
+	//只有一个候选人时获得全部票数，超级节点投票不能指定票数
+	payload, err := (&voteParam{VoteType: VoteTypeCRC, Candidates: cids[:1]}).payload(100)
+	if err != nil {
+		t.Fatalf("crc vote payload failed unexpected error: %v", err)
+	}
+	expected = append([]byte{VoteOutputVersion1, 1, VoteTypeCRC, 1}, writeVarBytes(cids[0])...)
+	expected = append(expected, uint64ToLittleEndianBytes(100)...)
+	if !bytes.Equal(payload.Serialize(), expected) {
+		t.Errorf("crc vote payload = %x, expected = %x", payload.Serialize(), expected)
+	}
+	rawTx = &openwallet.RawTransaction{Account: account, FeeRate: "0.0001", To: map[string]string{addr.Address: "0.5"}}
+	rawTx.SetExtParam("voteCandidates", producers)
+	rawTx.SetExtParam("voteAmounts", []string{"0.1", "0.1"})
+	if err := decoder.CreateRawTransaction(wallet, rawTx); err == nil {
+		t.Errorf("delegate vote with amounts should be failed")
+	}
+}
+
+func TestTransactionDecoder_OutputLock(t *testing.T) {
+
+	wallet := newTestWalletDAI(t, "walletA", 0x01)
+	account := wallet.newAccount(t, 1)
+	addr := wallet.newAddress(t, account)
+	receiver := "EQZFJqni8nGrbU4gkmP4V9Qmi1BHbnWuEe"
+
+	utxo := func(n int, amount string, confirmations int, extra map[string]interface{}) map[string]interface{} {
+		u := map[string]interface{}{
+			"assetid":       elastosTransaction.AssetID_ELA,
+			"txid":          fmt.Sprintf("%064x", n),
+			"vout":          0,
+			"address":       addr.Address,
+			"amount":        amount,
+			"confirmations": confirmations,
+		}
+		for k, v := range extra {
+			u[k] = v
+		}
+		return u
+	}
+	utxos := []map[string]interface{}{
+		utxo(1, "100", 50, map[string]interface{}{"txtype": TxTypeCoinBase}), //未成熟的coinbase
+		utxo(2, "1", 150, map[string]interface{}{"txtype": TxTypeCoinBase}),  //已成熟的coinbase
+		utxo(3, "50", 10, map[string]interface{}{"outputlock": 2000}),        //未到锁定高度
+		utxo(4, "2", 10, map[string]interface{}{"outputlock": 900}),          //已到锁定高度
+		utxo(5, "0.5", 10, map[string]interface{}{"txtype": TxTypeTransferAsset}),
+	}
+	node := newTestNode(t, map[string]testNodeHandler{
+		"listunspent": func(params gjson.Result) (interface{}, error) {
+			return utxos, nil
+		},
+		"getblockcount": func(params gjson.Result) (interface{}, error) {
+			return 1001, nil
+		},
+	})
+	defer node.Close()
+	wm := newTestWalletManager(t, node.URL)
+	decoder := NewTransactionDecoder(wm)
+
+	balances, err := wm.Blockscanner.GetBalanceByAddress(addr.Address)
+	if err != nil || len(balances) != 1 || balances[0].ConfirmBalance != "3.5" || balances[0].Balance != "3.5" {
+		t.Fatalf("GetBalanceByAddress = %+v, err = %v, expected spendable balance = 3.5", balances, err)
+	}
+	locked, err := wm.GetLockedBalance(addr.Address)
+	if err != nil || len(locked) != 1 || locked[0].Balance != "150.00000000" {
+		t.Fatalf("GetLockedBalance = %+v, err = %v, expected = 150.00000000", locked, err)
+	}
+
+	rawTx := &openwallet.RawTransaction{
+		Account: account,
+		FeeRate: "0.0001",
+		To:      map[string]string{receiver: "3.2"},
+	}
+	rawTx.SetExtParam("outputLock", 5000)
+	if err := decoder.CreateRawTransaction(wallet, rawTx); err != nil {
+		t.Fatalf("CreateRawTransaction failed unexpected error: %v", err)
+	}
+
+	//输入只有可花费的utxo，已到锁定高度的输入序号为0xFFFFFFFE
+	txBytes, _ := hex.DecodeString(rawTx.RawHex)
+	pos := 3
+	inputs := int(txBytes[pos])
+	pos++
+	if inputs != 3 {
+		t.Fatalf("inputs = %d, expected = 3", inputs)
+	}
+	unlockedTxID, _ := reverseHexToBytes(fmt.Sprintf("%064x", 4))
+	for i := 0; i < inputs; i++ {
+		in := txBytes[pos : pos+TxInputSize]
+		pos += TxInputSize
+		sequence := binary.LittleEndian.Uint32(in[34:])
+		if bytes.Equal(in[:32], unlockedTxID) != (sequence == 0xFFFFFFFE) {
+			t.Errorf("input: %x sequence = %x", in[:32], sequence)
+		}
+	}
+
+	//接收输出锁定，找零不锁定
+	receiverHash, _ := addressToProgramHash(receiver)
+	outputs := int(txBytes[pos])
+	pos++
+	for i := 0; i < outputs; i++ {
+		out := txBytes[pos : pos+TxOutputSize]
+		pos += TxOutputSize
+		expected := uint32(0)
+		if bytes.Equal(out[44:], receiverHash) {
+			expected = 5000
+		}
+		if lock := binary.LittleEndian.Uint32(out[40:44]); lock != expected {
+			t.Errorf("output: %x lock = %d, expected = %d", out[44:], lock, expected)
+		}
+	}
+	if lockTime := binary.LittleEndian.Uint32(txBytes[pos:]); lockTime != 900 {
+		t.Errorf("transaction lock time = %d, expected = 900", lockTime)
+	}
+	if err := decoder.UnlockRawTransaction(rawTx); err != nil {
+		t.Fatalf("UnlockRawTransaction failed unexpected error: %v", err)
+	}
+
+	//锁定的余额不能使用
+	rawTx = &openwallet.RawTransaction{Account: account, FeeRate: "0.0001", To: map[string]string{receiver: "4"}}
+	if err := decoder.CreateRawTransaction(wallet, rawTx); err == nil {
+		t.Errorf("CreateRawTransaction should be failed when spendable balance is not enough")
+	}
+	rawTx = &openwallet.RawTransaction{Account: account, FeeRate: "0.0001", To: map[string]string{receiver: "1"}}
+	rawTx.SetExtParam("outputLock", "-1")
+	if err := decoder.CreateRawTransaction(wallet, rawTx); err == nil {
+		t.Errorf("CreateRawTransaction should be failed when output lock is invalid")
+	}
+}
+
+func TestTransactionDecoder_Memo(t *testing.T) {
+
+	memo := "deposit:10086"
+
+	wallet := newTestWalletDAI(t, "walletA", 0x01)
+	account := wallet.newAccount(t, 1)
+	addr := wallet.newAddress(t, account)
+
+	wm, node := newTestUnspentNode(t, []string{addr.Address}, "1")
+	defer node.Close()
+	decoder := NewTransactionDecoder(wm)
+
+	rawTx := &openwallet.RawTransaction{
+		Account: account,
+		FeeRate: "0.0001",
+		To:      map[string]string{"EQZFJqni8nGrbU4gkmP4V9Qmi1BHbnWuEe": "0.1"},
+	}
+	rawTx.SetExtParam("memo", memo)
+	if err := decoder.CreateRawTransaction(wallet, rawTx); err != nil {
+		t.Fatalf("CreateRawTransaction failed unexpected error: %v", err)
+	}
+
+	//类型，payload版本，属性数量，备注属性
+	txBytes, _ := hex.DecodeString(rawTx.RawHex)
+	expected := append([]byte{TxTypeTransferAsset, elastosTransaction.DefaultPayloadVersion, 1, AttributeUsageMemo}, writeVarBytes([]byte(memo))...)
+	if !bytes.HasPrefix(txBytes, expected) {
+		t.Fatalf("transaction = %x, expected prefix = %x", txBytes, expected)
+	}
+
+	if err := decoder.SignRawTransaction(wallet, rawTx); err != nil {
+		t.Fatalf("SignRawTransaction failed unexpected error: %v", err)
+	}
+	if err := decoder.VerifyRawTransaction(wallet, rawTx); err != nil || !rawTx.IsCompleted {
+		t.Fatalf("VerifyRawTransaction failed unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,453 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package elastos
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+
+	"github.com/blocktree/go-owcdrivers/elastosTransaction"
+	"github.com/blocktree/go-owcrypt"
+)
+
+/*
+	elastosTransaction只支持标准地址的单签交易，
+	以下结构按节点的序列化规则构建交易单，用于支持多重签名等扩展交易
+*/
+
+const (
+	//交易类型
+	TxTypeCoinBase                 = byte(0x00)
+	TxTypeRegisterAsset            = byte(0x01)
+	TxTypeTransferAsset            = byte(0x02)
+	TxTypeRecord                   = byte(0x03)
+	TxTypeDeploy                   = byte(0x04)
+	TxTypeSideChainPow             = byte(0x05)
+	TxTypeRechargeToSideChain      = byte(0x06)
+	TxTypeWithdrawFromSideChain    = byte(0x07) //侧链提现到主链
+	TxTypeTransferCrossChainAsset  = byte(0x08) //跨链转账，主链转到侧链
+	TxTypeRegisterProducer         = byte(0x09)
+	TxTypeCancelProducer           = byte(0x0a)
+	TxTypeUpdateProducer           = byte(0x0b)
+	TxTypeReturnDepositCoin        = byte(0x0c)
+	TxTypeActivateProducer         = byte(0x0d)
+	TxTypeIllegalProposalEvidence  = byte(0x0e)
+	TxTypeIllegalVoteEvidence      = byte(0x0f)
+	TxTypeIllegalBlockEvidence     = byte(0x10)
+	TxTypeIllegalSidechainEvidence = byte(0x11)
+	TxTypeInactiveArbitrators      = byte(0x12)
+	TxTypeUpdateVersion            = byte(0x13)
+
+	//交易单版本，0x09及以上的交易单输出带类型及payload
+	TxVersionDefault = byte(0x00)
+	TxVersion09      = byte(0x09)
+
+	//输出类型
+	OutputTypeNone = byte(0x00)
+	OutputTypeVote = byte(0x01)
+
+	//投票类型
+	VoteTypeDelegate = byte(0x00) //DPoS超级节点
+	VoteTypeCRC      = byte(0x01) //CR委员
+
+	//投票输出payload版本，版本1每个候选人记录票数
+	VoteOutputVersion0 = byte(0x00)
+	VoteOutputVersion1 = byte(0x01)
+
+	//一个投票输出最多投票的超级节点数量
+	MaxVoteProducers = 36
+
+	//交易属性类型
+	AttributeUsageMemo = byte(0x81)
+
+	//签名参数长度，0x40 + 64字节签名
+	SignatureScriptLength = 65
+
+	//手续费最多计算的轮数
+	MaxFeeIterations = 5
+
+	//输入长度，txid + vout + sequence
+	TxInputSize = 32 + 2 + 4
+	//ELA输出长度，assetid + amount + outputlock + programhash，代币输出的金额为变长字节
+	TxOutputSize = 32 + 8 + 4 + 21
+)
+
+//txTypeNames 交易类型名称
+var txTypeNames = map[byte]string{
+	TxTypeCoinBase:                 "CoinBase",
+	TxTypeRegisterAsset:            "RegisterAsset",
+	TxTypeTransferAsset:            "TransferAsset",
+	TxTypeRecord:                   "Record",
+	TxTypeDeploy:                   "Deploy",
+	TxTypeSideChainPow:             "SideChainPow",
+	TxTypeRechargeToSideChain:      "RechargeToSideChain",
+	TxTypeWithdrawFromSideChain:    "WithdrawFromSideChain",
+	TxTypeTransferCrossChainAsset:  "TransferCrossChainAsset",
+	TxTypeRegisterProducer:         "RegisterProducer",
+	TxTypeCancelProducer:           "CancelProducer",
+	TxTypeUpdateProducer:           "UpdateProducer",
+	TxTypeReturnDepositCoin:        "ReturnDepositCoin",
+	TxTypeActivateProducer:         "ActivateProducer",
+	TxTypeIllegalProposalEvidence:  "IllegalProposalEvidence",
+	TxTypeIllegalVoteEvidence:      "IllegalVoteEvidence",
+	TxTypeIllegalBlockEvidence:     "IllegalBlockEvidence",
+	TxTypeIllegalSidechainEvidence: "IllegalSidechainEvidence",
+	TxTypeInactiveArbitrators:      "InactiveArbitrators",
+	TxTypeUpdateVersion:            "UpdateVersion",
+}
+
+//txTypeName 交易类型名称，未知类型显示为十六进制
+func txTypeName(txType int32) string {
+	if name, ok := txTypeNames[byte(txType)]; ok && txType >= 0 && txType <= 0xFF {
+		return name
+	}
+	return fmt.Sprintf("0x%02x", txType)
+}
+
+//txInput 交易输入
+type txInput struct {
+	TxID     string
+	Vout     uint16
+	Sequence uint32
+	Address  string
+}
+
+//txOutput 交易输出
+type txOutput struct {
+	AssetID    string
+	Amount     uint64   //ELA金额，8位小数的定点数
+	TokenValue *big.Int //代币金额，按资产精度放大的整数
+	OutputLock uint32
+	Address    string
+	Type       byte   //输出类型，版本0x09及以上的交易单才序列化
+	Payload    []byte //输出类型的payload
+}
+
+//txAttribute 交易属性
+type txAttribute struct {
+	Usage byte
+	Data  []byte
+}
+
+//txProgram 解锁脚本
+type txProgram struct {
+	Code      []byte
+	Parameter []byte
+}
+
+//elaTransaction ELA交易单
+type elaTransaction struct {
+	Version        byte
+	TxType         byte
+	PayloadVersion byte
+	Payload        []byte
+	Attributes     []*txAttribute
+	Inputs         []*txInput
+	Outputs        []*txOutput
+	LockTime       uint32
+}
+
+//newTransferTransaction 创建转账交易单
+func newTransferTransaction(vins []*txInput, vouts []*txOutput) (*elaTransaction, error) {
+	if len(vins) == 0 || len(vouts) == 0 {
+		return nil, fmt.Errorf("miss inputs or outputs")
+	}
+
+	tx := &elaTransaction{
+		TxType:         TxTypeTransferAsset,
+		PayloadVersion: elastosTransaction.DefaultPayloadVersion,
+		Inputs:         vins,
+		Outputs:        vouts,
+	}
+	return tx, nil
+}
+
+//crossChainPayload 跨链转账的payload，记录每个发送到锁定地址的输出对应的侧链地址及侧链到账金额
+type crossChainPayload struct {
+	Addresses     []string
+	OutputIndexes []uint64
+	Amounts       []uint64
+}
+
+//Serialize 按payload版本0序列化
+func (p *crossChainPayload) Serialize() []byte {
+	buf := writeVarUint(uint64(len(p.Addresses)))
+	for i, address := range p.Addresses {
+		buf = append(buf, writeVarBytes([]byte(address))...)
+		buf = append(buf, writeVarUint(p.OutputIndexes[i])...)
+		buf = append(buf, uint64ToLittleEndianBytes(p.Amounts[i])...)
+	}
+	return buf
+}
+
+//newCrossChainTransaction 创建跨链转账交易单
+func newCrossChainTransaction(vins []*txInput, vouts []*txOutput, payload *crossChainPayload) (*elaTransaction, error) {
+	if len(payload.Addresses) == 0 {
+		return nil, fmt.Errorf("miss cross chain addresses")
+	}
+
+	tx, err := newTransferTransaction(vins, vouts)
+	if err != nil {
+		return nil, err
+	}
+	tx.TxType = TxTypeTransferCrossChainAsset
+	tx.PayloadVersion = 0
+	tx.Payload = payload.Serialize()
+	return tx, nil
+}
+
+//voteContent 一种投票类型的候选人，版本1记录每个候选人的票数
+type voteContent struct {
+	VoteType   byte
+	Candidates [][]byte
+	Votes      []uint64
+}
+
+//voteOutputPayload 投票输出的payload
+type voteOutputPayload struct {
+	Version  byte
+	Contents []*voteContent
+}
+
+//Serialize 序列化投票输出的payload
+func (p *voteOutputPayload) Serialize() []byte {
+	buf := []byte{p.Version}
+	buf = append(buf, writeVarUint(uint64(len(p.Contents)))...)
+	for _, content := range p.Contents {
+		buf = append(buf, content.VoteType)
+		buf = append(buf, writeVarUint(uint64(len(content.Candidates)))...)
+		for i, candidate := range content.Candidates {
+			buf = append(buf, writeVarBytes(candidate)...)
+			if p.Version >= VoteOutputVersion1 {
+				buf = append(buf, uint64ToLittleEndianBytes(content.Votes[i])...)
+			}
+		}
+	}
+	return buf
+}
+
+//SerializeUnsigned 序列化未签名的交易单
+func (tx *elaTransaction) SerializeUnsigned() ([]byte, error) {
+
+	buf := make([]byte, 0)
+
+	//默认版本不写版本号，节点按第一个字节是否小于0x09区分版本号及交易类型
+	if tx.Version >= TxVersion09 {
+		buf = append(buf, tx.Version)
+	}
+	buf = append(buf, tx.TxType, tx.PayloadVersion)
+	buf = append(buf, tx.Payload...)
+
+	buf = append(buf, writeVarUint(uint64(len(tx.Attributes)))...)
+	for _, attr := range tx.Attributes {
+		buf = append(buf, attr.Usage)
+		buf = append(buf, writeVarBytes(attr.Data)...)
+	}
+
+	buf = append(buf, writeVarUint(uint64(len(tx.Inputs)))...)
+	for _, in := range tx.Inputs {
+		txid, err := reverseHexToBytes(in.TxID)
+		if err != nil || len(txid) != 32 {
+			return nil, fmt.Errorf("invalid input txid: %s", in.TxID)
+		}
+		buf = append(buf, txid...)
+		buf = append(buf, uint16ToLittleEndianBytes(in.Vout)...)
+		buf = append(buf, uint32ToLittleEndianBytes(in.Sequence)...)
+	}
+
+	buf = append(buf, writeVarUint(uint64(len(tx.Outputs)))...)
+	for _, out := range tx.Outputs {
+		assetID, err := reverseHexToBytes(out.AssetID)
+		if err != nil || len(assetID) != 32 {
+			return nil, fmt.Errorf("invalid output asset id: %s", out.AssetID)
+		}
+		programHash, err := addressToProgramHash(out.Address)
+		if err != nil {
+			return nil, err
+		}
+		value, err := out.serializeValue()
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, assetID...)
+		buf = append(buf, value...)
+		buf = append(buf, uint32ToLittleEndianBytes(out.OutputLock)...)
+		buf = append(buf, programHash...)
+		if tx.Version >= TxVersion09 {
+			buf = append(buf, out.Type)
+			buf = append(buf, out.Payload...)
+		} else if out.Type != OutputTypeNone {
+			return nil, fmt.Errorf("output type: %d requires transaction version: %d", out.Type, TxVersion09)
+		}
+	}
+
+	buf = append(buf, uint32ToLittleEndianBytes(tx.LockTime)...)
+
+	return buf, nil
+}
+
+//serializeValue 序列化输出金额，ELA为8字节定点数，代币按侧链规则写入大端整数的变长字节
+func (out *txOutput) serializeValue() ([]byte, error) {
+	if out.AssetID == elastosTransaction.AssetID_ELA {
+		return uint64ToLittleEndianBytes(out.Amount), nil
+	}
+	if out.TokenValue == nil || out.TokenValue.Sign() < 0 {
+		return nil, fmt.Errorf("invalid token value of asset id: %s", out.AssetID)
+	}
+	return writeVarBytes(out.TokenValue.Bytes()), nil
+}
+
+//CreateEmptyRawTransactionAndHash 创建空交易单，返回每个输入地址的待签哈希
+func (tx *elaTransaction) CreateEmptyRawTransactionAndHash() (string, []elastosTransaction.TxHash, error) {
+
+	emptyTrans, err := tx.SerializeUnsigned()
+	if err != nil {
+		return "", nil, err
+	}
+
+	hash := hex.EncodeToString(owcrypt.Hash(emptyTrans, 0, owcrypt.HASH_ALG_SHA256))
+
+	txHashes := make([]elastosTransaction.TxHash, 0)
+
+loop:
+	for _, in := range tx.Inputs {
+		for _, txHash := range txHashes {
+			if txHash.Address == in.Address {
+				continue loop
+			}
+		}
+		txHashes = append(txHashes, elastosTransaction.TxHash{Address: in.Address, Hash: hash})
+	}
+
+	return hex.EncodeToString(emptyTrans), txHashes, nil
+}
+
+//unsignedTransactionID 计算交易单ID，交易单ID是未签名交易单的双重SHA256，按小端显示
+func unsignedTransactionID(emptyTrans string) (string, error) {
+	txBytes, err := hex.DecodeString(emptyTrans)
+	if err != nil {
+		return "", err
+	}
+	hash := owcrypt.Hash(txBytes, 0, owcrypt.HASh_ALG_DOUBLE_SHA256)
+	for i, j := 0, len(hash)-1; i < j; i, j = i+1, j-1 {
+		hash[i], hash[j] = hash[j], hash[i]
+	}
+	return hex.EncodeToString(hash), nil
+}
+
+//programSize 解锁脚本序列化后的长度，n为公钥数量，n大于1时为required-of-n多重签名
+func programSize(required, n int) int {
+	parameter := SignatureScriptLength
+	code := 1 + 33 + 1
+	if n > 1 {
+		parameter = required * SignatureScriptLength
+		code = 1 + n*(1+33) + 1 + 1
+	}
+	return len(writeVarBytes(make([]byte, parameter))) + len(writeVarBytes(make([]byte, code)))
+}
+
+//combineRawTransaction 合并解锁脚本到空交易单
+func combineRawTransaction(emptyTrans string, programs []*txProgram) (string, error) {
+
+	txBytes, err := hex.DecodeString(emptyTrans)
+	if err != nil {
+		return "", err
+	}
+
+	txBytes = append(txBytes, writeVarUint(uint64(len(programs)))...)
+	for _, p := range programs {
+		txBytes = append(txBytes, writeVarBytes(p.Parameter)...)
+		txBytes = append(txBytes, writeVarBytes(p.Code)...)
+	}
+
+	return hex.EncodeToString(txBytes), nil
+}
+
+//standardProgramCode 标准地址的锁定脚本
+func standardProgramCode(pub []byte) []byte {
+	code := []byte{byte(len(pub))}
+	code = append(code, pub...)
+	code = append(code, elastosTransaction.OP_CHECKSIG)
+	return code
+}
+
+//verifySignature 验证签名
+func verifySignature(pub, hash, signature []byte) bool {
+	if len(pub) != 33 || len(hash) != 32 || len(signature) != 64 {
+		return false
+	}
+	publicKey := owcrypt.PointDecompress(pub, owcrypt.ECC_CURVE_SECP256R1)[1:]
+	return owcrypt.Verify(publicKey, nil, 0, hash, 32, signature, owcrypt.ECC_CURVE_SECP256R1) == owcrypt.SUCCESS
+}
+
+//addressToProgramHash 地址转21字节的程序哈希
+func addressToProgramHash(address string) ([]byte, error) {
+	prefix, hash, err := elastosTransaction.DecodeCheck(address)
+	if err != nil || len(prefix) != 1 {
+		return nil, fmt.Errorf("invalid address: %s", address)
+	}
+	return append(prefix, hash...), nil
+}
+
+//writeVarUint 节点的变长整数编码
+func writeVarUint(value uint64) []byte {
+	switch {
+	case value < 0xFD:
+		return []byte{byte(value)}
+	case value <= 0xFFFF:
+		return append([]byte{0xFD}, uint16ToLittleEndianBytes(uint16(value))...)
+	case value <= 0xFFFFFFFF:
+		return append([]byte{0xFE}, uint32ToLittleEndianBytes(uint32(value))...)
+	default:
+		return append([]byte{0xFF}, uint64ToLittleEndianBytes(value)...)
+	}
+}
+
+//writeVarBytes 变长字节编码
+func writeVarBytes(data []byte) []byte {
+	return append(writeVarUint(uint64(len(data))), data...)
+}
+
+func reverseHexToBytes(hexVar string) ([]byte, error) {
+	data, err := hex.DecodeString(hexVar)
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+		data[i], data[j] = data[j], data[i]
+	}
+	return data, nil
+}
+
+func uint16ToLittleEndianBytes(data uint16) []byte {
+	tmp := [2]byte{}
+	binary.LittleEndian.PutUint16(tmp[:], data)
+	return tmp[:]
+}
+
+func uint32ToLittleEndianBytes(data uint32) []byte {
+	tmp := [4]byte{}
+	binary.LittleEndian.PutUint32(tmp[:], data)
+	return tmp[:]
+}
+
+func uint64ToLittleEndianBytes(data uint64) []byte {
+	tmp := [8]byte{}
+	binary.LittleEndian.PutUint64(tmp[:], data)
+	return tmp[:]
+}
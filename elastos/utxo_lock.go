@@ -0,0 +1,244 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package elastos
+
+import (
+	"path/filepath"
+
+	"github.com/asdine/storm"
+	"github.com/blocktree/openwallet/common/file"
+	"github.com/blocktree/openwallet/openwallet"
+)
+
+/*
+	utxo锁定表：
+	交易单创建后到广播确认前，节点的listunspent仍会返回已选用的utxo，
+	并发创建的交易单会选中相同的utxo，导致后广播的交易单被节点拒绝。
+	创建交易单时记录选用的utxo，选币时跳过，以下情况解除锁定：
+	1. 广播被节点拒绝，或调用UnlockRawTransaction放弃交易单
+	2. 超过锁定时长
+	3. 区块扫描发现utxo已被花费
+*/
+
+//UnspentLockDBFile utxo锁定表数据库文件
+const UnspentLockDBFile = "unspentlock.db"
+
+//openUnspentLockDB 打开utxo锁定表数据库，调用者需持有unspentLockMu
+func (wm *WalletManager) openUnspentLockDB() (*storm.DB, error) {
+	file.MkdirAll(wm.Config.dbPath)
+	return storm.Open(filepath.Join(wm.Config.dbPath, UnspentLockDBFile))
+}
+
+//LockUnspents 锁定交易单选用的utxo，lockID为交易单id
+func (wm *WalletManager) LockUnspents(lockID string, unspents []*Unspent) error {
+
+	wm.unspentLockMu.Lock()
+	defer wm.unspentLockMu.Unlock()
+
+	db, err := wm.openUnspentLockDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, u := range unspents {
+		if err := tx.Save(NewUnspentLock(u, lockID, wm.Config.UnspentLockExpiration)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+//UnlockUnspents 解除交易单锁定的utxo
+func (wm *WalletManager) UnlockUnspents(lockID string) error {
+
+	wm.unspentLockMu.Lock()
+	defer wm.unspentLockMu.Unlock()
+
+	db, err := wm.openUnspentLockDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var locks []*UnspentLock
+	err = db.Find("LockID", lockID, &locks)
+	if err != nil && err != storm.ErrNotFound {
+		return err
+	}
+
+	return deleteUnspentLocks(db, locks)
+}
+
+//UnlockUnspentsByKey 解除指定utxo的锁定，用于utxo已被花费，key为txid_vout
+func (wm *WalletManager) UnlockUnspentsByKey(keys ...string) error {
+
+	wm.unspentLockMu.Lock()
+	defer wm.unspentLockMu.Unlock()
+
+	db, err := wm.openUnspentLockDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	locks := make([]*UnspentLock, 0)
+	for _, key := range keys {
+		var lock UnspentLock
+		err = db.One("Key", key, &lock)
+		if err == storm.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		locks = append(locks, &lock)
+	}
+
+	return deleteUnspentLocks(db, locks)
+}
+
+//GetUnspentLocks 获取未过期的utxo锁定，过期的锁定会被删除
+func (wm *WalletManager) GetUnspentLocks() (map[string]*UnspentLock, error) {
+
+	wm.unspentLockMu.Lock()
+	defer wm.unspentLockMu.Unlock()
+
+	db, err := wm.openUnspentLockDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var locks []*UnspentLock
+	err = db.All(&locks)
+	if err != nil {
+		return nil, err
+	}
+
+	valid := make(map[string]*UnspentLock)
+	expired := make([]*UnspentLock, 0)
+	for _, lock := range locks {
+		if lock.IsExpired() {
+			expired = append(expired, lock)
+			continue
+		}
+		valid[lock.Key] = lock
+	}
+
+	if err := deleteUnspentLocks(db, expired); err != nil {
+		return nil, err
+	}
+
+	return valid, nil
+}
+
+//availableUnspents 可用于创建交易单的utxo，跳过输出锁定、未成熟的coinbase及已被未广播交易单锁定的utxo
+func (wm *WalletManager) availableUnspents(unspents []*Unspent) ([]*Unspent, error) {
+	return wm.filterLockedUnspents(spendableUnspents(unspents))
+}
+
+//filterLockedUnspents 过滤已被锁定的utxo
+func (wm *WalletManager) filterLockedUnspents(unspents []*Unspent) ([]*Unspent, error) {
+
+	locks, err := wm.GetUnspentLocks()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(locks) == 0 {
+		return unspents, nil
+	}
+
+	available := make([]*Unspent, 0, len(unspents))
+	for _, u := range unspents {
+		if lock, ok := locks[unspentKey(u.TxID, u.Vout)]; ok {
+			wm.Log.Debugf("utxo: %s_%d is locked by transaction: %s", u.TxID, u.Vout, lock.LockID)
+			continue
+		}
+		available = append(available, u)
+	}
+	return available, nil
+}
+
+func deleteUnspentLocks(db *storm.DB, locks []*UnspentLock) error {
+
+	if len(locks) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, lock := range locks {
+		if err := tx.DeleteStruct(lock); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+//lockRawTransactions 锁定交易单构建时使用的utxo，锁定id为交易单id，记录在ExtParam的utxoLockID
+func (decoder *TransactionDecoder) lockRawTransactions(built ...*builtTransaction) error {
+	for _, b := range built {
+		lockID, err := unsignedTransactionID(b.rawTx.RawHex)
+		if err != nil {
+			return err
+		}
+		if err := decoder.wm.LockUnspents(lockID, b.usedUTXO); err != nil {
+			return openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "lock utxo failed: %v", err)
+		}
+		b.rawTx.SetExtParam("utxoLockID", lockID)
+	}
+	return nil
+}
+
+//unlockRawTransactions 解除已创建交易单锁定的utxo，用于后续交易单创建失败时放弃整批交易单
+func (decoder *TransactionDecoder) unlockRawTransactions(rawTxs []*openwallet.RawTransactionWithError) {
+	for _, rawTx := range rawTxs {
+		if err := decoder.UnlockRawTransaction(rawTx.RawTx); err != nil {
+			decoder.wm.Log.Errorf("unlock utxo of transaction failed, unexpected error: %v", err)
+		}
+	}
+}
+
+//UnlockRawTransaction 解除交易单锁定的utxo，用于放弃未广播的交易单，交易单序列的最后一笔同时解除归集交易的锁定
+func (decoder *TransactionDecoder) UnlockRawTransaction(rawTx *openwallet.RawTransaction) error {
+	lockIDs := []string{rawTx.GetExtParam().Get("utxoLockID").String()}
+	for _, lockID := range rawTx.GetExtParam().Get("sequenceLockIDs").Array() {
+		lockIDs = append(lockIDs, lockID.String())
+	}
+	for _, lockID := range lockIDs {
+		if len(lockID) == 0 {
+			continue
+		}
+		if err := decoder.wm.UnlockUnspents(lockID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
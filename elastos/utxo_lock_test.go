@@ -0,0 +1,181 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package elastos
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/tidwall/gjson"
+)
+
+func TestWalletManager_UnspentLocks(t *testing.T) {
+
+	wm := newTestWalletManager(t, "")
+	unspents := []*Unspent{
+		{TxID: fmt.Sprintf("%064x", 1), Vout: 0, Address: "ESUQkMEsfUdbmrounnCrNdVHLXrvSzvy7A", Amount: "1"},
+		{TxID: fmt.Sprintf("%064x", 1), Vout: 1, Address: "ESUQkMEsfUdbmrounnCrNdVHLXrvSzvy7A", Amount: "1"},
+		{TxID: fmt.Sprintf("%064x", 2), Vout: 0, Address: "EQZFJqni8nGrbU4gkmP4V9Qmi1BHbnWuEe", Amount: "1"},
+	}
+
+	if err := wm.LockUnspents("tx1", unspents[:2]); err != nil {
+		t.Fatalf("LockUnspents failed unexpected error: %v", err)
+	}
+
+	available, err := wm.filterLockedUnspents(unspents)
+	if err != nil {
+		t.Fatalf("filterLockedUnspents failed unexpected error: %v", err)
+	}
+	if len(available) != 1 || available[0] != unspents[2] {
+		t.Errorf("available unspents = %d, expected only the unlocked one", len(available))
+	}
+
+	//utxo已被花费
+	if err := wm.UnlockUnspentsByKey(unspentKey(unspents[0].TxID, unspents[0].Vout), "unknown_0"); err != nil {
+		t.Fatalf("UnlockUnspentsByKey failed unexpected error: %v", err)
+	}
+	locks, _ := wm.GetUnspentLocks()
+	if len(locks) != 1 || locks[unspentKey(unspents[1].TxID, unspents[1].Vout)] == nil {
+		t.Errorf("locks = %v, expected only %s_%d", locks, unspents[1].TxID, unspents[1].Vout)
+	}
+
+	//解除交易单的锁定
+	if err := wm.UnlockUnspents("tx1"); err != nil {
+		t.Fatalf("UnlockUnspents failed unexpected error: %v", err)
+	}
+	if locks, _ := wm.GetUnspentLocks(); len(locks) != 0 {
+		t.Errorf("locks = %v, expected empty", locks)
+	}
+
+	//锁定过期
+	wm.Config.UnspentLockExpiration = -time.Second
+	if err := wm.LockUnspents("tx2", unspents); err != nil {
+		t.Fatalf("LockUnspents failed unexpected error: %v", err)
+	}
+	available, _ = wm.filterLockedUnspents(unspents)
+	if len(available) != len(unspents) {
+		t.Errorf("available unspents = %d, expected all after expired", len(available))
+	}
+}
+
+func TestTransactionDecoder_LockUnspents(t *testing.T) {
+
+	wallet := newTestWalletDAI(t, "walletA", 0x01)
+	account := wallet.newAccount(t, 1)
+	addr := wallet.newAddress(t, account)
+
+	wm, node := newTestUnspentNode(t, []string{addr.Address}, "0.5", "0.5", "0.5", "0.5")
+	defer node.Close()
+	decoder := NewTransactionDecoder(wm)
+
+	newRawTx := func() *openwallet.RawTransaction {
+		return &openwallet.RawTransaction{
+			Account: account,
+			FeeRate: "0.0001",
+			To:      map[string]string{"EK89RfdqPUr82EUHQy5KNVH3LSmNsQLPau": "0.6"},
+		}
+	}
+
+	//并发创建的交易单不会选中相同的utxo
+	rawTxs := []*openwallet.RawTransaction{newRawTx(), newRawTx()}
+	var wg sync.WaitGroup
+	for _, rawTx := range rawTxs {
+		wg.Add(1)
+		go func(rawTx *openwallet.RawTransaction) {
+			defer wg.Done()
+			if err := decoder.CreateRawTransaction(wallet, rawTx); err != nil {
+				t.Errorf("CreateRawTransaction failed unexpected error: %v", err)
+			}
+		}(rawTx)
+	}
+	wg.Wait()
+
+	for _, rawTx := range rawTxs {
+		if len(rawTx.GetExtParam().Get("utxoLockID").String()) == 0 {
+			t.Errorf("utxoLockID is not recorded in ExtParam")
+		}
+	}
+	locks, _ := wm.GetUnspentLocks()
+	if len(locks) != 4 {
+		t.Errorf("locked utxo = %d, expected = 4", len(locks))
+	}
+
+	//所有utxo都已锁定
+	if err := decoder.CreateRawTransaction(wallet, newRawTx()); err == nil {
+		t.Errorf("CreateRawTransaction should be failed when all utxo are locked")
+	}
+
+	//连接中断时节点可能已接受交易单，不解除锁定
+	droppedNode := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	wm.WalletClient = NewClient(droppedNode.URL, false)
+	rawTxs[0].IsCompleted = true
+	if _, err := decoder.SubmitRawTransaction(wallet, rawTxs[0]); err == nil {
+		t.Fatalf("SubmitRawTransaction should be failed")
+	}
+	droppedNode.Close()
+	if locks, _ := wm.GetUnspentLocks(); len(locks) != 4 {
+		t.Errorf("locked utxo = %d, expected = 4 after connection dropped", len(locks))
+	}
+
+	//节点拒绝交易单解除锁定
+	sendNode := newTestNode(t, map[string]testNodeHandler{
+		"sendrawtransaction": func(params gjson.Result) (interface{}, error) {
+			return nil, errors.New("double spent")
+		},
+	})
+	defer sendNode.Close()
+	wm.WalletClient = NewClient(sendNode.URL, false)
+	if _, err := decoder.SubmitRawTransaction(wallet, rawTxs[0]); err == nil {
+		t.Fatalf("SubmitRawTransaction should be failed")
+	}
+	if locks, _ := wm.GetUnspentLocks(); len(locks) != 2 {
+		t.Errorf("locked utxo = %d, expected = 2 after submit failed", len(locks))
+	}
+
+	//区块扫描发现utxo已被花费
+	locks, _ = wm.GetUnspentLocks()
+	trx := &Transaction{TxID: "spend", Type: 2, Vins: make([]*Vin, 0)}
+	for _, lock := range locks {
+		trx.Vins = append(trx.Vins, &Vin{TxID: lock.TxID, Vout: lock.Vout, Addr: lock.Address, Value: "0.5"})
+	}
+	scanAddressFunc := func(address string) (string, bool) {
+		return account.AccountID, address == addr.Address
+	}
+
+	//只提取交易记录不解除锁定
+	result := ExtractResult{extractData: make(map[string]*openwallet.TxExtractData), extractOmniData: make(map[string]map[string]*openwallet.TxExtractData)}
+	wm.Blockscanner.extractTransaction(trx, &result, scanAddressFunc)
+	if locks, _ := wm.GetUnspentLocks(); len(locks) != 2 {
+		t.Errorf("locked utxo = %d, expected = 2 after extract only", len(locks))
+	}
+
+	//区块提取完成后解除锁定
+	wm.Blockscanner.SetBlockScanAddressFunc(scanAddressFunc)
+	if err := wm.Blockscanner.batchExtractTransaction(1, "block", []string{trx.TxID}, []*Transaction{trx}, []error{nil}); err != nil {
+		t.Fatalf("batchExtractTransaction failed unexpected error: %v", err)
+	}
+	if locks, _ := wm.GetUnspentLocks(); len(locks) != 0 {
+		t.Errorf("locked utxo = %d, expected = 0 after spent", len(locks))
+	}
+}
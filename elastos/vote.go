@@ -0,0 +1,170 @@
+/*
+ * Copyright 2018 The openwallet Authors
+ * This file is part of the openwallet library.
+ *
+ * The openwallet library is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The openwallet library is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Lesser General Public License for more details.
+ */
+
+package elastos
+
+import (
+	"bytes"
+	"encoding/hex"
+
+	"github.com/blocktree/openwallet/openwallet"
+	"github.com/shopspring/decimal"
+)
+
+/*
+	DPoS投票：把ELA转到账户自己的地址，输出类型为投票，payload记录候选人。
+	交易单ExtParam的voteCandidates为候选人列表，voteType为投票类型，默认为delegate。
+	To只能有一个账户自己的地址，金额为投票的票数，投票的ELA仍在该地址，可以随时花费，花费后投票失效。
+	delegate：候选人为超级节点的公钥，最多36个，每个节点获得全部票数，使用payload版本0。
+	crc：候选人为CR委员的DID地址，ExtParam的voteAmounts按顺序记录每个候选人的票数，票数合计不能超过投票金额，使用payload版本1。
+	     只有一个候选人时可以不指定voteAmounts，候选人获得全部票数。
+*/
+
+//voteTypes 投票类型名称
+var voteTypes = map[string]byte{
+	"delegate": VoteTypeDelegate,
+	"crc":      VoteTypeCRC,
+}
+
+//voteParam 投票参数
+type voteParam struct {
+	VoteType   byte
+	Candidates [][]byte
+	Votes      []uint64 //CR委员投票每个候选人的票数，为空时唯一的候选人获得全部票数
+}
+
+//getVote 交易单的投票参数，ExtParam没有voteCandidates时返回nil
+func (decoder *TransactionDecoder) getVote(rawTx *openwallet.RawTransaction) (*voteParam, error) {
+
+	candidates := rawTx.GetExtParam().Get("voteCandidates").Array()
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	typeName := rawTx.GetExtParam().Get("voteType").String()
+	if len(typeName) == 0 {
+		typeName = "delegate"
+	}
+	voteType, ok := voteTypes[typeName]
+	if !ok {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "vote type: %s is not supported", typeName)
+	}
+
+	vote := &voteParam{VoteType: voteType}
+	for _, c := range candidates {
+		candidate, err := decoder.decodeCandidate(voteType, c.String())
+		if err != nil {
+			return nil, err
+		}
+		for _, exist := range vote.Candidates {
+			if bytes.Equal(exist, candidate) {
+				return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "vote candidate: %s is duplicated", c.String())
+			}
+		}
+		vote.Candidates = append(vote.Candidates, candidate)
+	}
+
+	switch voteType {
+	case VoteTypeDelegate:
+		if len(vote.Candidates) > MaxVoteProducers {
+			return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "vote candidates: %d is over max producers: %d", len(vote.Candidates), MaxVoteProducers)
+		}
+	case VoteTypeCRC:
+		votes, err := decoder.getCRCVotes(rawTx, len(vote.Candidates))
+		if err != nil {
+			return nil, err
+		}
+		vote.Votes = votes
+	}
+
+	if vote.VoteType != VoteTypeCRC && rawTx.GetExtParam().Get("voteAmounts").Exists() {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "vote amounts are only supported by crc vote")
+	}
+
+	return vote, nil
+}
+
+//getCRCVotes CR委员投票每个候选人的票数，由ExtParam的voteAmounts按候选人顺序指定
+func (decoder *TransactionDecoder) getCRCVotes(rawTx *openwallet.RawTransaction, candidates int) ([]uint64, error) {
+
+	amounts := rawTx.GetExtParam().Get("voteAmounts").Array()
+	if len(amounts) == 0 {
+		if candidates > 1 {
+			return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "crc vote of %d candidates must have vote amounts", candidates)
+		}
+		return nil, nil
+	}
+	if len(amounts) != candidates {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "crc vote amounts: %d is not equal to candidates: %d", len(amounts), candidates)
+	}
+
+	votes := make([]uint64, 0, len(amounts))
+	for _, a := range amounts {
+		amount, err := decimal.NewFromString(a.String())
+		if err != nil || !amount.IsPositive() {
+			return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "crc vote amount: %s is invalid", a.String())
+		}
+		value, err := decoder.elaValue(amount)
+		if err != nil {
+			return nil, err
+		}
+		votes = append(votes, value)
+	}
+	return votes, nil
+}
+
+//decodeCandidate 解析候选人，超级节点为33字节的压缩公钥，CR委员为DID地址的程序哈希
+func (decoder *TransactionDecoder) decodeCandidate(voteType byte, candidate string) ([]byte, error) {
+
+	if voteType == VoteTypeCRC {
+		addressType, err := decoder.wm.Decoder.GetAddressType(candidate)
+		if err != nil || addressType != AddressTypeIDChain {
+			return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "crc candidate: %s is invalid", candidate)
+		}
+		return addressToProgramHash(candidate)
+	}
+
+	pub, err := hex.DecodeString(candidate)
+	if err != nil || len(pub) != 33 || (pub[0] != 0x02 && pub[0] != 0x03) {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "producer public key: %s is invalid", candidate)
+	}
+	return pub, nil
+}
+
+//payload 投票输出的payload，amount为投票输出的金额，CR委员的票数合计不能超过amount
+func (vote *voteParam) payload(amount uint64) (*voteOutputPayload, error) {
+
+	content := &voteContent{VoteType: vote.VoteType, Candidates: vote.Candidates}
+	if vote.VoteType == VoteTypeDelegate {
+		return &voteOutputPayload{Version: VoteOutputVersion0, Contents: []*voteContent{content}}, nil
+	}
+
+	if len(vote.Votes) == 0 {
+		content.Votes = []uint64{amount}
+	} else {
+		total := uint64(0)
+		for _, v := range vote.Votes {
+			total += v
+			if total < v || total > amount {
+				return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "crc vote amounts are over the vote output amount: %d", amount)
+			}
+		}
+		content.Votes = vote.Votes
+	}
+	if len(content.Votes) != len(content.Candidates) {
+		return nil, openwallet.Errorf(openwallet.ErrCreateRawTransactionFailed, "crc vote amounts: %d is not equal to candidates: %d", len(content.Votes), len(content.Candidates))
+	}
+	return &voteOutputPayload{Version: VoteOutputVersion1, Contents: []*voteContent{content}}, nil
+}